@@ -3,25 +3,41 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/andre2ar/go-products/configs"
 	_ "github.com/andre2ar/go-products/docs"
-	"github.com/andre2ar/go-products/internal/entity"
 	"github.com/andre2ar/go-products/internal/infra/database"
-	"github.com/andre2ar/go-products/internal/infra/webserver/handlers"
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/jwtauth/v5"
-	"github.com/swaggo/http-swagger/v2"
+	"github.com/andre2ar/go-products/internal/infra/health"
+	"github.com/andre2ar/go-products/internal/infra/mail"
+	"github.com/andre2ar/go-products/internal/infra/metrics"
+	"github.com/andre2ar/go-products/internal/infra/tracing"
+	"github.com/andre2ar/go-products/internal/infra/webserver"
+	"github.com/andre2ar/go-products/pkg/lifecycle"
+	"github.com/andre2ar/go-products/pkg/logging"
+	"github.com/spf13/pflag"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
 
+// slowQueryThreshold is the duration past which statements are logged as
+// slow queries.
+const slowQueryThreshold = 200 * time.Millisecond
+
+const (
+	// mailTimeout bounds the delivery of each queued email.
+	mailTimeout = 30 * time.Second
+	// healthTimeout bounds the readiness checks.
+	healthTimeout = 2 * time.Second
+)
+
 // @title           Go Products
 // @version         1.0
 // @description     Product API with authentication
@@ -36,100 +52,334 @@ import (
 // @securityDefinitions.apikey ApiKeyAuth
 // @in header
 // @name Authorization
+// @description "Bearer" followed by an access token, or by an API key on the products routes
 func main() {
-	config, err := configs.LoadConfig("./cmd/server")
-	if err != nil {
-		panic(err)
+	os.Exit(run(os.Args[1:]))
+}
+
+// Exit codes of the server.
+const (
+	exitOK = 0
+	// exitStartFailed reports the server could not start.
+	exitStartFailed = 1
+	// exitServerFailed reports the server stopped serving on its own.
+	exitServerFailed = 2
+	// exitUncleanShutdown reports a component could not be stopped in time,
+	// so requests or queued work may have been lost.
+	exitUncleanShutdown = 3
+)
+
+// defaultEnvFile is the .env file read unless --env-file names another one.
+const defaultEnvFile = "cmd/server/app.env"
+
+// run runs the command named by args and returns the exit code: config
+// print, or serving the API by default.
+func run(args []string) int {
+	if len(args) > 0 && args[0] == "config" {
+		return configCommand(args[1:])
 	}
+	return serve(args)
+}
 
-	db, err := gorm.Open(sqlite.Open("go-products.db"), &gorm.Config{})
-	if err != nil {
-		panic(err)
+// configCommand implements config print, writing the loaded configuration
+// to stdout in the .env format, with --redacted hiding the secrets.
+func configCommand(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: server config print [--redacted] [flags]")
+		return exitStartFailed
 	}
-	log.Println("Connected to the database")
 
-	err = db.AutoMigrate(&entity.Product{}, &entity.User{})
+	flags := pflag.NewFlagSet("config print", pflag.ContinueOnError)
+	redacted := flags.Bool("redacted", false, "replace the values of the secret keys")
+	options, err := parseFlags(flags, args[1:])
+	if errors.Is(err, pflag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitStartFailed
+	}
+	config, err := configs.Load(options)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		return exitStartFailed
 	}
-	log.Println("Database migrated")
 
-	productRepository := database.NewProduct(db)
-	productHandler := handlers.NewProductHandler(productRepository)
+	err = config.Print(os.Stdout, *redacted)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitStartFailed
+	}
+	return exitOK
+}
 
-	userRepository := database.NewUser(db)
-	userHandler := handlers.NewUserHandler(userRepository)
+// parseFlags parses args with flags, to which it adds the flags choosing
+// the configuration sources and the flags setting each key, and returns the
+// options loading the configuration.
+func parseFlags(flags *pflag.FlagSet, args []string) (configs.Options, error) {
+	file := flags.String("config", "", "YAML or TOML configuration file")
+	envFile := flags.String("env-file", defaultEnvFile, ".env file, skipped when missing unless set")
+	configs.RegisterFlags(flags)
 
-	log.Println("Documentation can be found on " + config.DocsUrl + "/api/v1/docs/index.html")
+	err := flags.Parse(args)
+	if err != nil {
+		return configs.Options{}, err
+	}
+	if flags.NArg() > 0 {
+		return configs.Options{}, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
 
-	router := chi.NewRouter()
+	return configs.Options{
+		File:           *file,
+		EnvFile:        *envFile,
+		RequireEnvFile: flags.Changed("env-file"),
+		Flags:          flags,
+	}, nil
+}
 
-	router.Use(middleware.RequestID)
-	router.Use(middleware.RealIP)
-	router.Use(middleware.Logger)
-	router.Use(middleware.Recoverer)
+// serve serves the API until a termination signal or a server failure,
+// then shuts down every started component and returns the exit code. The
+// configuration is reloaded on SIGHUP and whenever its files change.
+func serve(args []string) int {
+	options, err := parseFlags(pflag.NewFlagSet("server", pflag.ContinueOnError), args)
+	if errors.Is(err, pflag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		slog.Error("could not parse the flags", slog.Any("error", err))
+		return exitStartFailed
+	}
+	config, err := configs.Load(options)
+	if err != nil {
+		slog.Error("could not load the configuration", slog.Any("error", err))
+		return exitStartFailed
+	}
 
-	router.Use(middleware.WithValue("Jwt", config.TokenAuth))
-	router.Use(middleware.WithValue("JwtExpiresIn", config.JWTExpiresIn))
+	// Set as default so the standard log package, used by dependencies,
+	// also writes structured records.
+	level := new(slog.LevelVar)
+	err = level.UnmarshalText([]byte(config.LogLevel))
+	if err != nil {
+		slog.Error("could not create the logger", slog.Any("error", err))
+		return exitStartFailed
+	}
+	logger, err := logging.NewLeveled(os.Stdout, level, config.LogFormat)
+	if err != nil {
+		slog.Error("could not create the logger", slog.Any("error", err))
+		return exitStartFailed
+	}
+	slog.SetDefault(logger)
 
-	router.Route("/api/v1", func(router chi.Router) {
-		router.Get("/docs/*", httpSwagger.Handler(httpSwagger.URL(config.DocsUrl+"/api/v1/docs/doc.json")))
+	reloader := configs.NewReloader(config, options, logger)
+	reloader.Subscribe(func(config *configs.Conf) {
+		level.UnmarshalText([]byte(config.LogLevel))
+	})
 
-		router.Post("/sessions", userHandler.CreateSession)
+	app := lifecycle.New(time.Duration(config.ShutdownTimeout)*time.Second, logger)
+	services, err := start(reloader, logger, app)
+	if err != nil {
+		slog.Error("could not start the server", slog.Any("error", err))
+		app.Shutdown(context.Background())
+		return exitStartFailed
+	}
 
-		router.Post("/users", userHandler.CreateUser)
+	failed := make(chan error, len(services))
+	for _, s := range services {
+		go func(s service) {
+			err := webserver.Serve(s.server, s.listener)
+			if err != nil {
+				failed <- fmt.Errorf("%s: %w", s.name, err)
+			}
+		}(s)
+	}
+	slog.Info("server started", slog.String("url", webserver.ServerURL(config)))
 
-		router.Route("/products", func(router chi.Router) {
-			router.Use(jwtauth.Verifier(config.TokenAuth))
-			router.Use(jwtauth.Authenticator(config.TokenAuth))
+	code := exitOK
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+wait:
+	for {
+		select {
+		case <-hangup:
+			reloader.Reload()
+		case sig := <-stop:
+			slog.Info("shutting down", slog.String("signal", sig.String()), slog.Duration("timeout", app.Timeout))
+			break wait
+		case err := <-failed:
+			slog.Error("server failed, shutting down", slog.Any("error", err), slog.Duration("timeout", app.Timeout))
+			code = exitServerFailed
+			break wait
+		}
+	}
 
-			router.Get("/", productHandler.GetProducts)
-			router.Post("/", productHandler.CreateProduct)
-			router.Get("/{id}", productHandler.GetProduct)
-			router.Put("/{id}", productHandler.UpdateProduct)
-			router.Delete("/{id}", productHandler.DeleteProduct)
-		})
-	})
+	err = app.Shutdown(context.Background())
+	if err != nil {
+		slog.Error("shutdown was not clean", slog.Any("error", err))
+		if code == exitOK {
+			code = exitUncleanShutdown
+		}
+		return code
+	}
+	slog.Info("shutdown complete")
+	return code
+}
 
-	StartServer(router, config.WebServerPort)
+// service is an HTTP server with the listener it is to serve.
+type service struct {
+	name     string
+	server   *http.Server
+	listener net.Listener
 }
 
-func StartServer(r *chi.Mux, port string) {
-	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: r,
+// start opens the database, starts the background workers and builds the
+// HTTP servers on top of them, returning them with the listeners they are
+// to serve. Each component is registered with app as soon as it is started
+// so a failure further on still releases it.
+func start(reloader *configs.Reloader, logger *slog.Logger, app *lifecycle.Manager) ([]service, error) {
+	var services []service
+	config := reloader.Current()
+	db, err := gorm.Open(sqlite.Open("go-products.db"), &gorm.Config{Logger: database.NewLogger(slowQueryThreshold)})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
 	}
+	app.OnShutdown("database", func(context.Context) error {
+		return sqlDB.Close()
+	})
+	slog.Info("connected to the database")
 
-	go func() {
-		err := server.ListenAndServe()
+	err = db.Use(&database.QueryTimeout{Timeout: time.Duration(config.DBQueryTimeout) * time.Second})
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalln(err)
-		}
-	}()
+	tracer, err := tracing.NewProvider(context.Background(), tracing.Config{
+		Exporter:    config.TracingExporter,
+		Endpoint:    config.TracingEndpoint,
+		File:        config.TracingFile,
+		ServiceName: config.TracingServiceName,
+		SampleRatio: config.TracingSampleRatio,
+	})
+	if err != nil {
+		return nil, err
+	}
+	app.OnShutdown("tracing", tracer.Shutdown)
+	err = db.Use(database.NewQueryTracing())
+	if err != nil {
+		return nil, err
+	}
 
-	log.Println("Server started at: http://localhost:" + port)
+	m := metrics.New()
+	err = db.Use(database.NewQueryMetrics(m.DBQueryDuration, m.DBQueryErrors))
+	if err != nil {
+		return nil, err
+	}
+	err = m.RegisterDB(sqlDB, "main")
+	if err != nil {
+		return nil, err
+	}
+	// Registered before the API server, the metrics server stops after it
+	// and is scraped until the end of the drain.
+	if config.MetricsAddr != "" {
+		metricsServer := webserver.NewMetricsServer(config, m, logger)
+		metricsListener, err := net.Listen("tcp", config.MetricsAddr)
+		if err != nil {
+			return nil, err
+		}
+		app.OnShutdown("metrics server", func(ctx context.Context) error {
+			defer metricsListener.Close()
+			return metricsServer.Shutdown(ctx)
+		})
+		services = append(services, service{name: "metrics server", server: metricsServer, listener: metricsListener})
+		slog.Info("metrics available", slog.String("url", "http://"+metricsListener.Addr().String()+"/metrics"))
+	}
 
-	WaitForTerminateSignal()
+	err = database.Migrate(db)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("database migrated")
 
-	GracefullyShutdown(server)
-}
+	err = database.SeedAdmins(db, strings.Split(config.AdminEmails, ","))
+	if err != nil {
+		return nil, err
+	}
 
-func WaitForTerminateSignal() {
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
-	<-stop
-}
+	mailQueue := mail.NewQueue(newMailer(config), config.MailQueueSize, mailTimeout)
+	go mailQueue.Run()
+	app.OnShutdown("mail queue", mailQueue.Close)
 
-func GracefullyShutdown(server *http.Server) {
-	ctx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancelShutdown()
+	checks := health.New(healthTimeout)
+	checks.Add("mail_queue", mailQueue.Check)
 
-	log.Println("Shutting down server in upt to 5 seconds...")
-	err := server.Shutdown(ctx)
+	router := webserver.NewRouter(config, webserver.Dependencies{
+		DB:       db,
+		Mailer:   mailQueue,
+		Logger:   logger,
+		Metrics:  m,
+		Tracer:   tracer,
+		Health:   checks,
+		Reloader: reloader,
+	})
+	server, err := webserver.NewServer(config, router, logger)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := webserver.Listen(config)
 	if err != nil {
-		log.Fatalf("Could not gracefully shutdown server: %v\n", err)
+		return nil, err
 	}
+	app.OnShutdown("http server", func(ctx context.Context) error {
+		// Closing the listener also releases it when serving never started.
+		defer listener.Close()
+		return server.Shutdown(ctx)
+	})
 
-	log.Println("Server stopped")
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		err := reloader.Watch(watchCtx)
+		if err != nil {
+			logger.Error("could not watch the configuration files", slog.Any("error", err))
+		}
+	}()
+	app.OnShutdown("config watcher", func(ctx context.Context) error {
+		stopWatching()
+		select {
+		case <-watched:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	// Readiness fails first and the server keeps serving for the drain
+	// delay, so load balancers stop routing traffic here before the server
+	// stops accepting connections.
+	drain := lifecycle.Delay(time.Duration(config.ShutdownDrainDelay) * time.Second)
+	app.OnShutdown("readiness", func(ctx context.Context) error {
+		checks.Drain()
+		return drain(ctx)
+	})
+
+	slog.Info("documentation available", slog.String("url", config.DocsUrl+"/api/v1/docs/index.html"))
+	services = append(services, service{name: "http server", server: server, listener: listener})
+	return services, nil
+}
+
+func newMailer(config *configs.Conf) mail.Mailer {
+	switch config.MailDriver {
+	case "smtp":
+		return mail.NewSMTPMailer(net.JoinHostPort(config.SMTPHost, config.SMTPPort), config.MailFrom, config.SMTPUsername, config.SMTPPassword)
+	case "memory":
+		return mail.NewMemoryMailer()
+	default:
+		return mail.NewFileMailer(config.MailDir, config.MailFrom)
+	}
 }
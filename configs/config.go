@@ -1,43 +1,402 @@
+// Package configs loads and validates the settings of the server.
 package configs
 
 import (
-	"github.com/go-chi/jwtauth/v5"
+	"errors"
+	"fmt"
+	"github.com/andre2ar/go-products/pkg/jwtkeys"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"github.com/subosito/gotenv"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
 )
 
-var cfg *conf
-
-type conf struct {
-	DBDriver      string `mapstructure:"DB_DRIVER"`
-	DBHost        string `mapstructure:"DB_HOST"`
-	DBPort        string `mapstructure:"DB_PORT"`
-	DBUser        string `mapstructure:"DB_USER"`
-	DBPassword    string `mapstructure:"DB_PASSWORD"`
-	DBName        string `mapstructure:"DB_NAME"`
-	WebServerPort string `mapstructure:"WEBSERVER_PORT"`
-	JWTSecret     string `mapstructure:"JWT_SECRET"`
-	JWTExpiresIn  int    `mapstructure:"JWT_EXPIRES_IN"`
-	DocsUrl       string `mapstructure:"DOCS_URL"`
-	TokenAuth     *jwtauth.JWTAuth
-}
-
-func LoadConfig(path string) (*conf, error) {
-	viper.AddConfigPath(path)
-	viper.SetConfigName("app")
-	viper.SetConfigType("env")
-	viper.AutomaticEnv()
-
-	err := viper.ReadInConfig()
+// Conf holds the settings of the server. Each field is read from the key
+// named by its mapstructure tag; the fields tagged secret are hidden when
+// the configuration is printed redacted, and only those tagged reload are
+// applied by a Reloader without a restart. TokenKeys is built by Load from
+// the JWT settings.
+type Conf struct {
+	DBDriver       string `mapstructure:"DB_DRIVER"`
+	DBHost         string `mapstructure:"DB_HOST"`
+	DBPort         string `mapstructure:"DB_PORT"`
+	DBUser         string `mapstructure:"DB_USER"`
+	DBPassword     string `mapstructure:"DB_PASSWORD" secret:"true"`
+	DBName         string `mapstructure:"DB_NAME"`
+	DBQueryTimeout int    `mapstructure:"DB_QUERY_TIMEOUT"`
+	WebServerPort  string `mapstructure:"WEBSERVER_PORT"`
+	JWTSecret      string `mapstructure:"JWT_SECRET" secret:"true"`
+	JWTExpiresIn   int    `mapstructure:"JWT_EXPIRES_IN" reload:"true"`
+	JWTKeys        string `mapstructure:"JWT_KEYS"`
+	JWTKeyOverlap  int    `mapstructure:"JWT_KEY_OVERLAP"`
+	JWTIssuer      string `mapstructure:"JWT_ISSUER"`
+	JWTAudience    string `mapstructure:"JWT_AUDIENCE"`
+	JWTClockSkew   int    `mapstructure:"JWT_CLOCK_SKEW" reload:"true"`
+	DocsUrl        string `mapstructure:"DOCS_URL"`
+	LogLevel       string `mapstructure:"LOG_LEVEL" reload:"true"`
+	LogFormat      string `mapstructure:"LOG_FORMAT"`
+	AdminEmails    string `mapstructure:"ADMIN_EMAILS"`
+
+	WebServerSocket            string `mapstructure:"WEBSERVER_SOCKET"`
+	WebServerReadTimeout       int    `mapstructure:"WEBSERVER_READ_TIMEOUT"`
+	WebServerReadHeaderTimeout int    `mapstructure:"WEBSERVER_READ_HEADER_TIMEOUT"`
+	WebServerWriteTimeout      int    `mapstructure:"WEBSERVER_WRITE_TIMEOUT"`
+	WebServerIdleTimeout       int    `mapstructure:"WEBSERVER_IDLE_TIMEOUT"`
+	WebServerMaxHeaderBytes    int    `mapstructure:"WEBSERVER_MAX_HEADER_BYTES"`
+	WebServerMaxBodyBytes      int    `mapstructure:"WEBSERVER_MAX_BODY_BYTES"`
+	WebServerTLSCertFile       string `mapstructure:"WEBSERVER_TLS_CERT_FILE"`
+	WebServerTLSKeyFile        string `mapstructure:"WEBSERVER_TLS_KEY_FILE"`
+	WebServerH2C               bool   `mapstructure:"WEBSERVER_H2C"`
+	WebServerTrustedProxies    string `mapstructure:"WEBSERVER_TRUSTED_PROXIES"`
+	WebServerCORSOrigins       string `mapstructure:"WEBSERVER_CORS_ORIGINS" reload:"true"`
+
+	ShutdownDrainDelay int `mapstructure:"SHUTDOWN_DRAIN_DELAY"`
+	ShutdownTimeout    int `mapstructure:"SHUTDOWN_TIMEOUT"`
+
+	TracingExporter    string  `mapstructure:"TRACING_EXPORTER"`
+	TracingEndpoint    string  `mapstructure:"TRACING_ENDPOINT"`
+	TracingFile        string  `mapstructure:"TRACING_FILE"`
+	TracingServiceName string  `mapstructure:"TRACING_SERVICE_NAME"`
+	TracingSampleRatio float64 `mapstructure:"TRACING_SAMPLE_RATIO"`
+
+	MetricsAddr string `mapstructure:"METRICS_ADDR"`
+
+	MailDriver    string `mapstructure:"MAIL_DRIVER"`
+	MailFrom      string `mapstructure:"MAIL_FROM"`
+	MailDir       string `mapstructure:"MAIL_DIR"`
+	MailQueueSize int    `mapstructure:"MAIL_QUEUE_SIZE"`
+	SMTPHost      string `mapstructure:"SMTP_HOST"`
+	SMTPPort      string `mapstructure:"SMTP_PORT"`
+	SMTPUsername  string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword  string `mapstructure:"SMTP_PASSWORD" secret:"true"`
+
+	PasswordResetURL       string `mapstructure:"PASSWORD_RESET_URL"`
+	PasswordResetTTL       int    `mapstructure:"PASSWORD_RESET_TTL"`
+	PasswordResetRateLimit int    `mapstructure:"PASSWORD_RESET_RATE_LIMIT" reload:"true"`
+
+	EmailVerificationURL       string `mapstructure:"EMAIL_VERIFICATION_URL"`
+	EmailVerificationTTL       int    `mapstructure:"EMAIL_VERIFICATION_TTL"`
+	EmailVerificationRateLimit int    `mapstructure:"EMAIL_VERIFICATION_RATE_LIMIT" reload:"true"`
+	RequireEmailVerification   bool   `mapstructure:"REQUIRE_EMAIL_VERIFICATION"`
+
+	MFAIssuer       string `mapstructure:"MFA_ISSUER"`
+	MFAChallengeTTL int    `mapstructure:"MFA_CHALLENGE_TTL" reload:"true"`
+	MFARateLimit    int    `mapstructure:"MFA_RATE_LIMIT" reload:"true"`
+
+	LoginFreeAttempts  int `mapstructure:"LOGIN_FREE_ATTEMPTS" reload:"true"`
+	LoginBaseDelay     int `mapstructure:"LOGIN_BASE_DELAY" reload:"true"`
+	LoginMaxAttempts   int `mapstructure:"LOGIN_MAX_ATTEMPTS" reload:"true"`
+	LoginIPMaxAttempts int `mapstructure:"LOGIN_IP_MAX_ATTEMPTS" reload:"true"`
+	LoginLockout       int `mapstructure:"LOGIN_LOCKOUT" reload:"true"`
+
+	RateLimitProductsPerMinute int `mapstructure:"RATE_LIMIT_PRODUCTS_PER_MINUTE" reload:"true"`
+	RateLimitProductsBurst     int `mapstructure:"RATE_LIMIT_PRODUCTS_BURST" reload:"true"`
+	RateLimitUsersPerMinute    int `mapstructure:"RATE_LIMIT_USERS_PER_MINUTE" reload:"true"`
+	RateLimitUsersBurst        int `mapstructure:"RATE_LIMIT_USERS_BURST" reload:"true"`
+
+	IntrospectionClients string `mapstructure:"INTROSPECTION_CLIENTS" secret:"true"`
+
+	OIDCIssuer       string `mapstructure:"OIDC_ISSUER"`
+	OIDCClientID     string `mapstructure:"OIDC_CLIENT_ID"`
+	OIDCClientSecret string `mapstructure:"OIDC_CLIENT_SECRET" secret:"true"`
+	OIDCRedirectURL  string `mapstructure:"OIDC_REDIRECT_URL"`
+	OIDCScopes       string `mapstructure:"OIDC_SCOPES"`
+	OIDCStateTTL     int    `mapstructure:"OIDC_STATE_TTL"`
+	OIDCCookieSecure bool   `mapstructure:"OIDC_COOKIE_SECURE"`
+
+	TokenKeys *jwtkeys.KeyRing `mapstructure:"-"`
+}
+
+// Defaults returns the settings used for the keys no source sets. Only
+// JWT_SECRET has no usable default.
+func Defaults() Conf {
+	return Conf{
+		DBQueryTimeout: 5,
+		WebServerPort:  "8000",
+		JWTExpiresIn:   300,
+		JWTKeyOverlap:  3600,
+		JWTIssuer:      "http://localhost:8000",
+		JWTAudience:    "go-products",
+		JWTClockSkew:   30,
+		DocsUrl:        "http://localhost:8000",
+		LogLevel:       "info",
+		LogFormat:      "json",
+
+		WebServerReadTimeout:       15,
+		WebServerReadHeaderTimeout: 5,
+		WebServerWriteTimeout:      30,
+		WebServerIdleTimeout:       120,
+		WebServerMaxHeaderBytes:    1 << 20,
+		WebServerMaxBodyBytes:      1 << 20,
+
+		ShutdownDrainDelay: 5,
+		ShutdownTimeout:    30,
+
+		TracingExporter:    "none",
+		TracingFile:        "traces.json",
+		TracingServiceName: "go-products",
+		TracingSampleRatio: 1,
+
+		MetricsAddr: "localhost:9090",
+
+		MailDriver:    "file",
+		MailFrom:      "no-reply@go-products.local",
+		MailDir:       "mails",
+		MailQueueSize: 100,
+		SMTPPort:      "587",
+
+		PasswordResetURL:       "http://localhost:8000/reset-password",
+		PasswordResetTTL:       3600,
+		PasswordResetRateLimit: 3,
+
+		EmailVerificationURL:       "http://localhost:8000/verify-email",
+		EmailVerificationTTL:       86400,
+		EmailVerificationRateLimit: 3,
+
+		MFAIssuer:       "Go Products",
+		MFAChallengeTTL: 300,
+		MFARateLimit:    5,
+
+		LoginFreeAttempts:  3,
+		LoginBaseDelay:     1,
+		LoginMaxAttempts:   10,
+		LoginIPMaxAttempts: 100,
+		LoginLockout:       900,
+
+		RateLimitProductsPerMinute: 120,
+		RateLimitProductsBurst:     30,
+		RateLimitUsersPerMinute:    60,
+		RateLimitUsersBurst:        10,
+
+		OIDCRedirectURL:  "http://localhost:8000/api/v1/oidc/callback",
+		OIDCScopes:       "openid email profile",
+		OIDCStateTTL:     600,
+		OIDCCookieSecure: true,
+	}
+}
+
+// Options name the sources of the configuration besides the defaults and
+// the environment.
+type Options struct {
+	// File is a YAML or TOML file, told apart by its extension, whose keys
+	// are the setting keys in any case, such as jwt_secret.
+	File string
+	// EnvFile is a .env file. It is skipped when missing unless
+	// RequireEnvFile is set, so the environment alone can configure the
+	// server.
+	EnvFile        string
+	RequireEnvFile bool
+	// Flags are the command line flags registered by RegisterFlags.
+	Flags *pflag.FlagSet
+}
+
+// Load reads the configuration from its sources, each one overriding the
+// ones before it: the defaults, the file, the .env file, the environment
+// and the flags. Empty values in the .env file and the environment are
+// ignored. A key suffixed with _FILE, such as JWT_SECRET_FILE, names a file
+// holding the value of the key, like a mounted secret; it overrides the key
+// from every source but the flags. The configuration is validated before
+// being returned.
+func Load(options Options) (*Conf, error) {
+	v := viper.New()
+	defaults := reflect.ValueOf(Defaults())
+	for _, setting := range settings() {
+		v.SetDefault(setting.key, defaults.Field(setting.index).Interface())
+		v.BindEnv(setting.key)
+		v.BindEnv(setting.key + "_FILE")
+	}
+
+	if options.File != "" {
+		switch filepath.Ext(options.File) {
+		case ".yaml", ".yml", ".toml":
+		default:
+			return nil, fmt.Errorf("config file %s: expected a .yaml, .yml or .toml file", options.File)
+		}
+		v.SetConfigFile(options.File)
+		err := v.ReadInConfig()
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %w", options.File, err)
+		}
+	}
+
+	if options.EnvFile != "" {
+		env, err := gotenv.Read(options.EnvFile)
+		if err != nil && (options.RequireEnvFile || !errors.Is(err, fs.ErrNotExist)) {
+			return nil, fmt.Errorf("env file %s: %w", options.EnvFile, err)
+		}
+		values := map[string]any{}
+		for key, value := range env {
+			if value != "" {
+				values[key] = value
+			}
+		}
+		err = v.MergeConfigMap(values)
+		if err != nil {
+			return nil, fmt.Errorf("env file %s: %w", options.EnvFile, err)
+		}
+	}
+
+	for _, setting := range settings() {
+		flag := lookupFlag(options.Flags, setting.flag)
+		if flag != nil {
+			v.BindPFlag(setting.key, flag)
+		}
+		if flag != nil && flag.Changed {
+			continue
+		}
+
+		path := v.GetString(setting.key + "_FILE")
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s_FILE: %w", setting.key, err)
+		}
+		v.Set(setting.key, strings.TrimRight(string(data), "\r\n"))
+	}
+
+	var config Conf
+	err := v.Unmarshal(&config)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	err = config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	err = viper.Unmarshal(&cfg)
+	config.TokenKeys, err = LoadTokenKeys(config.JWTKeys, config.JWTSecret, time.Duration(config.JWTKeyOverlap)*time.Second)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// RegisterFlags registers one flag per key on flags, named after the key in
+// lower kebab case: --webserver-port sets WEBSERVER_PORT.
+func RegisterFlags(flags *pflag.FlagSet) {
+	defaults := reflect.ValueOf(Defaults())
+	for _, setting := range settings() {
+		usage := "sets " + setting.key
+		switch value := defaults.Field(setting.index); value.Kind() {
+		case reflect.Int:
+			flags.Int(setting.flag, int(value.Int()), usage)
+		case reflect.Float64:
+			flags.Float64(setting.flag, value.Float(), usage)
+		case reflect.Bool:
+			flags.Bool(setting.flag, value.Bool(), usage)
+		default:
+			flags.String(setting.flag, value.String(), usage)
+		}
+	}
+}
+
+// Redacted replaces the values of the secret keys in a redacted print.
+const Redacted = "[REDACTED]"
+
+// Print writes the configuration to w as KEY=value lines, the format of the
+// .env files. When redacted, the values of the secret keys are replaced by
+// Redacted unless they are empty.
+func (c *Conf) Print(w io.Writer, redacted bool) error {
+	values := reflect.ValueOf(c).Elem()
+	for _, setting := range settings() {
+		value := fmt.Sprint(values.Field(setting.index).Interface())
+		if redacted && setting.secret && value != "" {
+			value = Redacted
+		}
+		_, err := fmt.Fprintf(w, "%s=%s\n", setting.key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setting is a field of Conf along with the key and the flag setting it.
+type setting struct {
+	key    string
+	flag   string
+	secret bool
+	reload bool
+	index  int
+}
+
+// settings lists the fields of Conf read from a key, in declaration order.
+func settings() []setting {
+	t := reflect.TypeOf(Conf{})
+	var list []setting
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+		list = append(list, setting{
+			key:    key,
+			flag:   strings.ToLower(strings.ReplaceAll(key, "_", "-")),
+			secret: field.Tag.Get("secret") == "true",
+			reload: field.Tag.Get("reload") == "true",
+			index:  i,
+		})
+	}
+	return list
+}
+
+func lookupFlag(flags *pflag.FlagSet, name string) *pflag.Flag {
+	if flags == nil {
+		return nil
+	}
+	return flags.Lookup(name)
+}
+
+// LoadTokenKeys builds the key ring signing access tokens from spec, a comma
+// separated list of id=path entries naming PEM private keys, each optionally
+// followed by @ and the RFC 3339 time it starts signing. Without keys, tokens
+// are signed with HS256 and secret.
+func LoadTokenKeys(spec, secret string, overlap time.Duration) (*jwtkeys.KeyRing, error) {
+	if strings.TrimSpace(spec) == "" {
+		key, err := jwtkeys.NewHMACKey("default", []byte(secret), time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		return jwtkeys.NewKeyRing(overlap, key)
 	}
 
-	cfg.TokenAuth = jwtauth.New("HS256", []byte(cfg.JWTSecret), nil)
+	var keys []*jwtkeys.Key
+	for _, entry := range strings.Split(spec, ",") {
+		id, path, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || id == "" || path == "" {
+			return nil, fmt.Errorf("JWT_KEYS: entry %q must be id=path", entry)
+		}
+
+		var activeFrom time.Time
+		path, at, scheduled := strings.Cut(path, "@")
+		if scheduled {
+			parsed, err := time.Parse(time.RFC3339, at)
+			if err != nil {
+				return nil, fmt.Errorf("JWT_KEYS: key %s: %w", id, err)
+			}
+			activeFrom = parsed
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_KEYS: key %s: %w", id, err)
+		}
+		key, err := jwtkeys.ParsePEM(id, data, activeFrom)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
 
-	return cfg, err
+	return jwtkeys.NewKeyRing(overlap, keys...)
 }
@@ -0,0 +1,157 @@
+package configs
+
+import (
+	"bytes"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadFromTheEnvironmentAlone(t *testing.T) {
+	t.Setenv("JWT_SECRET", "a-secret-of-at-least-thirty-two-bytes")
+	t.Setenv("JWT_EXPIRES_IN", "600")
+
+	config, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), "app.env")})
+	require.NoError(t, err)
+
+	defaults := Defaults()
+	assert.Equal(t, "a-secret-of-at-least-thirty-two-bytes", config.JWTSecret)
+	assert.Equal(t, 600, config.JWTExpiresIn)
+	assert.Equal(t, defaults.WebServerPort, config.WebServerPort)
+	assert.Equal(t, defaults.TracingSampleRatio, config.TracingSampleRatio)
+	assert.NotNil(t, config.TokenKeys)
+}
+
+func TestLoadFailsOnMissingRequiredEnvFile(t *testing.T) {
+	t.Setenv("JWT_SECRET", "a-secret-of-at-least-thirty-two-bytes")
+
+	_, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), "app.env"), RequireEnvFile: true})
+	assert.ErrorContains(t, err, "app.env")
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "app.yaml", "jwt_secret: secret-from-the-configuration-file\nwebserver_port: 8001\nlog_level: debug\nlog_format: text\nmfa_issuer: File\n")
+	envFile := writeFile(t, "app.env", "WEBSERVER_PORT=8002\nLOG_LEVEL=warn\nMFA_ISSUER=\n")
+	t.Setenv("WEBSERVER_PORT", "8003")
+	t.Setenv("LOG_LEVEL", "error")
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	RegisterFlags(flags)
+	require.NoError(t, flags.Parse([]string{"--webserver-port=8004"}))
+
+	config, err := Load(Options{File: file, EnvFile: envFile, Flags: flags})
+	require.NoError(t, err)
+
+	assert.Equal(t, "8004", config.WebServerPort, "flags override the environment")
+	assert.Equal(t, "error", config.LogLevel, "the environment overrides the .env file")
+	assert.Equal(t, "File", config.MFAIssuer, "empty .env values are ignored")
+	assert.Equal(t, "text", config.LogFormat, "the file overrides the defaults")
+	assert.Equal(t, "secret-from-the-configuration-file", config.JWTSecret)
+}
+
+func TestLoadTOMLFile(t *testing.T) {
+	file := writeFile(t, "app.toml", "JWT_SECRET = \"a-secret-of-at-least-thirty-two-bytes\"\nTRACING_SAMPLE_RATIO = 0.25\nREQUIRE_EMAIL_VERIFICATION = true\n")
+
+	config, err := Load(Options{File: file})
+	require.NoError(t, err)
+	assert.Equal(t, 0.25, config.TracingSampleRatio)
+	assert.True(t, config.RequireEmailVerification)
+
+	_, err = Load(Options{File: writeFile(t, "app.json", "{}")})
+	assert.ErrorContains(t, err, "expected a .yaml, .yml or .toml file")
+}
+
+func TestLoadSecretsFromFiles(t *testing.T) {
+	t.Setenv("JWT_SECRET", "plain")
+	t.Setenv("JWT_SECRET_FILE", writeFile(t, "jwt_secret", "secret-from-the-configuration-file\n"))
+	t.Setenv("SMTP_PASSWORD_FILE", writeFile(t, "smtp_password", "mail-secret"))
+
+	config, err := Load(Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "secret-from-the-configuration-file", config.JWTSecret)
+	assert.Equal(t, "mail-secret", config.SMTPPassword)
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	RegisterFlags(flags)
+	require.NoError(t, flags.Parse([]string{"--jwt-secret=secret-from-the-command-line-flag"}))
+	config, err = Load(Options{Flags: flags})
+	require.NoError(t, err)
+	assert.Equal(t, "secret-from-the-command-line-flag", config.JWTSecret, "flags override _FILE keys")
+
+	t.Setenv("JWT_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+	_, err = Load(Options{})
+	assert.ErrorContains(t, err, "JWT_SECRET_FILE")
+}
+
+func TestLoadReportsEveryInvalidSetting(t *testing.T) {
+	t.Setenv("WEBSERVER_PORT", "0")
+	t.Setenv("TRACING_SAMPLE_RATIO", "2")
+	t.Setenv("MAIL_DRIVER", "smtp")
+	t.Setenv("SMTP_HOST", "")
+
+	_, err := Load(Options{})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "JWT_SECRET is required")
+	assert.ErrorContains(t, err, `WEBSERVER_PORT must be a port between 1 and 65535, got "0"`)
+	assert.ErrorContains(t, err, "TRACING_SAMPLE_RATIO must be between 0 and 1, got 2")
+	assert.ErrorContains(t, err, "SMTP_HOST is required")
+}
+
+func TestValidate(t *testing.T) {
+	config := Defaults()
+	config.JWTSecret = "a-secret-of-at-least-thirty-two-bytes"
+	assert.NoError(t, config.Validate())
+
+	config.LoginFreeAttempts = 20
+	config.ShutdownDrainDelay = 30
+	config.IntrospectionClients = "inventory:secret,billing"
+	config.OIDCIssuer = "https://accounts.example.com"
+	config.OIDCScopes = "email"
+	config.WebServerTLSCertFile = "tls.crt"
+	config.WebServerH2C = true
+	config.RateLimitUsersBurst = -1
+	config.MetricsAddr = "9090"
+	config.WebServerTrustedProxies = "10.0.0.0/8, proxy.internal"
+	config.WebServerCORSOrigins = "https://app.example.com, https://example.com/app"
+	config.JWTSecret = "secret"
+	err := config.Validate()
+	assert.ErrorContains(t, err, "LOGIN_FREE_ATTEMPTS must not exceed LOGIN_MAX_ATTEMPTS")
+	assert.ErrorContains(t, err, "SHUTDOWN_DRAIN_DELAY must be shorter than SHUTDOWN_TIMEOUT")
+	assert.ErrorContains(t, err, "INTROSPECTION_CLIENTS entry 2 must be id:secret")
+	assert.ErrorContains(t, err, "OIDC_CLIENT_ID is required")
+	assert.ErrorContains(t, err, "OIDC_SCOPES must include openid")
+	assert.ErrorContains(t, err, "WEBSERVER_TLS_KEY_FILE must be set along with WEBSERVER_TLS_CERT_FILE")
+	assert.ErrorContains(t, err, "WEBSERVER_H2C must be false when TLS is enabled")
+	assert.ErrorContains(t, err, "RATE_LIMIT_USERS_BURST must be at least 0")
+	assert.ErrorContains(t, err, `METRICS_ADDR must be host:port, got "9090"`)
+	assert.ErrorContains(t, err, `WEBSERVER_TRUSTED_PROXIES entry 2 must be an IP address or CIDR range, got "proxy.internal"`)
+	assert.ErrorContains(t, err, `WEBSERVER_CORS_ORIGINS entry 2 must be an origin such as https://example.com or *, got "https://example.com/app"`)
+	assert.ErrorContains(t, err, "JWT_SECRET must be at least 32 bytes long, got 6")
+}
+
+func TestPrintRedacted(t *testing.T) {
+	config := Defaults()
+	config.JWTSecret = "secret"
+	config.SMTPPassword = ""
+
+	var out bytes.Buffer
+	require.NoError(t, config.Print(&out, true))
+	assert.Contains(t, out.String(), "JWT_SECRET="+Redacted+"\n")
+	assert.Contains(t, out.String(), "SMTP_PASSWORD=\n")
+	assert.Contains(t, out.String(), "WEBSERVER_PORT=8000\n")
+	assert.NotContains(t, out.String(), "secret\n")
+
+	out.Reset()
+	require.NoError(t, config.Print(&out, false))
+	assert.Contains(t, out.String(), "JWT_SECRET=secret\n")
+}
@@ -0,0 +1,178 @@
+package configs
+
+import (
+	"context"
+	"errors"
+	"github.com/fsnotify/fsnotify"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// watchDelay is how long Watch waits for the writes to a file to settle
+// before reloading, as editors and deployments change files in several
+// steps.
+const watchDelay = 100 * time.Millisecond
+
+// Reloader holds the current configuration and loads it again from the
+// sources described by Options, on demand or when its files change. A new
+// configuration is validated as a whole before replacing the current one,
+// so a failing reload keeps the previous configuration in place. Only the
+// settings tagged reload are replaced; the others keep the values the
+// server was started with, so Current reports what is running.
+type Reloader struct {
+	Options Options
+	Logger  *slog.Logger
+
+	mu          sync.Mutex
+	current     atomic.Pointer[Conf]
+	subscribers []func(config *Conf)
+}
+
+func NewReloader(config *Conf, options Options, logger *slog.Logger) *Reloader {
+	r := &Reloader{Options: options, Logger: logger}
+	r.current.Store(config)
+	return r
+}
+
+// Current returns the configuration in use.
+func (r *Reloader) Current() *Conf {
+	return r.current.Load()
+}
+
+// Subscribe registers apply to be called with the new configuration after
+// every successful reload. Subscribers are called one at a time, in the
+// order they subscribed, and should apply the settings they can change
+// while running, such as rate limits, without blocking.
+func (r *Reloader) Subscribe(apply func(config *Conf)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.subscribers = append(r.subscribers, apply)
+}
+
+// Reload loads the configuration again and, when it is valid, makes it the
+// current one and applies it to the subscribers. Otherwise the current
+// configuration is kept and the error is returned. Changes to settings
+// which need a restart are logged and left out.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	config, err := Load(r.Options)
+	if err == nil {
+		err = r.keepRestartSettings(config)
+	}
+	if err != nil {
+		r.Logger.Error("could not reload the configuration, keeping the previous one", slog.Any("error", err))
+		return err
+	}
+
+	changed := changedKeys(r.current.Swap(config), config)
+	for _, apply := range r.subscribers {
+		apply(config)
+	}
+	r.Logger.Info("configuration reloaded", slog.Any("changed", changed))
+	return nil
+}
+
+// keepRestartSettings sets the settings of config which can not be
+// reloaded back to their current values, warning about those which
+// changed, and checks the result is still valid.
+func (r *Reloader) keepRestartSettings(config *Conf) error {
+	current := r.current.Load()
+	currentValues := reflect.ValueOf(current).Elem()
+	values := reflect.ValueOf(config).Elem()
+
+	var ignored []string
+	for _, setting := range settings() {
+		if setting.reload {
+			continue
+		}
+		field, currentField := values.Field(setting.index), currentValues.Field(setting.index)
+		if !reflect.DeepEqual(field.Interface(), currentField.Interface()) {
+			ignored = append(ignored, setting.key)
+			field.Set(currentField)
+		}
+	}
+	config.TokenKeys = current.TokenKeys
+
+	if len(ignored) > 0 {
+		r.Logger.Warn("configuration changes need a restart to apply", slog.Any("keys", ignored))
+	}
+	return config.Validate()
+}
+
+// Watch reloads the configuration whenever Options.File or Options.EnvFile
+// change, until ctx is done. Failed reloads are logged and do not stop the
+// watch.
+func (r *Reloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	files := map[string]bool{}
+	for _, file := range []string{r.Options.File, r.Options.EnvFile} {
+		if file == "" {
+			continue
+		}
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		files[path] = true
+
+		// The directory is watched rather than the file, which editors and
+		// Kubernetes replace instead of writing it in place.
+		err = watcher.Add(filepath.Dir(path))
+		optional := file == r.Options.EnvFile && !r.Options.RequireEnvFile
+		if err != nil && !(optional && errors.Is(err, fs.ErrNotExist)) {
+			return err
+		}
+	}
+
+	var reload <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// Kubernetes updates mounted files by swapping the ..data link.
+			if files[event.Name] || filepath.Base(event.Name) == "..data" {
+				reload = time.After(watchDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			r.Logger.Error("could not watch the configuration files", slog.Any("error", err))
+		case <-reload:
+			reload = nil
+			r.Reload()
+		}
+	}
+}
+
+// changedKeys lists the keys whose values differ between old and new,
+// without their values which may be secrets.
+func changedKeys(old, new *Conf) []string {
+	oldValues := reflect.ValueOf(old).Elem()
+	newValues := reflect.ValueOf(new).Elem()
+
+	changed := []string{}
+	for _, setting := range settings() {
+		if !reflect.DeepEqual(oldValues.Field(setting.index).Interface(), newValues.Field(setting.index).Interface()) {
+			changed = append(changed, setting.key)
+		}
+	}
+	return changed
+}
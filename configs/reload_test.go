@@ -0,0 +1,94 @@
+package configs
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestReloader(t *testing.T, file string) *Reloader {
+	t.Helper()
+
+	options := Options{File: file}
+	config, err := Load(options)
+	require.NoError(t, err)
+	return NewReloader(config, options, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestReloadAppliesValidConfiguration(t *testing.T) {
+	file := writeFile(t, "app.yaml", "jwt_secret: a-secret-of-at-least-thirty-two-bytes\njwt_expires_in: 300\n")
+	reloader := newTestReloader(t, file)
+	var applied *Conf
+	reloader.Subscribe(func(config *Conf) { applied = config })
+
+	require.NoError(t, os.WriteFile(file, []byte("jwt_secret: a-secret-of-at-least-thirty-two-bytes\njwt_expires_in: 60\n"), 0o600))
+	require.NoError(t, reloader.Reload())
+
+	assert.Equal(t, 60, reloader.Current().JWTExpiresIn)
+	assert.Same(t, reloader.Current(), applied)
+}
+
+func TestReloadKeepsPreviousConfigurationWhenInvalid(t *testing.T) {
+	file := writeFile(t, "app.yaml", "jwt_secret: a-secret-of-at-least-thirty-two-bytes\njwt_expires_in: 300\nlog_level: info\n")
+	reloader := newTestReloader(t, file)
+	previous := reloader.Current()
+	reloader.Subscribe(func(config *Conf) { t.Error("an invalid configuration was applied") })
+
+	require.NoError(t, os.WriteFile(file, []byte("jwt_secret: a-secret-of-at-least-thirty-two-bytes\njwt_expires_in: 60\nlog_level: loud\n"), 0o600))
+	err := reloader.Reload()
+
+	assert.ErrorContains(t, err, "LOG_LEVEL")
+	assert.Same(t, previous, reloader.Current())
+	assert.Equal(t, 300, reloader.Current().JWTExpiresIn, "valid settings are not applied alone")
+}
+
+func TestReloadKeepsSettingsNeedingARestart(t *testing.T) {
+	file := writeFile(t, "app.yaml", "jwt_secret: a-secret-of-at-least-thirty-two-bytes\nwebserver_port: 8001\njwt_expires_in: 300\n")
+	reloader := newTestReloader(t, file)
+	previous := reloader.Current()
+
+	require.NoError(t, os.WriteFile(file, []byte("jwt_secret: a-rotated-secret-of-at-least-32-bytes\nwebserver_port: 8002\njwt_expires_in: 60\n"), 0o600))
+	require.NoError(t, reloader.Reload())
+
+	config := reloader.Current()
+	assert.Equal(t, 60, config.JWTExpiresIn)
+	assert.Equal(t, "8001", config.WebServerPort, "the running port is reported")
+	assert.Equal(t, "a-secret-of-at-least-thirty-two-bytes", config.JWTSecret)
+	assert.Same(t, previous.TokenKeys, config.TokenKeys)
+}
+
+func TestWatchReloadsChangedFile(t *testing.T) {
+	file := writeFile(t, "app.yaml", "jwt_secret: a-secret-of-at-least-thirty-two-bytes\nmfa_rate_limit: 5\n")
+	reloader := newTestReloader(t, file)
+	var reloads atomic.Int32
+	reloader.Subscribe(func(config *Conf) { reloads.Add(1) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- reloader.Watch(ctx) }()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.NoError(c, os.WriteFile(file, []byte("jwt_secret: a-secret-of-at-least-thirty-two-bytes\nmfa_rate_limit: 7\n"), 0o600))
+		assert.Equal(c, 7, reloader.Current().MFARateLimit)
+	}, 5*time.Second, 200*time.Millisecond)
+	assert.Positive(t, reloads.Load())
+}
+
+func TestChangedKeys(t *testing.T) {
+	old := Defaults()
+	new := Defaults()
+	new.JWTSecret = "rotated"
+	new.LogLevel = "debug"
+
+	assert.Equal(t, []string{"JWT_SECRET", "LOG_LEVEL"}, changedKeys(&old, &new))
+}
@@ -0,0 +1,166 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/andre2ar/go-products/internal/infra/tracing"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// minSecretLength is the length JWT_SECRET needs to be as strong as the
+// 256-bit keys derived from it.
+const minSecretLength = 32
+
+// Validate reports every setting with a missing or out of range value, so
+// they can all be fixed at once.
+func (c *Conf) Validate() error {
+	var v validation
+
+	if c.WebServerSocket == "" {
+		v.port("WEBSERVER_PORT", c.WebServerPort)
+	}
+	v.atLeast("WEBSERVER_READ_TIMEOUT", c.WebServerReadTimeout, 1)
+	v.atLeast("WEBSERVER_READ_HEADER_TIMEOUT", c.WebServerReadHeaderTimeout, 1)
+	v.atLeast("WEBSERVER_WRITE_TIMEOUT", c.WebServerWriteTimeout, 1)
+	v.atLeast("WEBSERVER_IDLE_TIMEOUT", c.WebServerIdleTimeout, 1)
+	v.atLeast("WEBSERVER_MAX_HEADER_BYTES", c.WebServerMaxHeaderBytes, 1)
+	v.atLeast("WEBSERVER_MAX_BODY_BYTES", c.WebServerMaxBodyBytes, 1)
+	v.check((c.WebServerTLSCertFile == "") == (c.WebServerTLSKeyFile == ""), "WEBSERVER_TLS_KEY_FILE", "must be set along with WEBSERVER_TLS_CERT_FILE")
+	v.check(!c.WebServerH2C || c.WebServerTLSCertFile == "", "WEBSERVER_H2C", "must be false when TLS is enabled, which negotiates HTTP/2 itself")
+	for i, entry := range strings.Split(c.WebServerTrustedProxies, ",") {
+		entry = strings.TrimSpace(entry)
+		_, prefixErr := netip.ParsePrefix(entry)
+		_, addrErr := netip.ParseAddr(entry)
+		v.check(entry == "" || prefixErr == nil || addrErr == nil, "WEBSERVER_TRUSTED_PROXIES", "entry %d must be an IP address or CIDR range, got %q", i+1, entry)
+	}
+	for i, entry := range strings.Split(c.WebServerCORSOrigins, ",") {
+		entry = strings.TrimSpace(entry)
+		origin, err := url.Parse(entry)
+		isOrigin := err == nil && (origin.Scheme == "http" || origin.Scheme == "https") && origin.Host != "" &&
+			strings.TrimSuffix(origin.Path, "/") == "" && origin.RawQuery == "" && origin.Fragment == "" && origin.User == nil
+		v.check(entry == "" || entry == "*" || isOrigin, "WEBSERVER_CORS_ORIGINS", "entry %d must be an origin such as https://example.com or *, got %q", i+1, entry)
+	}
+	v.atLeast("DB_QUERY_TIMEOUT", c.DBQueryTimeout, 0)
+	v.url("DOCS_URL", c.DocsUrl)
+
+	v.required("JWT_SECRET", c.JWTSecret)
+	v.check(c.JWTSecret == "" || len(c.JWTSecret) >= minSecretLength, "JWT_SECRET", "must be at least %d bytes long, got %d", minSecretLength, len(c.JWTSecret))
+	v.atLeast("JWT_EXPIRES_IN", c.JWTExpiresIn, 1)
+	v.atLeast("JWT_KEY_OVERLAP", c.JWTKeyOverlap, 0)
+	v.required("JWT_ISSUER", c.JWTIssuer)
+	v.required("JWT_AUDIENCE", c.JWTAudience)
+	v.atLeast("JWT_CLOCK_SKEW", c.JWTClockSkew, 0)
+	for i, entry := range strings.Split(c.IntrospectionClients, ",") {
+		entry = strings.TrimSpace(entry)
+		id, secret, ok := strings.Cut(entry, ":")
+		v.check(entry == "" || ok && id != "" && secret != "", "INTROSPECTION_CLIENTS", "entry %d must be id:secret", i+1)
+	}
+
+	var level slog.Level
+	v.check(level.UnmarshalText([]byte(c.LogLevel)) == nil, "LOG_LEVEL", "must be debug, info, warn or error, got %q", c.LogLevel)
+	v.oneOf("LOG_FORMAT", strings.ToLower(c.LogFormat), "json", "text")
+
+	v.atLeast("SHUTDOWN_DRAIN_DELAY", c.ShutdownDrainDelay, 0)
+	v.atLeast("SHUTDOWN_TIMEOUT", c.ShutdownTimeout, 1)
+	v.check(c.ShutdownDrainDelay < c.ShutdownTimeout, "SHUTDOWN_DRAIN_DELAY", "must be shorter than SHUTDOWN_TIMEOUT")
+
+	v.oneOf("TRACING_EXPORTER", c.TracingExporter, tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout, tracing.ExporterFile)
+	if c.TracingExporter == tracing.ExporterFile {
+		v.required("TRACING_FILE", c.TracingFile)
+	}
+	v.required("TRACING_SERVICE_NAME", c.TracingServiceName)
+
+	if c.MetricsAddr != "" {
+		_, port, err := net.SplitHostPort(c.MetricsAddr)
+		v.check(err == nil, "METRICS_ADDR", "must be host:port, got %q", c.MetricsAddr)
+		if err == nil {
+			v.port("METRICS_ADDR", port)
+		}
+	}
+	v.check(c.TracingSampleRatio >= 0 && c.TracingSampleRatio <= 1, "TRACING_SAMPLE_RATIO", "must be between 0 and 1, got %v", c.TracingSampleRatio)
+
+	v.oneOf("MAIL_DRIVER", c.MailDriver, "file", "smtp", "memory")
+	_, err := mail.ParseAddress(c.MailFrom)
+	v.check(err == nil, "MAIL_FROM", "must be an email address, got %q", c.MailFrom)
+	v.atLeast("MAIL_QUEUE_SIZE", c.MailQueueSize, 1)
+	switch c.MailDriver {
+	case "file":
+		v.required("MAIL_DIR", c.MailDir)
+	case "smtp":
+		v.required("SMTP_HOST", c.SMTPHost)
+		v.port("SMTP_PORT", c.SMTPPort)
+	}
+
+	v.url("PASSWORD_RESET_URL", c.PasswordResetURL)
+	v.atLeast("PASSWORD_RESET_TTL", c.PasswordResetTTL, 1)
+	v.atLeast("PASSWORD_RESET_RATE_LIMIT", c.PasswordResetRateLimit, 1)
+
+	v.url("EMAIL_VERIFICATION_URL", c.EmailVerificationURL)
+	v.atLeast("EMAIL_VERIFICATION_TTL", c.EmailVerificationTTL, 1)
+	v.atLeast("EMAIL_VERIFICATION_RATE_LIMIT", c.EmailVerificationRateLimit, 1)
+
+	v.required("MFA_ISSUER", c.MFAIssuer)
+	v.atLeast("MFA_CHALLENGE_TTL", c.MFAChallengeTTL, 1)
+	v.atLeast("MFA_RATE_LIMIT", c.MFARateLimit, 1)
+
+	v.atLeast("LOGIN_FREE_ATTEMPTS", c.LoginFreeAttempts, 0)
+	v.atLeast("LOGIN_BASE_DELAY", c.LoginBaseDelay, 0)
+	v.atLeast("LOGIN_MAX_ATTEMPTS", c.LoginMaxAttempts, 1)
+	v.check(c.LoginFreeAttempts <= c.LoginMaxAttempts, "LOGIN_FREE_ATTEMPTS", "must not exceed LOGIN_MAX_ATTEMPTS")
+	v.atLeast("LOGIN_IP_MAX_ATTEMPTS", c.LoginIPMaxAttempts, 1)
+	v.atLeast("LOGIN_LOCKOUT", c.LoginLockout, 1)
+
+	v.atLeast("RATE_LIMIT_PRODUCTS_PER_MINUTE", c.RateLimitProductsPerMinute, 0)
+	v.atLeast("RATE_LIMIT_PRODUCTS_BURST", c.RateLimitProductsBurst, 0)
+	v.atLeast("RATE_LIMIT_USERS_PER_MINUTE", c.RateLimitUsersPerMinute, 0)
+	v.atLeast("RATE_LIMIT_USERS_BURST", c.RateLimitUsersBurst, 0)
+
+	if c.OIDCIssuer != "" {
+		v.url("OIDC_ISSUER", c.OIDCIssuer)
+		v.required("OIDC_CLIENT_ID", c.OIDCClientID)
+		v.url("OIDC_REDIRECT_URL", c.OIDCRedirectURL)
+		v.check(slices.Contains(strings.Fields(c.OIDCScopes), "openid"), "OIDC_SCOPES", "must include openid")
+		v.atLeast("OIDC_STATE_TTL", c.OIDCStateTTL, 1)
+	}
+
+	return errors.Join(v...)
+}
+
+// validation collects the problems found in a configuration, each one
+// prefixed with the key of its setting.
+type validation []error
+
+func (v *validation) check(ok bool, key, format string, args ...any) {
+	if !ok {
+		*v = append(*v, fmt.Errorf("%s %s", key, fmt.Sprintf(format, args...)))
+	}
+}
+
+func (v *validation) required(key, value string) {
+	v.check(strings.TrimSpace(value) != "", key, "is required")
+}
+
+func (v *validation) atLeast(key string, value, min int) {
+	v.check(value >= min, key, "must be at least %d, got %d", min, value)
+}
+
+func (v *validation) oneOf(key, value string, allowed ...string) {
+	v.check(slices.Contains(allowed, value), key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+func (v *validation) port(key, value string) {
+	port, err := strconv.Atoi(value)
+	v.check(err == nil && port > 0 && port <= 65535, key, "must be a port between 1 and 65535, got %q", value)
+}
+
+func (v *validation) url(key, value string) {
+	parsed, err := url.Parse(value)
+	v.check(err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "", key, "must be an absolute http or https URL, got %q", value)
+}
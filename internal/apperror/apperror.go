@@ -0,0 +1,154 @@
+package apperror
+
+import (
+	"errors"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/pkg/validator"
+	"net/http"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an application error carrying everything needed to answer a
+// client: an HTTP status, a stable machine-readable code and a message safe
+// to expose. The wrapped Err is kept for logging only and never rendered.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+var (
+	ErrInvalidBody                   = &Error{Status: http.StatusBadRequest, Code: "invalid_body", Message: "request body is malformed"}
+	ErrValidation                    = &Error{Status: http.StatusBadRequest, Code: "validation_failed", Message: "request failed validation"}
+	ErrUnauthorized                  = &Error{Status: http.StatusUnauthorized, Code: "unauthorized", Message: "authentication is required"}
+	ErrInvalidCredentials            = &Error{Status: http.StatusUnauthorized, Code: "invalid_credentials", Message: "invalid credentials"}
+	ErrInvalidMFAToken               = &Error{Status: http.StatusUnauthorized, Code: "invalid_mfa_token", Message: "two-factor authentication challenge is invalid or expired"}
+	ErrInvalidMFACode                = &Error{Status: http.StatusUnauthorized, Code: "invalid_mfa_code", Message: "two-factor authentication code is invalid"}
+	ErrOIDCLoginFailed               = &Error{Status: http.StatusUnauthorized, Code: "oidc_login_failed", Message: "login with the identity provider failed"}
+	ErrForbidden                     = &Error{Status: http.StatusForbidden, Code: "forbidden", Message: "access to this resource is forbidden"}
+	ErrInsufficientScope             = &Error{Status: http.StatusForbidden, Code: "insufficient_scope", Message: "api key lacks the scope required by this resource"}
+	ErrAccountSuspended              = &Error{Status: http.StatusForbidden, Code: "account_suspended", Message: "account is suspended"}
+	ErrPasswordResetRequired         = &Error{Status: http.StatusForbidden, Code: "password_reset_required", Message: "password must be reset before logging in"}
+	ErrEmailNotVerified              = &Error{Status: http.StatusForbidden, Code: "email_not_verified", Message: "email must be verified before logging in"}
+	ErrOIDCEmailNotVerified          = &Error{Status: http.StatusForbidden, Code: "oidc_email_not_verified", Message: "the identity provider did not verify the account email"}
+	ErrNotFound                      = &Error{Status: http.StatusNotFound, Code: "not_found", Message: "resource not found"}
+	ErrUserNotFound                  = &Error{Status: http.StatusNotFound, Code: "user_not_found", Message: "user not found"}
+	ErrProductNotFound               = &Error{Status: http.StatusNotFound, Code: "product_not_found", Message: "product not found"}
+	ErrAPIKeyNotFound                = &Error{Status: http.StatusNotFound, Code: "api_key_not_found", Message: "api key not found"}
+	ErrMethodNotAllowed              = &Error{Status: http.StatusMethodNotAllowed, Code: "method_not_allowed", Message: "method not allowed"}
+	ErrConflict                      = &Error{Status: http.StatusConflict, Code: "conflict", Message: "resource already exists"}
+	ErrEmailAlreadyInUse             = &Error{Status: http.StatusConflict, Code: "email_already_in_use", Message: "email is already in use"}
+	ErrMFAAlreadyEnabled             = &Error{Status: http.StatusConflict, Code: "mfa_already_enabled", Message: "two-factor authentication is already enabled"}
+	ErrMFANotEnrolled                = &Error{Status: http.StatusBadRequest, Code: "mfa_not_enrolled", Message: "two-factor authentication enrollment was not started"}
+	ErrInvalidPasswordResetToken     = &Error{Status: http.StatusBadRequest, Code: "invalid_password_reset_token", Message: "password reset token is invalid or expired"}
+	ErrInvalidEmailVerificationToken = &Error{Status: http.StatusBadRequest, Code: "invalid_email_verification_token", Message: "email verification token is invalid or expired"}
+	ErrBodyTooLarge                  = &Error{Status: http.StatusRequestEntityTooLarge, Code: "body_too_large", Message: "request body is too large"}
+	ErrTooManyRequests               = &Error{Status: http.StatusTooManyRequests, Code: "too_many_requests", Message: "too many requests, retry later"}
+	ErrIdentityProviderUnavailable   = &Error{Status: http.StatusBadGateway, Code: "identity_provider_unavailable", Message: "the identity provider is unavailable"}
+	ErrInternal                      = &Error{Status: http.StatusInternalServerError, Code: "internal_error", Message: "an unexpected error occurred"}
+)
+
+var domainErrors = []struct {
+	err    error
+	appErr *Error
+}{
+	{entity.ErrEmailAlreadyInUse, ErrEmailAlreadyInUse},
+	{entity.ErrInvalidPasswordResetToken, ErrInvalidPasswordResetToken},
+	{entity.ErrInvalidEmailVerificationToken, ErrInvalidEmailVerificationToken},
+	{entity.ErrInvalidMFACode, ErrInvalidMFACode},
+	{entity.ErrMFANotEnrolled, ErrMFANotEnrolled},
+	{entity.ErrMFAAlreadyEnabled, ErrMFAAlreadyEnabled},
+}
+
+var domainFieldErrors = []struct {
+	err   error
+	field FieldError
+}{
+	{entity.ErrIDIsRequired, FieldError{Field: "id", Code: "required", Message: entity.ErrIDIsRequired.Error()}},
+	{entity.ErrInvalidID, FieldError{Field: "id", Code: "invalid", Message: entity.ErrInvalidID.Error()}},
+	{entity.ErrNameIsRequired, FieldError{Field: "name", Code: "required", Message: entity.ErrNameIsRequired.Error()}},
+	{entity.ErrPriceIsRequired, FieldError{Field: "price", Code: "required", Message: entity.ErrPriceIsRequired.Error()}},
+	{entity.ErrInvalidPrice, FieldError{Field: "price", Code: "invalid", Message: entity.ErrInvalidPrice.Error()}},
+	{entity.ErrInvalidAPIKeyScope, FieldError{Field: "scopes", Code: "invalid", Message: entity.ErrInvalidAPIKeyScope.Error()}},
+	{entity.ErrInvalidAPIKeyExpiry, FieldError{Field: "expires_at", Code: "invalid", Message: entity.ErrInvalidAPIKeyExpiry.Error()}},
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Message + ": " + e.Err.Error()
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is match any *Error sharing the target's code, so wrapped
+// copies of the sentinels above still compare equal to them.
+func (e *Error) Is(target error) bool {
+	var t *Error
+	if !errors.As(target, &t) {
+		return false
+	}
+	return e.Code == t.Code
+}
+
+// Wrap returns a copy of e recording err as its internal cause.
+func (e *Error) Wrap(err error) *Error {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+// Validation returns a validation error listing every offending field.
+func Validation(fields ...FieldError) *Error {
+	err := *ErrValidation
+	err.Fields = fields
+	return &err
+}
+
+// From converts err into an *Error: application errors are returned as is,
+// known domain errors get their matching code, validator and domain
+// validation errors become validation errors and anything else is treated as
+// an internal error.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	var validationErrs validator.Errors
+	if errors.As(err, &validationErrs) {
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			fields = append(fields, FieldError{Field: fieldErr.Field, Code: fieldErr.Code, Message: fieldErr.Message})
+		}
+		validationErr := Validation(fields...)
+		validationErr.Err = err
+		return validationErr
+	}
+
+	for _, domainErr := range domainErrors {
+		if errors.Is(err, domainErr.err) {
+			return domainErr.appErr.Wrap(err)
+		}
+	}
+
+	for _, domainErr := range domainFieldErrors {
+		if errors.Is(err, domainErr.err) {
+			validationErr := Validation(domainErr.field)
+			validationErr.Err = err
+			return validationErr
+		}
+	}
+
+	return ErrInternal.Wrap(err)
+}
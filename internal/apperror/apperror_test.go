@@ -0,0 +1,37 @@
+package apperror
+
+import (
+	"errors"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestFromMapsDomainErrorsToValidationErrors(t *testing.T) {
+	err := From(entity.ErrNameIsRequired)
+
+	assert.Equal(t, http.StatusBadRequest, err.Status)
+	assert.Equal(t, "validation_failed", err.Code)
+	assert.Equal(t, []FieldError{{Field: "name", Code: "required", Message: "name is required"}}, err.Fields)
+	assert.ErrorIs(t, err, entity.ErrNameIsRequired)
+}
+
+func TestFromHidesUnknownErrors(t *testing.T) {
+	cause := errors.New("UNIQUE constraint failed: users.email")
+	err := From(cause)
+
+	assert.Equal(t, http.StatusInternalServerError, err.Status)
+	assert.Equal(t, "internal_error", err.Code)
+	assert.NotContains(t, err.Message, "UNIQUE")
+	assert.ErrorIs(t, err, cause)
+}
+
+func TestWrappedErrorsMatchTheirSentinel(t *testing.T) {
+	err := ErrInvalidBody.Wrap(errors.New("unexpected EOF"))
+
+	assert.ErrorIs(t, err, ErrInvalidBody)
+	assert.NotErrorIs(t, err, ErrValidation)
+	assert.Nil(t, ErrInvalidBody.Err)
+	assert.Equal(t, err, From(err))
+}
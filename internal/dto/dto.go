@@ -1,21 +1,106 @@
 package dto
 
+import (
+	"github.com/andre2ar/go-products/internal/entity"
+	"time"
+)
+
 type CreateProductInput struct {
-	Name  string  `json:"name"`
-	Price float64 `json:"price"`
+	Name  string  `json:"name" validate:"required,max=255"`
+	Price float64 `json:"price" validate:"required,gt=0,max=1000000"`
 }
 
 type CreateUserInput struct {
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Name     string `json:"name" validate:"required,max=100"`
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required,password"`
+}
+
+type UpdateUserInput struct {
+	Name  *string `json:"name" validate:"min=1,notblank,max=100"`
+	Email *string `json:"email" validate:"email,max=254"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" validate:"required,max=72"`
+	NewPassword     string `json:"new_password" validate:"required,password"`
+}
+
+type DeleteUserInput struct {
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+type PasswordResetRequestInput struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+}
+
+type PasswordResetInput struct {
+	Password string `json:"password" validate:"required,password"`
+}
+
+type EmailVerificationRequestInput struct {
+	Email string `json:"email" validate:"required,email,max=254"`
 }
 
 type LoginCredentialsInput struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,max=254"`
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+type CreateAPIKeyInput struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKeyResponse holds a new API key. Key is only ever returned here.
+type CreateAPIKeyResponse struct {
+	APIKey *entity.APIKey `json:"api_key"`
+	Key    string         `json:"key"`
 }
 
 type AuthResponse struct {
 	AccessToken string `json:"access_token"`
 }
+
+// IntrospectionResponse is an RFC 7662 token introspection response. Only
+// Active is set for inactive tokens.
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	TokenType string   `json:"token_type,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	TokenID   string   `json:"jti,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+}
+
+type MFAChallengeResponse struct {
+	MFAToken  string `json:"mfa_token"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+type MFASessionInput struct {
+	MFAToken string `json:"mfa_token" validate:"required,max=512"`
+	Code     string `json:"code" validate:"required,max=32"`
+}
+
+type MFACodeInput struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type DisableMFAInput struct {
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+type MFAEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
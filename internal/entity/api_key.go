@@ -0,0 +1,135 @@
+package entity
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"github.com/andre2ar/go-products/pkg/entity"
+	"github.com/andre2ar/go-products/pkg/securetoken"
+	"strings"
+	"time"
+)
+
+const (
+	// APIKeyPrefix starts every API key, telling them apart from access
+	// tokens and making leaked keys easy to scan for.
+	APIKeyPrefix = "gpk_"
+
+	ScopeProductsRead  = "products:read"
+	ScopeProductsWrite = "products:write"
+)
+
+// APIKeyScopes lists every scope an API key can be granted.
+var APIKeyScopes = []string{ScopeProductsRead, ScopeProductsWrite}
+
+var (
+	ErrInvalidAPIKeyScope  = errors.New("scopes must list one or more of " + strings.Join(APIKeyScopes, ", "))
+	ErrInvalidAPIKeyExpiry = errors.New("expires_at must be in the future")
+)
+
+// APIKey lets a user's scripts and integrations call the API without a
+// password. Keys are made of a public Prefix, used to look them up and to
+// identify them in listings, and a secret of which only the hash is stored.
+type APIKey struct {
+	ID         entity.ID  `json:"id"`
+	UserID     entity.ID  `json:"user_id" gorm:"index"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix" gorm:"uniqueIndex"`
+	SecretHash string     `json:"-"`
+	Scopes     []string   `json:"scopes" gorm:"serializer:json"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// NewAPIKey creates a key for userID granting scopes until expiresAt, or
+// forever when nil, and returns it along with the plain key to show the user
+// once.
+func NewAPIKey(userID entity.ID, name string, scopes []string, expiresAt *time.Time) (*APIKey, string, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, "", ErrNameIsRequired
+	}
+	if len(scopes) == 0 {
+		return nil, "", ErrInvalidAPIKeyScope
+	}
+	for _, scope := range scopes {
+		if !isAPIKeyScope(scope) {
+			return nil, "", ErrInvalidAPIKeyScope
+		}
+	}
+
+	now := time.Now()
+	if expiresAt != nil && !expiresAt.After(now) {
+		return nil, "", ErrInvalidAPIKeyExpiry
+	}
+
+	lookup := make([]byte, 6)
+	if _, err := rand.Read(lookup); err != nil {
+		return nil, "", err
+	}
+	secret, err := securetoken.Generate()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &APIKey{
+		ID:         entity.NewID(),
+		UserID:     userID,
+		Name:       name,
+		Prefix:     APIKeyPrefix + hex.EncodeToString(lookup),
+		SecretHash: securetoken.Hash(secret),
+		Scopes:     scopes,
+		ExpiresAt:  expiresAt,
+		CreatedAt:  now,
+	}
+
+	return key, key.Prefix + "_" + secret, nil
+}
+
+// ParseAPIKey splits a plain key into the prefix it is looked up by and its
+// secret.
+func ParseAPIKey(key string) (prefix, secret string, ok bool) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return "", "", false
+	}
+	lookup, secret, ok := strings.Cut(strings.TrimPrefix(key, APIKeyPrefix), "_")
+	if !ok || lookup == "" || secret == "" {
+		return "", "", false
+	}
+	return APIKeyPrefix + lookup, secret, true
+}
+
+// MatchesSecret compares secret with the stored hash in constant time.
+func (k *APIKey) MatchesSecret(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(securetoken.Hash(secret)), []byte(k.SecretHash)) == 1
+}
+
+func (k *APIKey) IsUsable(at time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || at.Before(*k.ExpiresAt))
+}
+
+// RevokedWith reports whether the key was created by the time the sessions
+// of user were last revoked, which revokes it too.
+func (k *APIKey) RevokedWith(user *User) bool {
+	return user.SessionsRevokedAt != nil && !k.CreatedAt.After(*user.SessionsRevokedAt)
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func isAPIKeyScope(scope string) bool {
+	for _, known := range APIKeyScopes {
+		if known == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package entity
+
+import (
+	"github.com/andre2ar/go-products/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	userID := entity.NewID()
+	key, plain, err := NewAPIKey(userID, "CI", []string{ScopeProductsRead}, nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, userID, key.UserID)
+	assert.True(t, strings.HasPrefix(plain, key.Prefix+"_"))
+	assert.NotContains(t, key.SecretHash, strings.TrimPrefix(plain, key.Prefix+"_"))
+
+	prefix, secret, ok := ParseAPIKey(plain)
+	assert.True(t, ok)
+	assert.Equal(t, key.Prefix, prefix)
+	assert.True(t, key.MatchesSecret(secret))
+	assert.False(t, key.MatchesSecret(secret+"x"))
+
+	assert.True(t, key.HasScope(ScopeProductsRead))
+	assert.False(t, key.HasScope(ScopeProductsWrite))
+	assert.True(t, key.IsUsable(time.Now()))
+}
+
+func TestNewAPIKeyValidation(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+
+	_, _, err := NewAPIKey(entity.NewID(), " ", []string{ScopeProductsRead}, nil)
+	assert.Equal(t, ErrNameIsRequired, err)
+	_, _, err = NewAPIKey(entity.NewID(), "CI", nil, nil)
+	assert.Equal(t, ErrInvalidAPIKeyScope, err)
+	_, _, err = NewAPIKey(entity.NewID(), "CI", []string{"users:write"}, nil)
+	assert.Equal(t, ErrInvalidAPIKeyScope, err)
+	_, _, err = NewAPIKey(entity.NewID(), "CI", []string{ScopeProductsRead}, &past)
+	assert.Equal(t, ErrInvalidAPIKeyExpiry, err)
+}
+
+func TestAPIKeyExpiresAndIsRevocable(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+	key, _, err := NewAPIKey(entity.NewID(), "CI", []string{ScopeProductsRead}, &expiresAt)
+	assert.Nil(t, err)
+
+	assert.True(t, key.IsUsable(time.Now()))
+	assert.False(t, key.IsUsable(expiresAt))
+
+	revokedAt := time.Now()
+	key.RevokedAt = &revokedAt
+	assert.False(t, key.IsUsable(time.Now()))
+}
+
+func TestAPIKeysAreRevokedWithSessions(t *testing.T) {
+	user, err := NewUser("John Doe", "j@j.com", "123456")
+	assert.Nil(t, err)
+	key, _, err := NewAPIKey(user.ID, "CI", []string{ScopeProductsRead}, nil)
+	assert.Nil(t, err)
+	assert.False(t, key.RevokedWith(user))
+
+	user.RequirePasswordReset()
+	assert.True(t, key.RevokedWith(user))
+
+	later, _, err := NewAPIKey(user.ID, "CI", []string{ScopeProductsRead}, nil)
+	assert.Nil(t, err)
+	later.CreatedAt = user.SessionsRevokedAt.Add(time.Second)
+	assert.False(t, later.RevokedWith(user))
+}
+
+func TestParseAPIKeyRejectsOtherTokens(t *testing.T) {
+	for _, token := range []string{"", "eyJhbGciOiJIUzI1NiJ9.e30.sig", "gpk_", "gpk_abc", "gpk_abc_"} {
+		_, _, ok := ParseAPIKey(token)
+		assert.False(t, ok, token)
+	}
+}
@@ -0,0 +1,33 @@
+package entity
+
+import (
+	"github.com/andre2ar/go-products/pkg/entity"
+	"time"
+)
+
+const (
+	AuditLoginAccountLockout = "login.account_lockout"
+	AuditLoginIPLockout      = "login.ip_lockout"
+	AuditOIDCIdentityLinked  = "oidc.identity_linked"
+)
+
+// AuditEvent records a security relevant event for later review.
+type AuditEvent struct {
+	ID        entity.ID `json:"id"`
+	Type      string    `json:"type" gorm:"index"`
+	Email     string    `json:"email,omitempty" gorm:"index"`
+	IP        string    `json:"ip,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+func NewAuditEvent(eventType, email, ip, detail string) *AuditEvent {
+	return &AuditEvent{
+		ID:        entity.NewID(),
+		Type:      eventType,
+		Email:     email,
+		IP:        ip,
+		Detail:    detail,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,70 @@
+package entity
+
+import (
+	"github.com/andre2ar/go-products/pkg/entity"
+	"github.com/andre2ar/go-products/pkg/securetoken"
+	"strings"
+	"time"
+)
+
+// ExternalIdentity links a user to its account at an OpenID Connect
+// provider, identified by the provider's issuer and the account's subject.
+type ExternalIdentity struct {
+	ID        entity.ID `json:"id"`
+	UserID    entity.ID `json:"user_id" gorm:"index"`
+	Issuer    string    `json:"issuer" gorm:"uniqueIndex:idx_external_identities_subject"`
+	Subject   string    `json:"subject" gorm:"uniqueIndex:idx_external_identities_subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewExternalIdentity(userID entity.ID, issuer, subject, email string) *ExternalIdentity {
+	return &ExternalIdentity{
+		ID:        entity.NewID(),
+		UserID:    userID,
+		Issuer:    issuer,
+		Subject:   subject,
+		Email:     NormalizeEmail(email),
+		CreatedAt: time.Now(),
+	}
+}
+
+// NewExternalUser creates a user registered through an identity provider
+// that verified email at verifiedAt. Its password is random, so it can only
+// log in through the provider until it resets it.
+func NewExternalUser(name, email string, verifiedAt time.Time) (*User, error) {
+	password, err := securetoken.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(name) == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+
+	user, err := NewUser(name, email, password)
+	if err != nil {
+		return nil, err
+	}
+	user.VerifyEmail(verifiedAt)
+
+	return user, nil
+}
+
+// Claim hands a user registered with an email nobody proved to own over to
+// the owner, verified by an identity provider at verifiedAt. Whoever
+// registered it could have squatted the email, so the password and MFA they
+// set are replaced and their sessions revoked.
+func (u *User) Claim(verifiedAt time.Time) error {
+	password, err := securetoken.Generate()
+	if err != nil {
+		return err
+	}
+	if err := u.ChangePassword(password); err != nil {
+		return err
+	}
+
+	u.DisableMFA()
+	u.VerifyEmail(verifiedAt)
+	return nil
+}
@@ -0,0 +1,29 @@
+package entity
+
+import (
+	"github.com/andre2ar/go-products/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewExternalIdentity(t *testing.T) {
+	userID := entity.NewID()
+	identity := NewExternalIdentity(userID, "https://idp.example.com", "user-1", " J@J.com")
+
+	assert.Equal(t, userID, identity.UserID)
+	assert.Equal(t, "https://idp.example.com", identity.Issuer)
+	assert.Equal(t, "user-1", identity.Subject)
+	assert.Equal(t, "j@j.com", identity.Email)
+}
+
+func TestNewExternalUser(t *testing.T) {
+	user, err := NewExternalUser("", "J@J.com", time.Now())
+
+	assert.Nil(t, err)
+	assert.Equal(t, "J", user.Name)
+	assert.Equal(t, "j@j.com", user.Email)
+	assert.True(t, user.IsEmailVerified())
+	assert.NotEmpty(t, user.Password)
+	assert.False(t, user.ValidatePassword(""))
+}
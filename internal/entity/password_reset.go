@@ -0,0 +1,45 @@
+package entity
+
+import (
+	"errors"
+	"github.com/andre2ar/go-products/pkg/entity"
+	"github.com/andre2ar/go-products/pkg/securetoken"
+	"time"
+)
+
+var ErrInvalidPasswordResetToken = errors.New("invalid or expired password reset token")
+
+// PasswordReset is a single-use permission to set a user's password. Only
+// the hash of its token is stored.
+type PasswordReset struct {
+	ID        entity.ID  `json:"id"`
+	UserID    entity.ID  `json:"user_id" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// NewPasswordReset creates a reset for userID valid for ttl and returns it
+// along with the plain token to hand to the user.
+func NewPasswordReset(userID entity.ID, ttl time.Duration) (*PasswordReset, string, error) {
+	token, err := securetoken.Generate()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	reset := &PasswordReset{
+		ID:        entity.NewID(),
+		UserID:    userID,
+		TokenHash: securetoken.Hash(token),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+
+	return reset, token, nil
+}
+
+func (p *PasswordReset) IsUsable(at time.Time) bool {
+	return p.UsedAt == nil && at.Before(p.ExpiresAt)
+}
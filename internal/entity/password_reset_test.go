@@ -0,0 +1,32 @@
+package entity
+
+import (
+	"github.com/andre2ar/go-products/pkg/entity"
+	"github.com/andre2ar/go-products/pkg/securetoken"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewPasswordReset(t *testing.T) {
+	userID := entity.NewID()
+	reset, token, err := NewPasswordReset(userID, time.Hour)
+
+	assert.Nil(t, err)
+	assert.NotEmpty(t, token)
+	assert.Equal(t, userID, reset.UserID)
+	assert.Equal(t, securetoken.Hash(token), reset.TokenHash)
+	assert.NotEqual(t, token, reset.TokenHash)
+	assert.True(t, reset.IsUsable(time.Now()))
+}
+
+func TestPasswordResetExpiresAndIsSingleUse(t *testing.T) {
+	reset, _, err := NewPasswordReset(entity.NewID(), time.Hour)
+	assert.Nil(t, err)
+
+	assert.False(t, reset.IsUsable(time.Now().Add(2*time.Hour)))
+
+	usedAt := time.Now()
+	reset.UsedAt = &usedAt
+	assert.False(t, reset.IsUsable(time.Now()))
+}
@@ -0,0 +1,62 @@
+package entity
+
+import (
+	"crypto/rand"
+	"github.com/andre2ar/go-products/pkg/entity"
+	"github.com/andre2ar/go-products/pkg/securetoken"
+	"strings"
+	"time"
+)
+
+const (
+	RecoveryCodeCount = 10
+
+	recoveryCodeAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+	recoveryCodeLength   = 10
+)
+
+// RecoveryCode is a single-use replacement for a TOTP code, for users who
+// lost their authenticator. Only the hash of the code is stored.
+type RecoveryCode struct {
+	ID        entity.ID  `json:"id"`
+	UserID    entity.ID  `json:"user_id" gorm:"index"`
+	CodeHash  string     `json:"-" gorm:"uniqueIndex"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// NewRecoveryCodes creates RecoveryCodeCount codes for userID and returns
+// them along with the plain codes to show the user once.
+func NewRecoveryCodes(userID entity.ID) ([]RecoveryCode, []string, error) {
+	now := time.Now()
+	codes := make([]RecoveryCode, 0, RecoveryCodeCount)
+	plain := make([]string, 0, RecoveryCodeCount)
+
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		for j := range b {
+			b[j] = recoveryCodeAlphabet[int(b[j])%len(recoveryCodeAlphabet)]
+		}
+		code := string(b[:recoveryCodeLength/2]) + "-" + string(b[recoveryCodeLength/2:])
+
+		codes = append(codes, RecoveryCode{
+			ID:        entity.NewID(),
+			UserID:    userID,
+			CodeHash:  HashRecoveryCode(code),
+			CreatedAt: now,
+		})
+		plain = append(plain, code)
+	}
+
+	return codes, plain, nil
+}
+
+// HashRecoveryCode returns the hash code is stored and looked up by,
+// ignoring case, spaces and dashes users may type differently.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return securetoken.Hash(code)
+}
@@ -0,0 +1,29 @@
+package entity
+
+import (
+	"github.com/andre2ar/go-products/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewRecoveryCodes(t *testing.T) {
+	userID := entity.NewID()
+	codes, plain, err := NewRecoveryCodes(userID)
+	assert.Nil(t, err)
+	assert.Len(t, codes, RecoveryCodeCount)
+	assert.Len(t, plain, RecoveryCodeCount)
+
+	seen := map[string]bool{}
+	for i, code := range codes {
+		assert.Equal(t, userID, code.UserID)
+		assert.Regexp(t, `^[a-z2-9]{5}-[a-z2-9]{5}$`, plain[i])
+		assert.Equal(t, HashRecoveryCode(plain[i]), code.CodeHash)
+		assert.NotContains(t, seen, code.CodeHash)
+		seen[code.CodeHash] = true
+	}
+}
+
+func TestHashRecoveryCodeIgnoresFormatting(t *testing.T) {
+	assert.Equal(t, HashRecoveryCode("abcde-fghij"), HashRecoveryCode(" ABCDE fghij"))
+	assert.NotEqual(t, HashRecoveryCode("abcde-fghij"), HashRecoveryCode("abcde-fghik"))
+}
@@ -1,15 +1,55 @@
 package entity
 
 import (
+	"errors"
 	"github.com/andre2ar/go-products/pkg/entity"
+	"github.com/andre2ar/go-products/pkg/totp"
 	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"sync"
+	"time"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var (
+	ErrEmailAlreadyInUse             = errors.New("email already in use")
+	ErrInvalidEmailVerificationToken = errors.New("invalid email verification token")
+	ErrMFAAlreadyEnabled             = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnrolled                = errors.New("two-factor authentication enrollment was not started")
+	ErrInvalidMFACode                = errors.New("invalid two-factor authentication code")
+)
+
+// mfaSkew is how many TOTP steps before and after the current one are
+// accepted, tolerating clock drift between server and authenticator.
+const mfaSkew = 1
+
+// dummyPasswordHash is compared against when a login matches no user, so
+// unknown emails take as long to reject as wrong passwords.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
+
 type User struct {
-	ID       entity.ID `json:"id"`
-	Name     string    `json:"name"`
-	Email    string    `json:"email"`
-	Password string    `json:"-"`
+	ID                    entity.ID  `json:"id"`
+	Name                  string     `json:"name"`
+	Email                 string     `json:"email" gorm:"uniqueIndex"`
+	Password              string     `json:"-"`
+	Role                  string     `json:"role" gorm:"not null;default:user"`
+	SuspendedAt           *time.Time `json:"suspended_at,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	EmailVerifiedAt       *time.Time `json:"email_verified_at,omitempty"`
+	MFAEnabledAt          *time.Time `json:"mfa_enabled_at,omitempty"`
+	MFASecret             string     `json:"-"`
+	MFALastStep           int64      `json:"-"`
+	SessionVersion        int        `json:"-"`
+	// SessionsRevokedAt is when SessionVersion was last bumped. API keys
+	// created until then are revoked along with the sessions.
+	SessionsRevokedAt *time.Time `json:"-"`
 }
 
 func NewUser(name, email, password string) (*User, error) {
@@ -20,9 +60,10 @@ func NewUser(name, email, password string) (*User, error) {
 
 	user := &User{
 		ID:       entity.NewID(),
-		Name:     name,
-		Email:    email,
+		Name:     strings.TrimSpace(name),
+		Email:    NormalizeEmail(email),
 		Password: string(hash),
+		Role:     RoleUser,
 	}
 
 	return user, nil
@@ -32,3 +73,142 @@ func (u *User) ValidatePassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	return err == nil
 }
+
+// ChangePassword replaces the password hash and bumps SessionVersion so
+// tokens and API keys issued before the change stop being accepted.
+func (u *User) ChangePassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	u.Password = string(hash)
+	u.PasswordResetRequired = false
+	u.revokeSessions(time.Now())
+	return nil
+}
+
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+func (u *User) IsSuspended() bool {
+	return u.SuspendedAt != nil
+}
+
+// Suspend blocks the user from logging in and revokes its sessions.
+func (u *User) Suspend(at time.Time) {
+	u.SuspendedAt = &at
+	u.revokeSessions(at)
+}
+
+func (u *User) Reactivate() {
+	u.SuspendedAt = nil
+}
+
+// RequirePasswordReset revokes the user's sessions and blocks new ones until
+// the password is changed.
+func (u *User) RequirePasswordReset() {
+	u.PasswordResetRequired = true
+	u.revokeSessions(time.Now())
+}
+
+// revokeSessions stops accepting the tokens and API keys issued until at.
+func (u *User) revokeSessions(at time.Time) {
+	u.SessionVersion++
+	u.SessionsRevokedAt = &at
+}
+
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+func (u *User) VerifyEmail(at time.Time) {
+	u.EmailVerifiedAt = &at
+}
+
+// ChangeEmail replaces the email and reports whether it actually changed, in
+// which case the new address is no longer verified.
+func (u *User) ChangeEmail(email string) bool {
+	email = NormalizeEmail(email)
+	if email == u.Email {
+		return false
+	}
+
+	u.Email = email
+	u.EmailVerifiedAt = nil
+	return true
+}
+
+func (u *User) IsMFAEnabled() bool {
+	return u.MFAEnabledAt != nil
+}
+
+// StartMFAEnrollment generates a new TOTP secret for the user, replacing any
+// pending enrollment. MFA stays disabled until ConfirmMFA succeeds.
+func (u *User) StartMFAEnrollment() (string, error) {
+	if u.IsMFAEnabled() {
+		return "", ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+
+	u.MFASecret = secret
+	u.MFALastStep = 0
+	return secret, nil
+}
+
+// ConfirmMFA enables MFA once code proves the authenticator holds the secret
+// of the pending enrollment.
+func (u *User) ConfirmMFA(code string, at time.Time) error {
+	if u.IsMFAEnabled() {
+		return ErrMFAAlreadyEnabled
+	}
+	if u.MFASecret == "" {
+		return ErrMFANotEnrolled
+	}
+	if !u.ValidateMFACode(code, at) {
+		return ErrInvalidMFACode
+	}
+
+	u.MFAEnabledAt = &at
+	return nil
+}
+
+// ValidateMFACode reports whether code is a current TOTP code of the user.
+// Each code is accepted once: steps up to the last accepted one are refused.
+func (u *User) ValidateMFACode(code string, at time.Time) bool {
+	if u.MFASecret == "" {
+		return false
+	}
+
+	step, ok := totp.Validate(u.MFASecret, code, at, mfaSkew)
+	if !ok || step <= u.MFALastStep {
+		return false
+	}
+
+	u.MFALastStep = step
+	return true
+}
+
+func (u *User) DisableMFA() {
+	u.MFAEnabledAt = nil
+	u.MFASecret = ""
+	u.MFALastStep = 0
+}
+
+// NormalizeEmail returns the canonical form emails are stored and looked up
+// by, making them unique regardless of case.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// RejectPassword spends the same time as ValidatePassword on a user that
+// does not exist and always fails.
+func RejectPassword(password string) bool {
+	bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+	return false
+}
@@ -1,8 +1,10 @@
 package entity
 
 import (
+	"github.com/andre2ar/go-products/pkg/totp"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestNewUser(t *testing.T) {
@@ -23,3 +25,95 @@ func TestUser_IsValidatePassword(t *testing.T) {
 	assert.False(t, user.ValidatePassword("1234567"))
 	assert.NotEqual(t, "123456", user.Password)
 }
+
+func TestNewUserNormalizesEmail(t *testing.T) {
+	user, err := NewUser("John Doe", "  J@J.Com ", "123456")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "j@j.com", user.Email)
+}
+
+func TestRejectPassword(t *testing.T) {
+	assert.False(t, RejectPassword("123456"))
+}
+
+func TestUser_ChangePassword(t *testing.T) {
+	user, err := NewUser("John Doe", "j@j.com", "123456")
+	assert.Nil(t, err)
+
+	assert.Nil(t, user.ChangePassword("654321"))
+	assert.True(t, user.ValidatePassword("654321"))
+	assert.False(t, user.ValidatePassword("123456"))
+	assert.Equal(t, 1, user.SessionVersion)
+}
+
+func TestUser_SuspendAndReactivate(t *testing.T) {
+	user, err := NewUser("John Doe", "j@j.com", "123456")
+	assert.Nil(t, err)
+	assert.Equal(t, RoleUser, user.Role)
+	assert.False(t, user.IsSuspended())
+
+	user.Suspend(time.Now())
+	assert.True(t, user.IsSuspended())
+	assert.Equal(t, 1, user.SessionVersion)
+
+	user.Reactivate()
+	assert.False(t, user.IsSuspended())
+}
+
+func TestUser_RequirePasswordReset(t *testing.T) {
+	user, err := NewUser("John Doe", "j@j.com", "123456")
+	assert.Nil(t, err)
+
+	user.RequirePasswordReset()
+	assert.True(t, user.PasswordResetRequired)
+	assert.Equal(t, 1, user.SessionVersion)
+
+	assert.Nil(t, user.ChangePassword("654321"))
+	assert.False(t, user.PasswordResetRequired)
+}
+
+func TestUser_VerifyAndChangeEmail(t *testing.T) {
+	user, err := NewUser("John Doe", "j@j.com", "123456")
+	assert.Nil(t, err)
+	assert.False(t, user.IsEmailVerified())
+
+	user.VerifyEmail(time.Now())
+	assert.True(t, user.IsEmailVerified())
+
+	assert.False(t, user.ChangeEmail(" J@j.com"))
+	assert.True(t, user.IsEmailVerified())
+
+	assert.True(t, user.ChangeEmail("Jane@j.com"))
+	assert.Equal(t, "jane@j.com", user.Email)
+	assert.False(t, user.IsEmailVerified())
+}
+
+func TestUser_MFAEnrollment(t *testing.T) {
+	user, err := NewUser("John Doe", "j@j.com", "123456")
+	assert.Nil(t, err)
+	now := time.Now()
+
+	assert.ErrorIs(t, user.ConfirmMFA("123456", now), ErrMFANotEnrolled)
+
+	secret, err := user.StartMFAEnrollment()
+	assert.Nil(t, err)
+	assert.False(t, user.IsMFAEnabled())
+	assert.ErrorIs(t, user.ConfirmMFA("000000x", now), ErrInvalidMFACode)
+
+	code, err := totp.Code(secret, now)
+	assert.Nil(t, err)
+	assert.Nil(t, user.ConfirmMFA(code, now))
+	assert.True(t, user.IsMFAEnabled())
+
+	assert.False(t, user.ValidateMFACode(code, now), "codes are single-use")
+	next, _ := totp.Code(secret, now.Add(totp.Period))
+	assert.True(t, user.ValidateMFACode(next, now.Add(totp.Period)))
+
+	_, err = user.StartMFAEnrollment()
+	assert.ErrorIs(t, err, ErrMFAAlreadyEnabled)
+
+	user.DisableMFA()
+	assert.False(t, user.IsMFAEnabled())
+	assert.False(t, user.ValidateMFACode(next, now))
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/tracing"
+	"gorm.io/gorm"
+	"time"
+)
+
+type APIKey struct {
+	DB *gorm.DB
+}
+
+func NewAPIKey(db *gorm.DB) *APIKey {
+	return &APIKey{DB: db}
+}
+
+func (a *APIKey) Create(ctx context.Context, key *entity.APIKey) error {
+	ctx, span := tracing.Start(ctx, "APIKeyRepository.Create")
+	defer span.End()
+
+	return a.DB.WithContext(ctx).Create(key).Error
+}
+
+func (a *APIKey) FindByPrefix(ctx context.Context, prefix string) (*entity.APIKey, error) {
+	ctx, span := tracing.Start(ctx, "APIKeyRepository.FindByPrefix")
+	defer span.End()
+
+	var key entity.APIKey
+	if err := a.DB.WithContext(ctx).First(&key, "prefix = ?", prefix).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+// FindByUser returns the keys of userID that were not revoked, newest first.
+func (a *APIKey) FindByUser(ctx context.Context, userID string) ([]entity.APIKey, error) {
+	ctx, span := tracing.Start(ctx, "APIKeyRepository.FindByUser")
+	defer span.End()
+
+	var keys []entity.APIKey
+	err := a.DB.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at desc").
+		Find(&keys).Error
+	return keys, err
+}
+
+// Revoke revokes the key id of userID and reports whether there was such a
+// key left to revoke.
+func (a *APIKey) Revoke(ctx context.Context, userID, id string, at time.Time) (bool, error) {
+	ctx, span := tracing.Start(ctx, "APIKeyRepository.Revoke")
+	defer span.End()
+
+	result := a.DB.WithContext(ctx).
+		Model(&entity.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", at)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (a *APIKey) MarkUsed(ctx context.Context, id string, at time.Time) error {
+	ctx, span := tracing.Start(ctx, "APIKeyRepository.MarkUsed")
+	defer span.End()
+
+	return a.DB.WithContext(ctx).
+		Model(&entity.APIKey{}).
+		Where("id = ?", id).
+		Update("last_used_at", at).Error
+}
+
+// DeleteByUser deletes every key of userID.
+func (a *APIKey) DeleteByUser(ctx context.Context, userID string) error {
+	ctx, span := tracing.Start(ctx, "APIKeyRepository.DeleteByUser")
+	defer span.End()
+
+	return a.DB.WithContext(ctx).Where("user_id = ?", userID).Delete(&entity.APIKey{}).Error
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"github.com/andre2ar/go-products/internal/entity"
+	entityPkg "github.com/andre2ar/go-products/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyRepository(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&entity.APIKey{}))
+
+	userID := entityPkg.NewID()
+	repository := NewAPIKey(db)
+	ctx := context.Background()
+
+	key, _, err := entity.NewAPIKey(userID, "CI", []string{entity.ScopeProductsRead, entity.ScopeProductsWrite}, nil)
+	require.NoError(t, err)
+	require.NoError(t, repository.Create(ctx, key))
+	other, _, err := entity.NewAPIKey(userID, "Backup", []string{entity.ScopeProductsRead}, nil)
+	require.NoError(t, err)
+	require.NoError(t, repository.Create(ctx, other))
+
+	found, err := repository.FindByPrefix(ctx, key.Prefix)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, key.Scopes, found.Scopes)
+	assert.Equal(t, key.SecretHash, found.SecretHash)
+
+	found, err = repository.FindByPrefix(ctx, "gpk_unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+
+	usedAt := time.Now()
+	require.NoError(t, repository.MarkUsed(ctx, key.ID.String(), usedAt))
+	found, err = repository.FindByPrefix(ctx, key.Prefix)
+	require.NoError(t, err)
+	require.NotNil(t, found.LastUsedAt)
+	assert.WithinDuration(t, usedAt, *found.LastUsedAt, time.Second)
+
+	revoked, err := repository.Revoke(ctx, entityPkg.NewID().String(), key.ID.String(), time.Now())
+	assert.NoError(t, err)
+	assert.False(t, revoked, "keys of other users are left alone")
+	revoked, err = repository.Revoke(ctx, userID.String(), key.ID.String(), time.Now())
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, err = repository.Revoke(ctx, userID.String(), key.ID.String(), time.Now())
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	keys, err := repository.FindByUser(ctx, userID.String())
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, other.ID, keys[0].ID)
+}
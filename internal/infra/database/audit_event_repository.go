@@ -0,0 +1,33 @@
+package database
+
+import (
+	"context"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/tracing"
+	"gorm.io/gorm"
+)
+
+type AuditEvent struct {
+	DB *gorm.DB
+}
+
+func NewAuditEvent(db *gorm.DB) *AuditEvent {
+	return &AuditEvent{DB: db}
+}
+
+func (a *AuditEvent) Create(ctx context.Context, event *entity.AuditEvent) error {
+	ctx, span := tracing.Start(ctx, "AuditEventRepository.Create")
+	defer span.End()
+
+	return a.DB.WithContext(ctx).Create(event).Error
+}
+
+// FindByType returns the events of eventType, newest first.
+func (a *AuditEvent) FindByType(ctx context.Context, eventType string) ([]entity.AuditEvent, error) {
+	ctx, span := tracing.Start(ctx, "AuditEventRepository.FindByType")
+	defer span.End()
+
+	var events []entity.AuditEvent
+	err := a.DB.WithContext(ctx).Where("type = ?", eventType).Order("created_at desc").Find(&events).Error
+	return events, err
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"context"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestAuditEventRepository(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&entity.AuditEvent{}))
+	repository := NewAuditEvent(db)
+	ctx := context.Background()
+
+	older := entity.NewAuditEvent(entity.AuditLoginAccountLockout, "j@j.com", "10.0.0.1", "")
+	older.CreatedAt = time.Now().Add(-time.Minute)
+	require.NoError(t, repository.Create(ctx, older))
+	newer := entity.NewAuditEvent(entity.AuditLoginAccountLockout, "jane@j.com", "10.0.0.2", "")
+	require.NoError(t, repository.Create(ctx, newer))
+	require.NoError(t, repository.Create(ctx, entity.NewAuditEvent(entity.AuditLoginIPLockout, "", "10.0.0.3", "")))
+
+	events, err := repository.FindByType(ctx, entity.AuditLoginAccountLockout)
+	assert.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, newer.ID, events[0].ID)
+	assert.Equal(t, older.ID, events[1].ID)
+}
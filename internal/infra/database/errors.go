@@ -0,0 +1,27 @@
+package database
+
+import (
+	"errors"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+)
+
+// isUniqueViolation reports whether err comes from a unique constraint,
+// either translated by GORM or raw from the SQLite or Postgres drivers.
+func isUniqueViolation(err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+
+	var sqlStateErr interface{ SQLState() string }
+	if errors.As(err, &sqlStateErr) {
+		return sqlStateErr.SQLState() == "23505"
+	}
+
+	return false
+}
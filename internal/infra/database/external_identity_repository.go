@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/tracing"
+	"gorm.io/gorm"
+)
+
+type ExternalIdentity struct {
+	DB *gorm.DB
+}
+
+func NewExternalIdentity(db *gorm.DB) *ExternalIdentity {
+	return &ExternalIdentity{DB: db}
+}
+
+func (e *ExternalIdentity) Create(ctx context.Context, identity *entity.ExternalIdentity) error {
+	ctx, span := tracing.Start(ctx, "ExternalIdentityRepository.Create")
+	defer span.End()
+
+	return e.DB.WithContext(ctx).Create(identity).Error
+}
+
+func (e *ExternalIdentity) FindBySubject(ctx context.Context, issuer, subject string) (*entity.ExternalIdentity, error) {
+	ctx, span := tracing.Start(ctx, "ExternalIdentityRepository.FindBySubject")
+	defer span.End()
+
+	var identity entity.ExternalIdentity
+	if err := e.DB.WithContext(ctx).First(&identity, "issuer = ? AND subject = ?", issuer, subject).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (e *ExternalIdentity) Delete(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "ExternalIdentityRepository.Delete")
+	defer span.End()
+
+	return e.DB.WithContext(ctx).Where("id = ?", id).Delete(&entity.ExternalIdentity{}).Error
+}
+
+// DeleteByUser deletes every identity linked to userID.
+func (e *ExternalIdentity) DeleteByUser(ctx context.Context, userID string) error {
+	ctx, span := tracing.Start(ctx, "ExternalIdentityRepository.DeleteByUser")
+	defer span.End()
+
+	return e.DB.WithContext(ctx).Where("user_id = ?", userID).Delete(&entity.ExternalIdentity{}).Error
+}
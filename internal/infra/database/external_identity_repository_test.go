@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"github.com/andre2ar/go-products/internal/entity"
+	entityPkg "github.com/andre2ar/go-products/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestExternalIdentityRepository(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&entity.ExternalIdentity{}))
+
+	repository := NewExternalIdentity(db)
+	ctx := context.Background()
+
+	identity := entity.NewExternalIdentity(entityPkg.NewID(), "https://idp.example.com", "user-1", "j@j.com")
+	require.NoError(t, repository.Create(ctx, identity))
+	assert.Error(t, repository.Create(ctx, entity.NewExternalIdentity(entityPkg.NewID(), "https://idp.example.com", "user-1", "j@j.com")))
+	require.NoError(t, repository.Create(ctx, entity.NewExternalIdentity(entityPkg.NewID(), "https://other.example.com", "user-1", "j@j.com")))
+
+	found, err := repository.FindBySubject(ctx, "https://idp.example.com", "user-1")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, identity.UserID, found.UserID)
+
+	require.NoError(t, repository.Delete(ctx, identity.ID.String()))
+	found, err = repository.FindBySubject(ctx, "https://idp.example.com", "user-1")
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+}
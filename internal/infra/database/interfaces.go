@@ -1,16 +1,61 @@
 package database
 
-import "github.com/andre2ar/go-products/internal/entity"
+import (
+	"context"
+	"github.com/andre2ar/go-products/internal/entity"
+	"time"
+)
 
 type UserRepositoryInterface interface {
-	Create(user *entity.User) error
-	FindByEmail(email string) (*entity.User, error)
+	Create(ctx context.Context, user *entity.User) error
+	FindByEmail(ctx context.Context, email string) (*entity.User, error)
+	FindByID(ctx context.Context, id string) (*entity.User, error)
+	Search(ctx context.Context, query string, page, limit int) ([]entity.User, int64, error)
+	Update(ctx context.Context, user *entity.User, fields ...string) error
+	Suspend(ctx context.Context, user *entity.User) error
+	Reactivate(ctx context.Context, user *entity.User) error
+	UseMFAStep(ctx context.Context, id string, step int64) (bool, error)
+	Delete(ctx context.Context, id string) error
 }
 
 type ProductRepositoryInterface interface {
-	Create(product *entity.Product) error
-	FindAll(page, limit int, sort string) ([]entity.Product, error)
-	FindByID(id string) (*entity.Product, error)
-	Update(product *entity.Product) error
-	Delete(id string) error
+	Create(ctx context.Context, product *entity.Product) error
+	FindAll(ctx context.Context, page, limit int, sort string) ([]entity.Product, error)
+	FindByID(ctx context.Context, id string) (*entity.Product, error)
+	Count(ctx context.Context) (int64, error)
+	Update(ctx context.Context, product *entity.Product) error
+	Delete(ctx context.Context, id string) error
+}
+
+type PasswordResetRepositoryInterface interface {
+	Create(ctx context.Context, reset *entity.PasswordReset) error
+	FindByTokenHash(ctx context.Context, tokenHash string) (*entity.PasswordReset, error)
+	Consume(ctx context.Context, tokenHash string, at time.Time) (*entity.PasswordReset, error)
+	MarkAllUsed(ctx context.Context, userID string, at time.Time) error
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+type RecoveryCodeRepositoryInterface interface {
+	Replace(ctx context.Context, userID string, codes []entity.RecoveryCode) error
+	Use(ctx context.Context, userID, codeHash string, at time.Time) (bool, error)
+}
+
+type AuditEventRepositoryInterface interface {
+	Create(ctx context.Context, event *entity.AuditEvent) error
+}
+
+type APIKeyRepositoryInterface interface {
+	Create(ctx context.Context, key *entity.APIKey) error
+	FindByPrefix(ctx context.Context, prefix string) (*entity.APIKey, error)
+	FindByUser(ctx context.Context, userID string) ([]entity.APIKey, error)
+	Revoke(ctx context.Context, userID, id string, at time.Time) (bool, error)
+	MarkUsed(ctx context.Context, id string, at time.Time) error
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+type ExternalIdentityRepositoryInterface interface {
+	Create(ctx context.Context, identity *entity.ExternalIdentity) error
+	FindBySubject(ctx context.Context, issuer, subject string) (*entity.ExternalIdentity, error)
+	Delete(ctx context.Context, id string) error
+	DeleteByUser(ctx context.Context, userID string) error
 }
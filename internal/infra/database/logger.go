@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/andre2ar/go-products/pkg/logging"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"log/slog"
+	"time"
+)
+
+// Logger is a GORM logger writing through the logger of the statement's
+// context, so queries are logged with the fields of the request running
+// them. Failed statements are logged as errors, statements slower than
+// SlowThreshold as warnings and every other one at debug level. Statements
+// are logged without their bound values, which may hold personal data or
+// secrets.
+type Logger struct {
+	SlowThreshold time.Duration
+	silent        bool
+}
+
+func NewLogger(slowThreshold time.Duration) *Logger {
+	return &Logger{SlowThreshold: slowThreshold}
+}
+
+// LogMode only honors the silent level; the level of the context logger
+// decides what else is written.
+func (l *Logger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	copied := *l
+	copied.silent = level == gormlogger.Silent
+	return &copied
+}
+
+func (l *Logger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.log(ctx, slog.LevelInfo, fmt.Sprintf(msg, args...))
+}
+
+func (l *Logger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.log(ctx, slog.LevelWarn, fmt.Sprintf(msg, args...))
+}
+
+func (l *Logger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.log(ctx, slog.LevelError, fmt.Sprintf(msg, args...))
+}
+
+func (l *Logger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	level, msg := slog.LevelDebug, "query"
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level, msg = slog.LevelError, "query failed"
+	case l.SlowThreshold > 0 && elapsed > l.SlowThreshold:
+		level, msg = slog.LevelWarn, "slow query"
+	}
+
+	logger := logging.FromContext(ctx)
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []any{slog.String("sql", sql), slog.Int64("rows", rows), slog.Duration("elapsed", elapsed)}
+	if level == slog.LevelError {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	logger.Log(ctx, level, msg, attrs...)
+}
+
+// ParamsFilter implements gorm.ParamsFilter, dropping the values bound to
+// sql so Trace is given the statement with its placeholders.
+func (l *Logger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
+
+func (l *Logger) log(ctx context.Context, level slog.Level, msg string) {
+	if !l.silent {
+		logging.FromContext(ctx).Log(ctx, level, msg)
+	}
+}
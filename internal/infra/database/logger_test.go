@@ -0,0 +1,48 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggerWritesThroughContextLogger(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: NewLogger(time.Hour)})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&entity.Product{}))
+
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "debug", "json")
+	require.NoError(t, err)
+	ctx := logging.With(logging.NewContext(context.Background(), logger), "request_id", "req-1")
+
+	db.WithContext(ctx).First(&entity.Product{}, "id = ?", "missing")
+	db.WithContext(ctx).Exec("SELECT * FROM missing_table")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var query, failure map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &query))
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &failure))
+
+	assert.Equal(t, "query", query["msg"], "record not found is not an error")
+	assert.Equal(t, "DEBUG", query["level"])
+	assert.Equal(t, "req-1", query["request_id"])
+	assert.Contains(t, query["sql"], "FROM `products`")
+	assert.Contains(t, query["sql"], "id = ?")
+	assert.NotContains(t, query["sql"], "missing", "bound values are not logged")
+
+	assert.Equal(t, "query failed", failure["msg"])
+	assert.Equal(t, "ERROR", failure["level"])
+	assert.Contains(t, failure["error"], "no such table")
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/andre2ar/go-products/internal/entity"
+	"gorm.io/gorm"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// models are the entities stored in the database, migrated by Migrate.
+var models = []interface{}{
+	&entity.Product{},
+	&entity.User{},
+	&entity.PasswordReset{},
+	&entity.RecoveryCode{},
+	&entity.AuditEvent{},
+	&entity.APIKey{},
+	&entity.ExternalIdentity{},
+}
+
+func Migrate(db *gorm.DB) error {
+	// Emails are unique once normalized, so rows stored before
+	// normalization must be rewritten before the unique index is built.
+	// Accounts whose emails only differ by case or spaces cannot be merged
+	// automatically, so they are reported for an operator to resolve.
+	hasUsers := db.Migrator().HasTable(&entity.User{})
+	if hasUsers {
+		var collisions []string
+		err := db.Raw("SELECT LOWER(TRIM(email)) FROM users GROUP BY LOWER(TRIM(email)) HAVING COUNT(*) > 1 ORDER BY 1").Scan(&collisions).Error
+		if err != nil {
+			return err
+		}
+		if len(collisions) > 0 {
+			return fmt.Errorf("users share emails differing only by case or spaces, rename or delete all but one of each before migrating: %s", strings.Join(collisions, ", "))
+		}
+
+		err = db.Exec("UPDATE users SET email = LOWER(TRIM(email)) WHERE email <> LOWER(TRIM(email))").Error
+		if err != nil {
+			return err
+		}
+	}
+	predatesVerification := hasUsers && !db.Migrator().HasColumn(&entity.User{}, "EmailVerifiedAt")
+
+	err := db.AutoMigrate(models...)
+	if err != nil {
+		return err
+	}
+
+	// Accounts registered before email verification existed are trusted as
+	// verified so requiring verification does not lock them out.
+	if predatesVerification {
+		return db.Model(&entity.User{}).Where("email_verified_at IS NULL").Update("email_verified_at", time.Now()).Error
+	}
+	return nil
+}
+
+// PendingMigrations lists the tables, and the columns of existing tables,
+// that Migrate would still create.
+func PendingMigrations(ctx context.Context, db *gorm.DB) ([]string, error) {
+	db = db.WithContext(ctx)
+	migrator := db.Migrator()
+
+	var pending []string
+	for _, model := range models {
+		statement := &gorm.Statement{DB: db}
+		if err := statement.Parse(model); err != nil {
+			return nil, err
+		}
+
+		table := statement.Schema.Table
+		if !migrator.HasTable(table) {
+			pending = append(pending, table)
+			continue
+		}
+		for _, field := range statement.Schema.Fields {
+			if field.DBName != "" && !migrator.HasColumn(model, field.DBName) {
+				pending = append(pending, table+"."+field.DBName)
+			}
+		}
+	}
+	return pending, ctx.Err()
+}
+
+// MigrationsCheck is a health check failing while migrations are pending.
+// Migrations only ever add to the schema, so once none is pending the
+// schema is no longer inspected on every probe.
+func MigrationsCheck(db *gorm.DB) func(ctx context.Context) error {
+	var migrated atomic.Bool
+	return func(ctx context.Context) error {
+		if migrated.Load() {
+			return nil
+		}
+
+		pending, err := PendingMigrations(ctx, db)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("pending migrations: %s", strings.Join(pending, ", "))
+		}
+		migrated.Store(true)
+		return nil
+	}
+}
+
+// PingCheck is a health check failing while the database is unreachable.
+func PingCheck(db *gorm.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// SeedAdmins makes emails the list of admins: users registered with one of
+// them get the admin role once they verified it, so registering with or
+// changing to a listed email is not enough, and admins whose email left the
+// list lose it.
+func SeedAdmins(db *gorm.DB, emails []string) error {
+	normalized := make([]string, 0, len(emails))
+	for _, email := range emails {
+		if email = entity.NormalizeEmail(email); email != "" {
+			normalized = append(normalized, email)
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		demoted := tx.Model(&entity.User{}).Where("role = ?", entity.RoleAdmin)
+		if len(normalized) > 0 {
+			demoted = demoted.Where("email NOT IN ? OR email_verified_at IS NULL", normalized)
+		}
+		if err := demoted.Update("role", entity.RoleUser).Error; err != nil {
+			return err
+		}
+		if len(normalized) == 0 {
+			return nil
+		}
+
+		return tx.Model(&entity.User{}).
+			Where("email IN ? AND email_verified_at IS NOT NULL", normalized).
+			Update("role", entity.RoleAdmin).Error
+	})
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestMigrateNormalizesExistingEmails(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Error(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	db.Exec("CREATE TABLE users (id TEXT PRIMARY KEY, name TEXT, email TEXT, password TEXT)")
+	db.Exec("INSERT INTO users (id, name, email, password) VALUES ('2a1f7c0e-8f51-4bd4-9d49-6b2b1d58f0a1', 'Jhon', ' J@J.Com', '')")
+
+	assert.NoError(t, Migrate(db))
+
+	user, err := NewUser(db).FindByEmail(context.Background(), "j@j.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "j@j.com", user.Email)
+	assert.True(t, db.Migrator().HasIndex(&entity.User{}, "Email"))
+}
+
+func TestMigrateReportsEmailsDifferingByCase(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Error(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	db.Exec("CREATE TABLE users (id TEXT PRIMARY KEY, name TEXT, email TEXT, password TEXT)")
+	db.Exec("INSERT INTO users (id, name, email, password) VALUES ('2a1f7c0e-8f51-4bd4-9d49-6b2b1d58f0a1', 'Jhon', 'J@J.Com', '')")
+	db.Exec("INSERT INTO users (id, name, email, password) VALUES ('7c3e9a52-0d1b-4f6e-a8c4-3b5d2e1f0a97', 'Jhon', 'j@j.com ', '')")
+
+	assert.ErrorContains(t, Migrate(db), "before migrating: j@j.com")
+
+	var emails []string
+	db.Raw("SELECT email FROM users ORDER BY email").Scan(&emails)
+	assert.Equal(t, []string{"J@J.Com", "j@j.com "}, emails, "the rows are left for an operator to resolve")
+	assert.False(t, db.Migrator().HasIndex(&entity.User{}, "Email"))
+
+	db.Exec("DELETE FROM users WHERE email = 'j@j.com '")
+	assert.NoError(t, Migrate(db))
+}
+
+func TestMigrateTrustsEmailsOfExistingUsers(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Error(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	db.Exec("CREATE TABLE users (id TEXT PRIMARY KEY, name TEXT, email TEXT, password TEXT)")
+	db.Exec("INSERT INTO users (id, name, email, password) VALUES ('2a1f7c0e-8f51-4bd4-9d49-6b2b1d58f0a1', 'Jhon', 'j@j.com', '')")
+
+	assert.NoError(t, Migrate(db))
+	user, err := NewUser(db).FindByEmail(context.Background(), "j@j.com")
+	assert.NoError(t, err)
+	assert.True(t, user.IsEmailVerified())
+
+	newUser, _ := entity.NewUser("Jane", "jane@j.com", "123456")
+	assert.NoError(t, NewUser(db).Create(context.Background(), newUser))
+	assert.NoError(t, Migrate(db))
+	found, err := NewUser(db).FindByEmail(context.Background(), "jane@j.com")
+	assert.NoError(t, err)
+	assert.False(t, found.IsEmailVerified())
+}
+
+func TestPendingMigrations(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Error(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	db.Exec("CREATE TABLE users (id TEXT PRIMARY KEY, name TEXT, email TEXT, password TEXT)")
+	pending, err := PendingMigrations(context.Background(), db)
+	assert.NoError(t, err)
+	assert.Contains(t, pending, "products")
+	assert.Contains(t, pending, "users.email_verified_at")
+	assert.NotContains(t, pending, "users.email")
+	check := MigrationsCheck(db)
+	assert.ErrorContains(t, check(context.Background()), "pending migrations: products")
+
+	assert.NoError(t, Migrate(db))
+	pending, err = PendingMigrations(context.Background(), db)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+	assert.NoError(t, check(context.Background()))
+	assert.NoError(t, PingCheck(db)(context.Background()))
+
+	sqlDB.Close()
+	assert.Error(t, PingCheck(db)(context.Background()))
+	assert.NoError(t, check(context.Background()), "the schema is not inspected once migrated")
+}
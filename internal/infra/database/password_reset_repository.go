@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/tracing"
+	"gorm.io/gorm"
+	"time"
+)
+
+type PasswordReset struct {
+	DB *gorm.DB
+}
+
+func NewPasswordReset(db *gorm.DB) *PasswordReset {
+	return &PasswordReset{DB: db}
+}
+
+func (p *PasswordReset) Create(ctx context.Context, reset *entity.PasswordReset) error {
+	ctx, span := tracing.Start(ctx, "PasswordResetRepository.Create")
+	defer span.End()
+
+	return p.DB.WithContext(ctx).Create(reset).Error
+}
+
+func (p *PasswordReset) FindByTokenHash(ctx context.Context, tokenHash string) (*entity.PasswordReset, error) {
+	ctx, span := tracing.Start(ctx, "PasswordResetRepository.FindByTokenHash")
+	defer span.End()
+
+	var reset entity.PasswordReset
+	if err := p.DB.WithContext(ctx).First(&reset, "token_hash = ?", tokenHash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &reset, nil
+}
+
+// Consume marks the usable reset hashed as tokenHash used at at and returns
+// it, or nil when there is none. The reset is checked and marked in one
+// statement, so concurrent requests cannot both consume it.
+func (p *PasswordReset) Consume(ctx context.Context, tokenHash string, at time.Time) (*entity.PasswordReset, error) {
+	ctx, span := tracing.Start(ctx, "PasswordResetRepository.Consume")
+	defer span.End()
+
+	result := p.DB.WithContext(ctx).
+		Model(&entity.PasswordReset{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, at).
+		Update("used_at", at)
+	if result.Error != nil || result.RowsAffected != 1 {
+		return nil, result.Error
+	}
+	return p.FindByTokenHash(ctx, tokenHash)
+}
+
+// MarkAllUsed consumes every outstanding reset of userID, so using one token
+// invalidates the others.
+func (p *PasswordReset) MarkAllUsed(ctx context.Context, userID string, at time.Time) error {
+	ctx, span := tracing.Start(ctx, "PasswordResetRepository.MarkAllUsed")
+	defer span.End()
+
+	return p.DB.WithContext(ctx).
+		Model(&entity.PasswordReset{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", at).Error
+}
+
+// DeleteByUser deletes every reset of userID.
+func (p *PasswordReset) DeleteByUser(ctx context.Context, userID string) error {
+	ctx, span := tracing.Start(ctx, "PasswordResetRepository.DeleteByUser")
+	defer span.End()
+
+	return p.DB.WithContext(ctx).Where("user_id = ?", userID).Delete(&entity.PasswordReset{}).Error
+}
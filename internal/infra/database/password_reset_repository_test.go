@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/pkg/securetoken"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestPasswordResetRepository(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&entity.PasswordReset{}))
+
+	user, err := entity.NewUser("Jhon", "j@j.com", "123456")
+	require.NoError(t, err)
+	repository := NewPasswordReset(db)
+	ctx := context.Background()
+
+	first, firstToken, err := entity.NewPasswordReset(user.ID, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, repository.Create(ctx, first))
+	second, _, err := entity.NewPasswordReset(user.ID, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, repository.Create(ctx, second))
+
+	found, err := repository.FindByTokenHash(ctx, securetoken.Hash(firstToken))
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, first.ID, found.ID)
+
+	found, err = repository.FindByTokenHash(ctx, securetoken.Hash("unknown"))
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+
+	now := time.Now()
+	consumed, err := repository.Consume(ctx, securetoken.Hash(firstToken), now)
+	require.NoError(t, err)
+	require.NotNil(t, consumed)
+	assert.Equal(t, first.ID, consumed.ID)
+	consumed, err = repository.Consume(ctx, securetoken.Hash(firstToken), now)
+	assert.NoError(t, err)
+	assert.Nil(t, consumed, "a reset is consumed once")
+	consumed, err = repository.Consume(ctx, second.TokenHash, second.ExpiresAt)
+	assert.NoError(t, err)
+	assert.Nil(t, consumed, "expired resets are not consumed")
+
+	require.NoError(t, repository.MarkAllUsed(ctx, user.ID.String(), now))
+	for _, reset := range []*entity.PasswordReset{first, second} {
+		var stored entity.PasswordReset
+		require.NoError(t, db.First(&stored, "id = ?", reset.ID).Error)
+		assert.False(t, stored.IsUsable(now))
+	}
+}
@@ -1,8 +1,10 @@
 package database
 
 import (
+	"context"
 	"errors"
 	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/tracing"
 	"gorm.io/gorm"
 	"strings"
 )
@@ -15,13 +17,19 @@ func NewProduct(db *gorm.DB) *Product {
 	return &Product{DB: db}
 }
 
-func (p *Product) Create(product *entity.Product) error {
-	return p.DB.Create(product).Error
+func (p *Product) Create(ctx context.Context, product *entity.Product) error {
+	ctx, span := tracing.Start(ctx, "ProductRepository.Create")
+	defer span.End()
+
+	return p.DB.WithContext(ctx).Create(product).Error
 }
 
-func (p *Product) FindByID(id string) (*entity.Product, error) {
+func (p *Product) FindByID(ctx context.Context, id string) (*entity.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductRepository.FindByID")
+	defer span.End()
+
 	var product entity.Product
-	if err := p.DB.First(&product, "id = ?", id).Error; err != nil {
+	if err := p.DB.WithContext(ctx).First(&product, "id = ?", id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -30,17 +38,32 @@ func (p *Product) FindByID(id string) (*entity.Product, error) {
 	return &product, nil
 }
 
-func (p *Product) Update(product *entity.Product) error {
-	_, err := p.FindByID(product.ID.String())
+func (p *Product) Count(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "ProductRepository.Count")
+	defer span.End()
+
+	var count int64
+	err := p.DB.WithContext(ctx).Model(&entity.Product{}).Count(&count).Error
+	return count, err
+}
+
+func (p *Product) Update(ctx context.Context, product *entity.Product) error {
+	ctx, span := tracing.Start(ctx, "ProductRepository.Update")
+	defer span.End()
+
+	_, err := p.FindByID(ctx, product.ID.String())
 	if err != nil {
 		return err
 	}
 
-	return p.DB.Save(product).Error
+	return p.DB.WithContext(ctx).Save(product).Error
 }
 
-func (p *Product) Delete(id string) error {
-	product, err := p.FindByID(id)
+func (p *Product) Delete(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "ProductRepository.Delete")
+	defer span.End()
+
+	product, err := p.FindByID(ctx, id)
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -49,10 +72,13 @@ func (p *Product) Delete(id string) error {
 		return err
 	}
 
-	return p.DB.Delete(product).Error
+	return p.DB.WithContext(ctx).Delete(product).Error
 }
 
-func (p *Product) FindAll(page, limit int, sort string) ([]entity.Product, error) {
+func (p *Product) FindAll(ctx context.Context, page, limit int, sort string) ([]entity.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductRepository.FindAll")
+	defer span.End()
+
 	sort = strings.ToLower(sort)
 	if sort != "" && sort != "asc" && sort != "desc" {
 		sort = "asc"
@@ -61,9 +87,9 @@ func (p *Product) FindAll(page, limit int, sort string) ([]entity.Product, error
 	var products []entity.Product
 	var err error
 	if page != 0 && limit != 0 {
-		err = p.DB.Limit(limit).Offset((page - 1) * limit).Order("created_at " + sort).Find(&products).Error
+		err = p.DB.WithContext(ctx).Limit(limit).Offset((page - 1) * limit).Order("created_at " + sort).Find(&products).Error
 	} else {
-		err = p.DB.Order("created_at" + sort).Find(&products).Error
+		err = p.DB.WithContext(ctx).Order("created_at" + sort).Find(&products).Error
 	}
 
 	return products, err
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"github.com/andre2ar/go-products/internal/entity"
 	"math/rand"
@@ -20,7 +21,7 @@ func TestCreateNewProduct(t *testing.T) {
 	product, err := entity.NewProduct("Product 1", 10.00)
 	assert.NoError(t, err)
 	productRepository := NewProduct(db)
-	err = productRepository.Create(product)
+	err = productRepository.Create(context.Background(), product)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, product.ID)
 }
@@ -37,23 +38,27 @@ func TestFinalAllProducts(t *testing.T) {
 		db.Create(product)
 	}
 	productRepository := NewProduct(db)
-	products, err := productRepository.FindAll(1, 10, "asc")
+	products, err := productRepository.FindAll(context.Background(), 1, 10, "asc")
 	assert.NoError(t, err)
 	assert.Len(t, products, 10)
 	assert.Equal(t, "Product 1", products[0].Name)
 	assert.Equal(t, "Product 10", products[9].Name)
 
-	products, err = productRepository.FindAll(2, 10, "asc")
+	products, err = productRepository.FindAll(context.Background(), 2, 10, "asc")
 	assert.NoError(t, err)
 	assert.Len(t, products, 10)
 	assert.Equal(t, "Product 11", products[0].Name)
 	assert.Equal(t, "Product 20", products[9].Name)
 
-	products, err = productRepository.FindAll(3, 10, "asc")
+	products, err = productRepository.FindAll(context.Background(), 3, 10, "asc")
 	assert.NoError(t, err)
 	assert.Len(t, products, 3)
 	assert.Equal(t, "Product 21", products[0].Name)
 	assert.Equal(t, "Product 23", products[2].Name)
+
+	count, err := productRepository.Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(23), count)
 }
 
 func TestFindProductByID(t *testing.T) {
@@ -66,7 +71,7 @@ func TestFindProductByID(t *testing.T) {
 	assert.NoError(t, err)
 	db.Create(product)
 	productRepository := NewProduct(db)
-	product, err = productRepository.FindByID(product.ID.String())
+	product, err = productRepository.FindByID(context.Background(), product.ID.String())
 	assert.NoError(t, err)
 	assert.Equal(t, "Product 1", product.Name)
 }
@@ -82,9 +87,9 @@ func TestUpdateProduct(t *testing.T) {
 	db.Create(product)
 	productRepository := NewProduct(db)
 	product.Name = "Product 2"
-	err = productRepository.Update(product)
+	err = productRepository.Update(context.Background(), product)
 	assert.NoError(t, err)
-	product, err = productRepository.FindByID(product.ID.String())
+	product, err = productRepository.FindByID(context.Background(), product.ID.String())
 	assert.NoError(t, err)
 	assert.Equal(t, "Product 2", product.Name)
 }
@@ -100,10 +105,10 @@ func TestDeleteProduct(t *testing.T) {
 	db.Create(product)
 	productRepository := NewProduct(db)
 
-	err = productRepository.Delete(product.ID.String())
+	err = productRepository.Delete(context.Background(), product.ID.String())
 	assert.NoError(t, err)
 
-	product, err = productRepository.FindByID(product.ID.String())
+	product, err = productRepository.FindByID(context.Background(), product.ID.String())
 	assert.Nil(t, product)
 	assert.Nil(t, err)
 }
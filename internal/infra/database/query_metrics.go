@@ -0,0 +1,83 @@
+package database
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+	"time"
+)
+
+const queryMetricsStartKey = "query_metrics:start"
+
+// QueryMetrics is a GORM plugin observing the duration of every statement in
+// Duration and counting failed ones in Errors, both labelled by operation
+// (create, query, update, delete, row or raw) and table. Missing records are
+// not counted as errors.
+type QueryMetrics struct {
+	Duration *prometheus.HistogramVec
+	Errors   *prometheus.CounterVec
+}
+
+func NewQueryMetrics(duration *prometheus.HistogramVec, errors *prometheus.CounterVec) *QueryMetrics {
+	return &QueryMetrics{Duration: duration, Errors: errors}
+}
+
+func (q *QueryMetrics) Name() string {
+	return "query_metrics"
+}
+
+func (q *QueryMetrics) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("query_metrics:before_create", q.start); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("query_metrics:after_create", q.observe("create")); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().Before("gorm:query").Register("query_metrics:before_query", q.start); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().After("gorm:query").Register("query_metrics:after_query", q.observe("query")); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("query_metrics:before_update", q.start); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("query_metrics:after_update", q.observe("update")); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("query_metrics:before_delete", q.start); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().After("gorm:delete").Register("query_metrics:after_delete", q.observe("delete")); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("query_metrics:before_row", q.start); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().After("gorm:row").Register("query_metrics:after_row", q.observe("row")); err != nil {
+		return err
+	}
+	if err := db.Callback().Raw().Before("gorm:raw").Register("query_metrics:before_raw", q.start); err != nil {
+		return err
+	}
+	return db.Callback().Raw().After("gorm:raw").Register("query_metrics:after_raw", q.observe("raw"))
+}
+
+func (q *QueryMetrics) start(db *gorm.DB) {
+	db.InstanceSet(queryMetricsStartKey, time.Now())
+}
+
+func (q *QueryMetrics) observe(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		start, ok := db.InstanceGet(queryMetricsStartKey)
+		if !ok {
+			return
+		}
+
+		table := db.Statement.Table
+		q.Duration.WithLabelValues(operation, table).Observe(time.Since(start.(time.Time)).Seconds())
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			q.Errors.WithLabelValues(operation, table).Inc()
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestQueryMetricsObserveStatements(t *testing.T) {
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "duration"}, []string{"operation", "table"})
+	errors := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "errors"}, []string{"operation", "table"})
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&entity.Product{}))
+	require.NoError(t, db.Use(NewQueryMetrics(duration, errors)))
+
+	product, err := entity.NewProduct("Product", 10)
+	require.NoError(t, err)
+	require.NoError(t, db.Create(product).Error)
+	require.Error(t, db.First(&entity.Product{}, "id = ?", "missing").Error)
+	require.Error(t, db.Exec("SELECT * FROM missing_table").Error)
+
+	assert.Equal(t, 3, testutil.CollectAndCount(duration), "one series per operation and table")
+	assert.Equal(t, float64(0), testutil.ToFloat64(errors.WithLabelValues("query", "products")), "record not found is not an error")
+	assert.Equal(t, float64(1), testutil.ToFloat64(errors.WithLabelValues("raw", "")))
+}
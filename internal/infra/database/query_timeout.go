@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"time"
+)
+
+const queryTimeoutKey = "query_timeout"
+
+// queryTimeout is the state start hands over to stop: the context of the
+// statement before the timeout, and the cancel func of the timeout.
+type queryTimeout struct {
+	parent context.Context
+	cancel context.CancelFunc
+}
+
+// QueryTimeout is a GORM plugin bounding every create, query, update and
+// delete statement by Timeout, on top of whatever deadline the caller's
+// context already carries. A zero Timeout disables the plugin.
+type QueryTimeout struct {
+	Timeout time.Duration
+}
+
+func (q *QueryTimeout) Name() string {
+	return "query_timeout"
+}
+
+func (q *QueryTimeout) Initialize(db *gorm.DB) error {
+	if q.Timeout <= 0 {
+		return nil
+	}
+
+	if err := db.Callback().Create().Before("gorm:create").Register("query_timeout:before_create", q.start); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("query_timeout:after_create", q.stop); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().Before("gorm:query").Register("query_timeout:before_query", q.start); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().After("gorm:query").Register("query_timeout:after_query", q.stop); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("query_timeout:before_update", q.start); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("query_timeout:after_update", q.stop); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("query_timeout:before_delete", q.start); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Register("query_timeout:after_delete", q.stop)
+}
+
+func (q *QueryTimeout) start(db *gorm.DB) {
+	original := db.Statement.Context
+	parent := original
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	ctx, cancel := context.WithTimeout(parent, q.Timeout)
+	db.Statement.Context = ctx
+	db.InstanceSet(queryTimeoutKey, queryTimeout{parent: original, cancel: cancel})
+}
+
+// stop cancels the timeout of the statement and gives it back its previous
+// context, so a reused *gorm.DB does not run its next statement with a
+// cancelled one.
+func (q *QueryTimeout) stop(db *gorm.DB) {
+	if state, ok := db.InstanceGet(queryTimeoutKey); ok {
+		timeout := state.(queryTimeout)
+		timeout.cancel()
+		db.Statement.Context = timeout.parent
+	}
+}
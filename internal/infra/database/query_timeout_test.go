@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestQueryTimeoutCancelsSlowQueries(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Error(err)
+	}
+	db.AutoMigrate(&entity.Product{})
+	assert.NoError(t, db.Use(&QueryTimeout{Timeout: time.Nanosecond}))
+
+	product, err := entity.NewProduct("Product 1", 10.00)
+	assert.NoError(t, err)
+	productRepository := NewProduct(db)
+
+	err = productRepository.Create(context.Background(), product)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = productRepository.FindAll(context.Background(), 1, 10, "asc")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestQueryTimeoutKeepsFastQueries(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Error(err)
+	}
+	db.AutoMigrate(&entity.Product{})
+	assert.NoError(t, db.Use(&QueryTimeout{Timeout: time.Minute}))
+
+	product, err := entity.NewProduct("Product 1", 10.00)
+	assert.NoError(t, err)
+	productRepository := NewProduct(db)
+
+	assert.NoError(t, productRepository.Create(context.Background(), product))
+	found, err := productRepository.FindByID(context.Background(), product.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, product.ID, found.ID)
+}
+
+func TestRepositoryHonoursCanceledContext(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Error(err)
+	}
+	db.AutoMigrate(&entity.Product{})
+	productRepository := NewProduct(db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = productRepository.FindAll(ctx, 0, 0, "")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestQueryTimeoutRestoresTheStatementContext(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Error(err)
+	}
+	db.AutoMigrate(&entity.Product{})
+	assert.NoError(t, db.Use(&QueryTimeout{Timeout: time.Minute}))
+
+	ctx := context.Background()
+	query := db.WithContext(ctx).Model(&entity.Product{}).Where("price > ?", 0)
+	var products []entity.Product
+	assert.NoError(t, query.Find(&products).Error)
+	assert.NoError(t, query.Find(&products).Error, "a reused statement runs again")
+	assert.Equal(t, ctx, query.Statement.Context)
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"errors"
+	"github.com/andre2ar/go-products/internal/infra/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const queryTracingSpanKey = "query_tracing:span"
+
+// QueryTracing is a GORM plugin recording every statement as a span, child
+// of the span of the statement context, holding the SQL without its bound
+// values and the rows affected. Missing records are not recorded as errors.
+type QueryTracing struct{}
+
+func NewQueryTracing() *QueryTracing {
+	return &QueryTracing{}
+}
+
+func (q *QueryTracing) Name() string {
+	return "query_tracing"
+}
+
+func (q *QueryTracing) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("query_tracing:before_create", q.start("create")); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("query_tracing:after_create", q.end); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().Before("gorm:query").Register("query_tracing:before_query", q.start("query")); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().After("gorm:query").Register("query_tracing:after_query", q.end); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("query_tracing:before_update", q.start("update")); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("query_tracing:after_update", q.end); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("query_tracing:before_delete", q.start("delete")); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().After("gorm:delete").Register("query_tracing:after_delete", q.end); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("query_tracing:before_row", q.start("row")); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().After("gorm:row").Register("query_tracing:after_row", q.end); err != nil {
+		return err
+	}
+	if err := db.Callback().Raw().Before("gorm:raw").Register("query_tracing:before_raw", q.start("raw")); err != nil {
+		return err
+	}
+	return db.Callback().Raw().After("gorm:raw").Register("query_tracing:after_raw", q.end)
+}
+
+func (q *QueryTracing) start(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Statement.Context == nil {
+			return
+		}
+
+		ctx, span := tracing.Start(db.Statement.Context, "db."+operation, trace.WithSpanKind(trace.SpanKindClient))
+		if !span.IsRecording() {
+			return
+		}
+		span.SetAttributes(
+			semconv.DBSystemKey.String(db.Dialector.Name()),
+			semconv.DBOperationName(operation),
+		)
+		db.Statement.Context = ctx
+		db.InstanceSet(queryTracingSpanKey, span)
+	}
+}
+
+func (q *QueryTracing) end(db *gorm.DB) {
+	value, ok := db.InstanceGet(queryTracingSpanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+
+	span.SetAttributes(
+		semconv.DBCollectionName(db.Statement.Table),
+		semconv.DBQueryText(db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
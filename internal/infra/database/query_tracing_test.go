@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestQueryTracingRecordsStatementsUnderTheCallerSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&entity.Product{}))
+	require.NoError(t, db.Use(NewQueryTracing()))
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	products := NewProduct(db)
+	product, err := entity.NewProduct("Product", 10)
+	require.NoError(t, err)
+	require.NoError(t, products.Create(ctx, product))
+	found, err := products.FindByID(ctx, "missing")
+	require.NoError(t, err)
+	require.Nil(t, found)
+	require.Error(t, db.WithContext(ctx).Exec("SELECT * FROM missing_table").Error)
+	db.Create(product)
+	parent.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	require.Len(t, spans, 6, "statements without a traced context are not recorded")
+
+	create := spans["ProductRepository.Create"]
+	assert.Equal(t, parent.SpanContext().SpanID(), create.Parent().SpanID())
+	assert.Equal(t, create.SpanContext().SpanID(), spans["db.create"].Parent().SpanID())
+	assert.Equal(t, codes.Unset, spans["db.query"].Status().Code, "record not found is not an error")
+	assert.Equal(t, codes.Error, spans["db.raw"].Status().Code)
+	assert.Equal(t, parent.SpanContext().SpanID(), spans["db.raw"].Parent().SpanID())
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/tracing"
+	"gorm.io/gorm"
+	"time"
+)
+
+type RecoveryCode struct {
+	DB *gorm.DB
+}
+
+func NewRecoveryCode(db *gorm.DB) *RecoveryCode {
+	return &RecoveryCode{DB: db}
+}
+
+// Replace deletes every recovery code of userID and stores codes instead.
+func (r *RecoveryCode) Replace(ctx context.Context, userID string, codes []entity.RecoveryCode) error {
+	ctx, span := tracing.Start(ctx, "RecoveryCodeRepository.Replace")
+	defer span.End()
+
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&entity.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// Use consumes the unused code of userID hashed as codeHash and reports
+// whether there was one, so each code is accepted at most once even under
+// concurrent attempts.
+func (r *RecoveryCode) Use(ctx context.Context, userID, codeHash string, at time.Time) (bool, error) {
+	ctx, span := tracing.Start(ctx, "RecoveryCodeRepository.Use")
+	defer span.End()
+
+	result := r.DB.WithContext(ctx).
+		Model(&entity.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", at)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
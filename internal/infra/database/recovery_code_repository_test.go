@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"github.com/andre2ar/go-products/internal/entity"
+	entityPkg "github.com/andre2ar/go-products/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestRecoveryCodeRepository(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&entity.RecoveryCode{}))
+
+	userID := entityPkg.NewID()
+	repository := NewRecoveryCode(db)
+	ctx := context.Background()
+
+	codes, plain, err := entity.NewRecoveryCodes(userID)
+	require.NoError(t, err)
+	require.NoError(t, repository.Replace(ctx, userID.String(), codes))
+
+	used, err := repository.Use(ctx, userID.String(), entity.HashRecoveryCode(plain[0]), time.Now())
+	assert.NoError(t, err)
+	assert.True(t, used)
+	used, err = repository.Use(ctx, userID.String(), entity.HashRecoveryCode(plain[0]), time.Now())
+	assert.NoError(t, err)
+	assert.False(t, used)
+	used, err = repository.Use(ctx, entityPkg.NewID().String(), entity.HashRecoveryCode(plain[1]), time.Now())
+	assert.NoError(t, err)
+	assert.False(t, used)
+
+	replacement, _, err := entity.NewRecoveryCodes(userID)
+	require.NoError(t, err)
+	require.NoError(t, repository.Replace(ctx, userID.String(), replacement))
+	used, err = repository.Use(ctx, userID.String(), entity.HashRecoveryCode(plain[1]), time.Now())
+	assert.NoError(t, err)
+	assert.False(t, used)
+}
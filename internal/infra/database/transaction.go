@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/andre2ar/go-products/internal/infra/tracing"
+	"github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	defaultTransactionRetries = 3
+	transactionRetryBackoff   = 10 * time.Millisecond
+)
+
+type transactionContextKey struct{}
+
+// Repositories groups repository instances bound to the same transaction.
+type Repositories struct {
+	Products       ProductRepositoryInterface
+	Users          UserRepositoryInterface
+	PasswordResets PasswordResetRepositoryInterface
+	RecoveryCodes  RecoveryCodeRepositoryInterface
+	Identities     ExternalIdentityRepositoryInterface
+	APIKeys        APIKeyRepositoryInterface
+}
+
+type TransactionManagerInterface interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context, repositories *Repositories) error) error
+}
+
+type TransactionManager struct {
+	DB         *gorm.DB
+	MaxRetries int
+}
+
+func NewTransactionManager(db *gorm.DB) *TransactionManager {
+	return &TransactionManager{DB: db, MaxRetries: defaultTransactionRetries}
+}
+
+// WithinTransaction runs fn with repositories bound to a transaction that is
+// committed when fn returns nil and rolled back when it returns an error or
+// panics. Calling it again with the context handed to fn opens a savepoint
+// inside the running transaction instead of a new one. Outermost transactions
+// failing on lock contention or serialization conflicts are retried up to
+// MaxRetries times, so fn must be safe to run more than once.
+func (t *TransactionManager) WithinTransaction(ctx context.Context, fn func(ctx context.Context, repositories *Repositories) error) error {
+	if tx, ok := ctx.Value(transactionContextKey{}).(*gorm.DB); ok {
+		return t.run(ctx, tx, fn)
+	}
+
+	ctx, span := tracing.Start(ctx, "TransactionManager.WithinTransaction")
+	defer span.End()
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = t.run(ctx, t.DB.WithContext(ctx), fn)
+		if err == nil || !isRetryableTransactionError(err) || attempt >= t.MaxRetries {
+			span.SetAttributes(attribute.Int("db.transaction.attempts", attempt+1))
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(transactionRetryBackoff << attempt):
+		}
+	}
+}
+
+func (t *TransactionManager) run(ctx context.Context, db *gorm.DB, fn func(ctx context.Context, repositories *Repositories) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		txCtx := context.WithValue(ctx, transactionContextKey{}, tx)
+		return fn(txCtx, &Repositories{
+			Products:       NewProduct(tx),
+			Users:          NewUser(tx),
+			PasswordResets: NewPasswordReset(tx),
+			RecoveryCodes:  NewRecoveryCode(tx),
+			Identities:     NewExternalIdentity(tx),
+			APIKeys:        NewAPIKey(tx),
+		})
+	})
+}
+
+// isRetryableTransactionError reports whether err is a transient conflict
+// worth retrying: SQLite busy/locked errors and Postgres serialization
+// failures or deadlocks (SQLSTATE 40001 and 40P01).
+func isRetryableTransactionError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+
+	var sqlStateErr interface{ SQLState() string }
+	if errors.As(err, &sqlStateErr) {
+		state := sqlStateErr.SQLState()
+		return state == "40001" || state == "40P01"
+	}
+
+	return false
+}
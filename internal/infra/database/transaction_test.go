@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func newTransactionTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Error(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Error(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&entity.Product{}, &entity.User{})
+	return db
+}
+
+func countProducts(db *gorm.DB) int64 {
+	var count int64
+	db.Model(&entity.Product{}).Count(&count)
+	return count
+}
+
+func TestTransactionCommits(t *testing.T) {
+	db := newTransactionTestDB(t)
+	transactionManager := NewTransactionManager(db)
+
+	err := transactionManager.WithinTransaction(context.Background(), func(ctx context.Context, repositories *Repositories) error {
+		product, _ := entity.NewProduct("Product 1", 10)
+		if err := repositories.Products.Create(ctx, product); err != nil {
+			return err
+		}
+		user, _ := entity.NewUser("Jhon", "j@j.com", "123456")
+		return repositories.Users.Create(ctx, user)
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(1), countProducts(db))
+	_, err = NewUser(db).FindByEmail(context.Background(), "j@j.com")
+	assert.NoError(t, err)
+}
+
+func TestTransactionRollsBackOnError(t *testing.T) {
+	db := newTransactionTestDB(t)
+	transactionManager := NewTransactionManager(db)
+	errFailed := errors.New("failed")
+
+	err := transactionManager.WithinTransaction(context.Background(), func(ctx context.Context, repositories *Repositories) error {
+		product, _ := entity.NewProduct("Product 1", 10)
+		if err := repositories.Products.Create(ctx, product); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+
+	assert.Equal(t, int64(0), countProducts(db))
+}
+
+func TestTransactionRollsBackOnPanic(t *testing.T) {
+	db := newTransactionTestDB(t)
+	transactionManager := NewTransactionManager(db)
+
+	assert.Panics(t, func() {
+		transactionManager.WithinTransaction(context.Background(), func(ctx context.Context, repositories *Repositories) error {
+			product, _ := entity.NewProduct("Product 1", 10)
+			repositories.Products.Create(ctx, product)
+			panic("boom")
+		})
+	})
+
+	assert.Equal(t, int64(0), countProducts(db))
+}
+
+func TestNestedTransactionRollsBackToSavepoint(t *testing.T) {
+	db := newTransactionTestDB(t)
+	transactionManager := NewTransactionManager(db)
+
+	err := transactionManager.WithinTransaction(context.Background(), func(ctx context.Context, repositories *Repositories) error {
+		product, _ := entity.NewProduct("Product 1", 10)
+		if err := repositories.Products.Create(ctx, product); err != nil {
+			return err
+		}
+
+		nestedErr := transactionManager.WithinTransaction(ctx, func(ctx context.Context, repositories *Repositories) error {
+			product, _ := entity.NewProduct("Product 2", 20)
+			if err := repositories.Products.Create(ctx, product); err != nil {
+				return err
+			}
+			return errors.New("nested failure")
+		})
+		assert.Error(t, nestedErr)
+
+		return nil
+	})
+	assert.NoError(t, err)
+
+	products, err := NewProduct(db).FindAll(context.Background(), 0, 0, "")
+	assert.NoError(t, err)
+	assert.Len(t, products, 1)
+	assert.Equal(t, "Product 1", products[0].Name)
+}
+
+func TestTransactionRetriesOnBusyDatabase(t *testing.T) {
+	db := newTransactionTestDB(t)
+	transactionManager := NewTransactionManager(db)
+
+	attempts := 0
+	err := transactionManager.WithinTransaction(context.Background(), func(ctx context.Context, repositories *Repositories) error {
+		attempts++
+		if attempts < 3 {
+			return sqlite3.Error{Code: sqlite3.ErrBusy}
+		}
+		product, _ := entity.NewProduct("Product 1", 10)
+		return repositories.Products.Create(ctx, product)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, int64(1), countProducts(db))
+}
+
+func TestTransactionGivesUpAfterMaxRetries(t *testing.T) {
+	db := newTransactionTestDB(t)
+	transactionManager := NewTransactionManager(db)
+	transactionManager.MaxRetries = 1
+
+	attempts := 0
+	err := transactionManager.WithinTransaction(context.Background(), func(ctx context.Context, repositories *Repositories) error {
+		attempts++
+		return sqlite3.Error{Code: sqlite3.ErrBusy}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 2, attempts)
+}
@@ -1,8 +1,14 @@
 package database
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/tracing"
 	"gorm.io/gorm"
+	"reflect"
+	"strings"
 )
 
 type User struct {
@@ -13,16 +19,152 @@ func NewUser(db *gorm.DB) *User {
 	return &User{DB: db}
 }
 
-func (u *User) Create(user *entity.User) error {
-	return u.DB.Create(user).Error
+func (u *User) Create(ctx context.Context, user *entity.User) error {
+	ctx, span := tracing.Start(ctx, "UserRepository.Create")
+	defer span.End()
+
+	user.Email = entity.NormalizeEmail(user.Email)
+
+	err := u.DB.WithContext(ctx).Create(user).Error
+	if isUniqueViolation(err) {
+		return entity.ErrEmailAlreadyInUse
+	}
+	return err
 }
 
-func (u *User) FindByEmail(email string) (*entity.User, error) {
+func (u *User) FindByEmail(ctx context.Context, email string) (*entity.User, error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.FindByEmail")
+	defer span.End()
+
 	var user entity.User
 
-	if err := u.DB.Where("email = ?", email).First(&user).Error; err != nil {
+	if err := u.DB.WithContext(ctx).Where("email = ?", entity.NormalizeEmail(email)).First(&user).Error; err != nil {
 		return nil, err
 	}
 
 	return &user, nil
 }
+
+func (u *User) FindByID(ctx context.Context, id string) (*entity.User, error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.FindByID")
+	defer span.End()
+
+	var user entity.User
+	if err := u.DB.WithContext(ctx).First(&user, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Search returns a page of users whose name or email contains query, along
+// with the total number of matches. A zero page or limit returns every match.
+func (u *User) Search(ctx context.Context, query string, page, limit int) ([]entity.User, int64, error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.Search")
+	defer span.End()
+
+	db := u.DB.WithContext(ctx).Model(&entity.User{})
+	if query != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(query))
+		pattern := "%" + escaped + "%"
+		db = db.Where(`LOWER(name) LIKE ? ESCAPE '\' OR email LIKE ? ESCAPE '\'`, pattern, pattern)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if page != 0 && limit != 0 {
+		db = db.Limit(limit).Offset((page - 1) * limit)
+	}
+
+	var users []entity.User
+	err := db.Order("email").Find(&users).Error
+	return users, total, err
+}
+
+// Update writes the fields of user named by fields, leaving the other
+// columns to whoever changes them concurrently. A SessionVersion among
+// fields is incremented in the database rather than overwritten, so a
+// revocation is never undone, and user is then reloaded.
+func (u *User) Update(ctx context.Context, user *entity.User, fields ...string) error {
+	ctx, span := tracing.Start(ctx, "UserRepository.Update")
+	defer span.End()
+
+	return u.update(ctx, user, u.DB.WithContext(ctx).Where("id = ?", user.ID), fields)
+}
+
+// Suspend stores the suspension of user made by entity.User.Suspend, unless
+// it was suspended concurrently, and reloads it.
+func (u *User) Suspend(ctx context.Context, user *entity.User) error {
+	ctx, span := tracing.Start(ctx, "UserRepository.Suspend")
+	defer span.End()
+
+	return u.update(ctx, user, u.DB.WithContext(ctx).Where("id = ? AND suspended_at IS NULL", user.ID), []string{"SuspendedAt", "SessionVersion", "SessionsRevokedAt"})
+}
+
+// Reactivate stores the lift of the suspension of user made by
+// entity.User.Reactivate, unless it was lifted concurrently.
+func (u *User) Reactivate(ctx context.Context, user *entity.User) error {
+	ctx, span := tracing.Start(ctx, "UserRepository.Reactivate")
+	defer span.End()
+
+	return u.update(ctx, user, u.DB.WithContext(ctx).Where("id = ? AND suspended_at IS NOT NULL", user.ID), []string{"SuspendedAt"})
+}
+
+func (u *User) update(ctx context.Context, user *entity.User, db *gorm.DB, fields []string) error {
+	user.Email = entity.NormalizeEmail(user.Email)
+
+	value := reflect.ValueOf(user).Elem()
+	columns := make(map[string]interface{}, len(fields))
+	revoked := false
+	for _, name := range fields {
+		if name == "SessionVersion" {
+			columns[name] = gorm.Expr("session_version + 1")
+			revoked = true
+			continue
+		}
+
+		field := value.FieldByName(name)
+		if !field.IsValid() {
+			return fmt.Errorf("user has no field %s", name)
+		}
+		columns[name] = field.Interface()
+	}
+
+	err := db.Model(&entity.User{}).Updates(columns).Error
+	if isUniqueViolation(err) {
+		return entity.ErrEmailAlreadyInUse
+	}
+	if err != nil || !revoked {
+		return err
+	}
+	return u.DB.WithContext(ctx).First(user, "id = ?", user.ID).Error
+}
+
+// UseMFAStep records step as the last TOTP step accepted for the user id
+// and reports whether it was later than the recorded one, so each code is
+// accepted at most once even under concurrent attempts.
+func (u *User) UseMFAStep(ctx context.Context, id string, step int64) (bool, error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.UseMFAStep")
+	defer span.End()
+
+	result := u.DB.WithContext(ctx).
+		Model(&entity.User{}).
+		Where("id = ? AND mfa_last_step < ?", id, step).
+		Update("mfa_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (u *User) Delete(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "UserRepository.Delete")
+	defer span.End()
+
+	return u.DB.WithContext(ctx).Delete(&entity.User{}, "id = ?", id).Error
+}
@@ -1,11 +1,13 @@
 package database
 
 import (
+	"context"
 	"github.com/andre2ar/go-products/internal/entity"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"testing"
+	"time"
 )
 
 func TestCreateUser(t *testing.T) {
@@ -18,7 +20,7 @@ func TestCreateUser(t *testing.T) {
 	user, _ := entity.NewUser("Jhon", "j@j.com", "123456")
 	userRepository := NewUser(db)
 
-	err = userRepository.Create(user)
+	err = userRepository.Create(context.Background(), user)
 	assert.Nil(t, err)
 
 	var userFound entity.User
@@ -40,10 +42,10 @@ func TestFindByEmail(t *testing.T) {
 	user, _ := entity.NewUser("Jhon", "j@j.com", "123456")
 	userRepository := NewUser(db)
 
-	err = userRepository.Create(user)
+	err = userRepository.Create(context.Background(), user)
 	assert.Nil(t, err)
 
-	userFound, _ := userRepository.FindByEmail(user.Email)
+	userFound, _ := userRepository.FindByEmail(context.Background(), user.Email)
 
 	assert.Nil(t, err)
 	assert.Equal(t, user.ID, userFound.ID)
@@ -51,3 +53,188 @@ func TestFindByEmail(t *testing.T) {
 	assert.Equal(t, user.Email, userFound.Email)
 	assert.True(t, user.ValidatePassword("123456"))
 }
+
+func TestCreateUserWithDuplicateEmail(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	db.AutoMigrate(&entity.User{})
+	userRepository := NewUser(db)
+
+	user, _ := entity.NewUser("Jhon", "j@j.com", "123456")
+	assert.Nil(t, userRepository.Create(context.Background(), user))
+
+	duplicate, _ := entity.NewUser("Jhon", "J@J.COM", "123456")
+	err = userRepository.Create(context.Background(), duplicate)
+	assert.ErrorIs(t, err, entity.ErrEmailAlreadyInUse)
+}
+
+func TestFindByEmailIgnoresCase(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	db.AutoMigrate(&entity.User{})
+	user, _ := entity.NewUser("Jhon", "j@j.com", "123456")
+	userRepository := NewUser(db)
+	assert.Nil(t, userRepository.Create(context.Background(), user))
+
+	userFound, err := userRepository.FindByEmail(context.Background(), " J@J.com")
+	assert.Nil(t, err)
+	assert.Equal(t, user.ID, userFound.ID)
+}
+
+func TestUpdateAndDeleteUser(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	db.AutoMigrate(&entity.User{})
+	user, _ := entity.NewUser("Jhon", "j@j.com", "123456")
+	userRepository := NewUser(db)
+	assert.Nil(t, userRepository.Create(context.Background(), user))
+
+	user.Name = "Jane"
+	assert.Nil(t, userRepository.Update(context.Background(), user, "Name"))
+	userFound, err := userRepository.FindByID(context.Background(), user.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, "Jane", userFound.Name)
+
+	assert.Nil(t, userRepository.Delete(context.Background(), user.ID.String()))
+	userFound, err = userRepository.FindByID(context.Background(), user.ID.String())
+	assert.Nil(t, err)
+	assert.Nil(t, userFound)
+}
+
+func TestUpdateUserKeepsConcurrentChanges(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	db.AutoMigrate(&entity.User{})
+	user, _ := entity.NewUser("Jhon", "j@j.com", "123456")
+	userRepository := NewUser(db)
+	ctx := context.Background()
+	assert.Nil(t, userRepository.Create(ctx, user))
+	stale := *user
+
+	user.Suspend(time.Now())
+	assert.Nil(t, userRepository.Suspend(ctx, user))
+	assert.Equal(t, 1, user.SessionVersion)
+
+	stale.Name = "Jane"
+	assert.Nil(t, userRepository.Update(ctx, &stale, "Name"))
+	found, err := userRepository.FindByID(ctx, user.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, "Jane", found.Name)
+	assert.True(t, found.IsSuspended(), "a stale copy does not lift the suspension")
+	assert.Equal(t, 1, found.SessionVersion)
+
+	stale.RequirePasswordReset()
+	assert.Nil(t, userRepository.Update(ctx, &stale, "PasswordResetRequired", "SessionVersion", "SessionsRevokedAt"))
+	assert.Equal(t, 2, stale.SessionVersion, "revocations add up")
+
+	again := *found
+	again.Suspend(time.Now().Add(time.Hour))
+	assert.Nil(t, userRepository.Suspend(ctx, &again))
+	assert.Equal(t, found.SuspendedAt.Unix(), again.SuspendedAt.Unix(), "a suspended user is not suspended again")
+	assert.Equal(t, 2, again.SessionVersion)
+
+	found.Reactivate()
+	assert.Nil(t, userRepository.Reactivate(ctx, found))
+	found, err = userRepository.FindByID(ctx, user.ID.String())
+	assert.Nil(t, err)
+	assert.False(t, found.IsSuspended())
+	assert.Error(t, userRepository.Update(ctx, found, "Nickname"))
+}
+
+func TestUseMFAStep(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	db.AutoMigrate(&entity.User{})
+	user, _ := entity.NewUser("Jhon", "j@j.com", "123456")
+	userRepository := NewUser(db)
+	ctx := context.Background()
+	assert.Nil(t, userRepository.Create(ctx, user))
+
+	used, err := userRepository.UseMFAStep(ctx, user.ID.String(), 10)
+	assert.Nil(t, err)
+	assert.True(t, used)
+	used, err = userRepository.UseMFAStep(ctx, user.ID.String(), 10)
+	assert.Nil(t, err)
+	assert.False(t, used, "a step is accepted once")
+	used, err = userRepository.UseMFAStep(ctx, user.ID.String(), 9)
+	assert.Nil(t, err)
+	assert.False(t, used)
+	used, err = userRepository.UseMFAStep(ctx, user.ID.String(), 11)
+	assert.Nil(t, err)
+	assert.True(t, used)
+}
+
+func TestSearchUsers(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	db.AutoMigrate(&entity.User{})
+	userRepository := NewUser(db)
+	for _, email := range []string{"a@j.com", "b@j.com", "c_d@x.com"} {
+		user, _ := entity.NewUser("Jhon", email, "123456")
+		assert.Nil(t, userRepository.Create(context.Background(), user))
+	}
+
+	users, total, err := userRepository.Search(context.Background(), "@J.COM", 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Len(t, users, 1)
+	assert.Equal(t, "a@j.com", users[0].Email)
+
+	users, total, err = userRepository.Search(context.Background(), "_", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, "c_d@x.com", users[0].Email)
+}
+
+func TestSeedAdmins(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	db.AutoMigrate(&entity.User{})
+	ctx := context.Background()
+	user, _ := entity.NewUser("Jhon", "j@j.com", "123456")
+	squatter, _ := entity.NewUser("Jane", "jane@j.com", "123456")
+	userRepository := NewUser(db)
+	assert.Nil(t, userRepository.Create(ctx, user))
+	assert.Nil(t, userRepository.Create(ctx, squatter))
+
+	assert.Nil(t, SeedAdmins(db, []string{"", " J@J.com", "jane@j.com"}))
+	userFound, err := userRepository.FindByID(ctx, user.ID.String())
+	assert.Nil(t, err)
+	assert.False(t, userFound.IsAdmin(), "unverified emails are not trusted")
+
+	user.VerifyEmail(time.Now())
+	assert.Nil(t, userRepository.Update(ctx, user, "EmailVerifiedAt"))
+	assert.Nil(t, SeedAdmins(db, []string{"", " J@J.com", "jane@j.com"}))
+	userFound, err = userRepository.FindByID(ctx, user.ID.String())
+	assert.Nil(t, err)
+	assert.True(t, userFound.IsAdmin())
+	squatterFound, err := userRepository.FindByID(ctx, squatter.ID.String())
+	assert.Nil(t, err)
+	assert.False(t, squatterFound.IsAdmin())
+
+	assert.Nil(t, SeedAdmins(db, []string{"jane@j.com"}))
+	userFound, err = userRepository.FindByID(ctx, user.ID.String())
+	assert.Nil(t, err)
+	assert.False(t, userFound.IsAdmin(), "admins whose email left the list are demoted")
+}
@@ -0,0 +1,157 @@
+// Package health runs the readiness checks of the API.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Statuses of a check or report. A degraded one is still ready to serve.
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusFailing  = "failing"
+)
+
+// ErrDraining fails readiness once the server started shutting down.
+var ErrDraining = errors.New("server is shutting down")
+
+// degradedError is an error reported without failing readiness.
+type degradedError struct {
+	err error
+}
+
+// Degraded marks err, returned by a check, as a degradation the server
+// keeps serving through rather than a failure.
+func Degraded(err error) error {
+	return degradedError{err: err}
+}
+
+func (e degradedError) Error() string {
+	return e.err.Error()
+}
+
+func (e degradedError) Unwrap() error {
+	return e.err
+}
+
+// Check reports whether a dependency is usable, returning why it is not.
+type Check func(ctx context.Context) error
+
+// Result is the outcome of one check.
+type Result struct {
+	Status     string  `json:"status" example:"ok"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms" example:"0.42"`
+}
+
+// Report is the outcome of every check, failing when any of them does and
+// otherwise degraded when any of them is.
+type Report struct {
+	Status string            `json:"status" example:"ok"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Health holds the checks deciding whether the server is ready to serve
+// traffic. Every check is run concurrently and bounded by Timeout.
+type Health struct {
+	Timeout time.Duration
+
+	mu       sync.RWMutex
+	names    []string
+	checks   map[string]Check
+	draining atomic.Bool
+}
+
+func New(timeout time.Duration) *Health {
+	return &Health{Timeout: timeout, checks: map[string]Check{}}
+}
+
+// Add registers check under name, replacing the check already registered
+// with that name.
+func (h *Health) Add(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.checks[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.checks[name] = check
+}
+
+// Drain makes readiness fail from now on, so load balancers stop sending
+// traffic before the server stops.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Ready runs the checks and reports their results, along with a failing
+// shutdown check once Drain was called.
+func (h *Health) Ready(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+
+	h.mu.RLock()
+	names := append([]string(nil), h.names...)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = h.checks[name]
+	}
+	h.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(names)+1)}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+	}
+	if h.draining.Load() {
+		report.Checks["shutdown"] = Result{Status: StatusFailing, Error: ErrDraining.Error()}
+	}
+	for _, result := range report.Checks {
+		switch {
+		case result.Status == StatusFailing:
+			report.Status = StatusFailing
+		case result.Status == StatusDegraded && report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// run runs check, giving up when ctx is done even if check does not honor
+// it.
+func run(ctx context.Context, check Check) Result {
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := Result{Status: StatusOK, DurationMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status = StatusFailing
+		if errors.As(err, new(degradedError)) {
+			result.Status = StatusDegraded
+		}
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,62 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestReadyReportsEveryCheck(t *testing.T) {
+	h := New(time.Second)
+	h.Add("database", func(ctx context.Context) error { return nil })
+
+	report := h.Ready(context.Background())
+	assert.Equal(t, StatusOK, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["database"].Status)
+
+	h.Add("worker", func(ctx context.Context) error { return errors.New("worker stopped") })
+	report = h.Ready(context.Background())
+	assert.Equal(t, StatusFailing, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["database"].Status)
+	assert.Equal(t, Result{Status: StatusFailing, Error: "worker stopped", DurationMS: report.Checks["worker"].DurationMS}, report.Checks["worker"])
+}
+
+func TestReadyReportsDegradedChecks(t *testing.T) {
+	h := New(time.Second)
+	h.Add("database", func(ctx context.Context) error { return nil })
+	h.Add("queue", func(ctx context.Context) error { return Degraded(errors.New("queue is full")) })
+
+	report := h.Ready(context.Background())
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.Equal(t, Result{Status: StatusDegraded, Error: "queue is full", DurationMS: report.Checks["queue"].DurationMS}, report.Checks["queue"])
+
+	h.Add("worker", func(ctx context.Context) error { return errors.New("worker stopped") })
+	report = h.Ready(context.Background())
+	assert.Equal(t, StatusFailing, report.Status)
+}
+
+func TestReadyBoundsHangingChecks(t *testing.T) {
+	h := New(20 * time.Millisecond)
+	h.Add("hanging", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	start := time.Now()
+	report := h.Ready(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, StatusFailing, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["hanging"].Error)
+}
+
+func TestDrainFailsReadiness(t *testing.T) {
+	h := New(time.Second)
+	h.Add("database", func(ctx context.Context) error { return nil })
+	h.Drain()
+
+	report := h.Ready(context.Background())
+	assert.Equal(t, StatusFailing, report.Status)
+	assert.Equal(t, ErrDraining.Error(), report.Checks["shutdown"].Error)
+}
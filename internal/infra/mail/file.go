@@ -0,0 +1,30 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"github.com/andre2ar/go-products/pkg/entity"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer drops every message as an .eml file in Dir, for local
+// development without an SMTP server.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{Dir: dir, From: from}
+}
+
+func (m *FileMailer) Send(_ context.Context, message Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), entity.NewID())
+	return os.WriteFile(filepath.Join(m.Dir, name), format(m.From, message), 0o600)
+}
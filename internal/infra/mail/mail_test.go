@@ -0,0 +1,135 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// smtpStandIn accepts a single SMTP session on a local port and records the
+// envelope and data it receives.
+type smtpStandIn struct {
+	listener net.Listener
+	from     string
+	to       string
+	data     string
+	done     chan struct{}
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	s := &smtpStandIn{listener: listener, done: make(chan struct{})}
+	go s.serve()
+	return s
+}
+
+func (s *smtpStandIn) serve() {
+	defer close(s.done)
+
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			s.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			s.to = strings.Trim(line[len("RCPT TO:"):], "<>")
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.data = data.String()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	server := newSMTPStandIn(t)
+	mailer := NewSMTPMailer(server.listener.Addr().String(), "no-reply@go-products.local", "", "")
+
+	err := mailer.Send(context.Background(), Message{
+		To:      "j@j.com",
+		Subject: "Reset your password",
+		Body:    "Use this link\nto reset it.",
+	})
+	require.NoError(t, err)
+	<-server.done
+
+	assert.Equal(t, "no-reply@go-products.local", server.from)
+	assert.Equal(t, "j@j.com", server.to)
+	assert.Contains(t, server.data, "To: j@j.com\r\n")
+	assert.Contains(t, server.data, "Subject: Reset your password\r\n")
+	assert.Contains(t, server.data, "Use this link\r\nto reset it.")
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := NewFileMailer(dir, "no-reply@go-products.local")
+
+	err := mailer.Send(context.Background(), Message{To: "j@j.com", Subject: "Hello", Body: "Hi"})
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	content, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "To: j@j.com\r\n")
+}
+
+func TestMemoryMailer(t *testing.T) {
+	mailer := NewMemoryMailer()
+
+	require.NoError(t, mailer.Send(context.Background(), Message{To: "j@j.com", Subject: "Hello", Body: "Hi"}))
+
+	assert.Equal(t, []Message{{To: "j@j.com", Subject: "Hello", Body: "Hi"}}, mailer.Messages())
+}
+
+func TestFormatStripsHeaderInjection(t *testing.T) {
+	message := string(format("from@j.com", Message{To: "j@j.com\r\nBcc: evil@j.com", Subject: "Hi", Body: "Hi"}))
+
+	assert.NotContains(t, message, "\r\nBcc:")
+}
@@ -0,0 +1,118 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"github.com/andre2ar/go-products/internal/infra/health"
+	"github.com/andre2ar/go-products/pkg/logging"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrQueueFull   = errors.New("mail queue is full")
+	ErrQueueClosed = errors.New("mail queue is closed")
+)
+
+// Queue is a Mailer handing messages over to a background worker, so
+// callers never wait on the mail server and answer at the same speed
+// whether or not they sent something. The worker delivers through Mailer,
+// each message bounded by Timeout, and logs the failures with the logger of
+// the context the message was queued with.
+type Queue struct {
+	Mailer  Mailer
+	Timeout time.Duration
+
+	messages chan queuedMessage
+	mu       sync.RWMutex
+	closed   bool
+	running  atomic.Bool
+	done     chan struct{}
+}
+
+type queuedMessage struct {
+	ctx     context.Context
+	message Message
+}
+
+func NewQueue(mailer Mailer, size int, timeout time.Duration) *Queue {
+	return &Queue{
+		Mailer:   mailer,
+		Timeout:  timeout,
+		messages: make(chan queuedMessage, size),
+		done:     make(chan struct{}),
+	}
+}
+
+// Send queues message without waiting, failing when the queue is full or
+// closed.
+func (q *Queue) Send(ctx context.Context, message Message) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+	select {
+	case q.messages <- queuedMessage{ctx: context.WithoutCancel(ctx), message: message}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Run delivers the queued messages until the queue is closed and drained.
+func (q *Queue) Run() {
+	q.running.Store(true)
+	defer func() {
+		q.running.Store(false)
+		close(q.done)
+	}()
+
+	for queued := range q.messages {
+		q.deliver(queued)
+	}
+}
+
+func (q *Queue) deliver(queued queuedMessage) {
+	ctx, cancel := context.WithTimeout(queued.ctx, q.Timeout)
+	defer cancel()
+
+	err := q.Mailer.Send(ctx, queued.message)
+	if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "could not send mail", slog.String("subject", queued.message.Subject), slog.Any("error", err))
+	}
+}
+
+// Close stops accepting messages and waits until Run has delivered the
+// queued ones or ctx is done.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.messages)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Check reports whether the worker is running, and as degraded when it is
+// not keeping up; Send refuses messages until the queue drains but the
+// server can keep serving.
+func (q *Queue) Check(context.Context) error {
+	if !q.running.Load() {
+		return errors.New("mail worker is not running")
+	}
+	if len(q.messages) == cap(q.messages) {
+		return health.Degraded(ErrQueueFull)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"github.com/andre2ar/go-products/internal/infra/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// blockingMailer waits for release before sending anything.
+type blockingMailer struct {
+	release chan struct{}
+	sent    *MemoryMailer
+}
+
+func (m *blockingMailer) Send(ctx context.Context, message Message) error {
+	select {
+	case <-m.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return m.sent.Send(ctx, message)
+}
+
+func TestQueueDeliversInTheBackground(t *testing.T) {
+	mailer := &blockingMailer{release: make(chan struct{}), sent: NewMemoryMailer()}
+	queue := NewQueue(mailer, 2, time.Second)
+	assert.EqualError(t, queue.Check(context.Background()), "mail worker is not running")
+	go queue.Run()
+	require.Eventually(t, func() bool { return queue.Check(context.Background()) == nil }, time.Second, time.Millisecond)
+
+	require.NoError(t, queue.Send(context.Background(), Message{To: "j@j.com", Subject: "First"}))
+	require.NoError(t, queue.Send(context.Background(), Message{To: "j@j.com", Subject: "Second"}))
+	assert.Empty(t, mailer.sent.Messages(), "Send does not wait for delivery")
+
+	close(mailer.release)
+	require.NoError(t, queue.Close(context.Background()))
+	require.Len(t, mailer.sent.Messages(), 2, "Close waits for the queued messages")
+	assert.ErrorIs(t, queue.Send(context.Background(), Message{To: "j@j.com"}), ErrQueueClosed)
+	assert.Error(t, queue.Check(context.Background()))
+}
+
+func TestQueueRefusesMessagesWhenFull(t *testing.T) {
+	queue := NewQueue(NewMemoryMailer(), 1, time.Second)
+
+	require.NoError(t, queue.Send(context.Background(), Message{To: "j@j.com"}))
+	assert.ErrorIs(t, queue.Send(context.Background(), Message{To: "j@j.com"}), ErrQueueFull)
+}
+
+func TestQueueReportsDegradedWhenFull(t *testing.T) {
+	mailer := &blockingMailer{release: make(chan struct{}), sent: NewMemoryMailer()}
+	queue := NewQueue(mailer, 1, time.Second)
+	go queue.Run()
+	defer func() {
+		close(mailer.release)
+		queue.Close(context.Background())
+	}()
+
+	require.NoError(t, queue.Send(context.Background(), Message{To: "j@j.com"}))
+	require.Eventually(t, func() bool {
+		return queue.Send(context.Background(), Message{To: "j@j.com"}) == nil
+	}, time.Second, time.Millisecond, "the worker takes the first message")
+
+	assert.ErrorIs(t, queue.Check(context.Background()), ErrQueueFull)
+	checks := health.New(time.Second)
+	checks.Add("mail_queue", queue.Check)
+	assert.Equal(t, health.StatusDegraded, checks.Ready(context.Background()).Status, "a full queue does not fail readiness")
+}
+
+func TestQueueCloseGivesUpWithTheContext(t *testing.T) {
+	mailer := &blockingMailer{release: make(chan struct{}), sent: NewMemoryMailer()}
+	queue := NewQueue(mailer, 1, time.Minute)
+	go queue.Run()
+	require.NoError(t, queue.Send(context.Background(), Message{To: "j@j.com"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.True(t, errors.Is(queue.Close(ctx), context.DeadlineExceeded))
+	close(mailer.release)
+}
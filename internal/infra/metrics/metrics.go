@@ -0,0 +1,125 @@
+// Package metrics defines the Prometheus metrics of the API and serves them.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+// collectTimeout bounds the queries run while serving a scrape.
+const collectTimeout = 5 * time.Second
+
+// Login methods and results labelling LoginAttempts.
+const (
+	LoginPassword = "password"
+	LoginMFA      = "mfa"
+	LoginOIDC     = "oidc"
+
+	LoginSuccess     = "success"
+	LoginFailure     = "failure"
+	LoginThrottled   = "throttled"
+	LoginMFARequired = "mfa_required"
+	LoginRejected    = "rejected"
+)
+
+// Metrics holds the collectors of the API, registered on a registry of its
+// own rather than the global one so several servers can run in one process.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	HTTPRequests        *prometheus.CounterVec
+	HTTPRequestDuration *prometheus.HistogramVec
+	DBQueryDuration     *prometheus.HistogramVec
+	DBQueryErrors       *prometheus.CounterVec
+	LoginAttempts       *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		HTTPRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests served, by method, route pattern and status.",
+		}, []string{"method", "route", "status"}),
+		HTTPRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Time spent serving HTTP requests, by method, route pattern and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		DBQueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "db_query_duration_seconds",
+			Help:    "Time spent running database statements, by operation and table.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"operation", "table"}),
+		DBQueryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "db_query_errors_total",
+			Help: "Database statements that failed, by operation and table.",
+		}, []string{"operation", "table"}),
+		LoginAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auth_login_attempts_total",
+			Help: "Login attempts, by method (password, mfa or oidc) and result.",
+		}, []string{"method", "result"}),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.HTTPRequests,
+		m.HTTPRequestDuration,
+		m.DBQueryDuration,
+		m.DBQueryErrors,
+		m.LoginAttempts,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format. Collectors
+// failing to collect are reported in the logs and skipped.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})
+}
+
+// Login counts a login attempt with method ending with result.
+func (m *Metrics) Login(method, result string) {
+	m.LoginAttempts.WithLabelValues(method, result).Inc()
+}
+
+// RegisterDB exports the connection pool statistics of db.
+func (m *Metrics) RegisterDB(db *sql.DB, name string) error {
+	return m.Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterCount exports a gauge called name whose value is computed by count
+// on every scrape.
+func (m *Metrics) RegisterCount(name, help string, count func(ctx context.Context) (int64, error)) error {
+	return m.Registry.Register(&countCollector{
+		desc:  prometheus.NewDesc(name, help, nil, nil),
+		count: count,
+	})
+}
+
+type countCollector struct {
+	desc  *prometheus.Desc
+	count func(ctx context.Context) (int64, error)
+}
+
+func (c *countCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *countCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	n, err := c.count(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n))
+}
@@ -0,0 +1,114 @@
+// Package tracing sets up OpenTelemetry tracing and starts the spans of the
+// API.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+)
+
+// InstrumentationName names the tracer of the spans started by the API.
+const InstrumentationName = "github.com/andre2ar/go-products"
+
+// Exporters selectable through Config.Exporter.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// Config selects where spans are exported. Endpoint is the OTLP/HTTP
+// collector URL, defaulting to the OTEL_EXPORTER_OTLP_* variables, and File
+// the file the file exporter appends to. SampleRatio applies to every
+// trace, including those the caller marked sampled, so clients can not
+// force spans to be recorded.
+type Config struct {
+	Exporter    string
+	Endpoint    string
+	File        string
+	ServiceName string
+	SampleRatio float64
+}
+
+// Provider is a tracer provider that also releases the resources of its
+// exporter on shutdown.
+type Provider struct {
+	*sdktrace.TracerProvider
+	file *os.File
+}
+
+// NewProvider returns a provider batching spans to the exporter of config.
+// The none exporter yields a provider recording nothing.
+func NewProvider(ctx context.Context, config Config) (*Provider, error) {
+	provider := &Provider{}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case ExporterNone, "":
+		provider.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.NeverSample()))
+		return provider, nil
+	case ExporterOTLP:
+		var options []otlptracehttp.Option
+		if config.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(config.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterFile:
+		provider.file, err = os.OpenFile(config.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("tracing: %w", err)
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(provider.file))
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q", config.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+
+	ratio := sdktrace.TraceIDRatioBased(config.SampleRatio)
+	provider.TracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(ratio, sdktrace.WithRemoteParentSampled(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(config.ServiceName))),
+	)
+	return provider, nil
+}
+
+// Shutdown flushes the pending spans and stops the exporter.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	err := p.TracerProvider.Shutdown(ctx)
+	if p.file != nil {
+		err = errors.Join(err, p.file.Close())
+	}
+	return err
+}
+
+// Start starts a span called name, child of the span of ctx and recorded by
+// the same provider. Outside of a traced request, it starts a span recording
+// nothing, so callers need no provider of their own.
+func Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(InstrumentationName).Start(ctx, name, options...)
+}
+
+// TraceID returns the ID of the trace of ctx, or an empty string when ctx
+// carries none.
+func TraceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileExporterWritesSpansOnShutdown(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "traces.json")
+	provider, err := NewProvider(context.Background(), Config{Exporter: ExporterFile, File: file, ServiceName: "test", SampleRatio: 1})
+	require.NoError(t, err)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+	child.End()
+	parent.End()
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	var names []string
+	for decoder.More() {
+		var span struct{ Name string }
+		require.NoError(t, decoder.Decode(&span))
+		names = append(names, span.Name)
+	}
+	assert.Equal(t, []string{"child", "parent"}, names)
+	assert.Equal(t, TraceID(ctx), parent.SpanContext().TraceID().String())
+}
+
+func TestSampleRatioZeroRecordsNothing(t *testing.T) {
+	provider, err := NewProvider(context.Background(), Config{Exporter: ExporterStdout, SampleRatio: 0})
+	require.NoError(t, err)
+	defer provider.Shutdown(context.Background())
+
+	_, span := provider.Tracer("test").Start(context.Background(), "span")
+	assert.False(t, span.IsRecording())
+}
+
+func TestSampleRatioAppliesToRemotelySampledTraces(t *testing.T) {
+	provider, err := NewProvider(context.Background(), Config{Exporter: ExporterStdout, SampleRatio: 0})
+	require.NoError(t, err)
+	defer provider.Shutdown(context.Background())
+
+	remote := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), remote)
+	_, span := provider.Tracer("test").Start(ctx, "span")
+	assert.False(t, span.IsRecording(), "the caller can not force sampling")
+}
+
+func TestStartWithoutParentRecordsNothing(t *testing.T) {
+	ctx, span := Start(context.Background(), "orphan")
+	defer span.End()
+
+	assert.False(t, span.IsRecording())
+	assert.Empty(t, TraceID(ctx))
+}
+
+func TestUnknownExporter(t *testing.T) {
+	_, err := NewProvider(context.Background(), Config{Exporter: "zipkin"})
+	assert.ErrorContains(t, err, `unknown exporter "zipkin"`)
+}
@@ -0,0 +1,101 @@
+// Package accesstoken issues the API's access tokens and validates them.
+package accesstoken
+
+import (
+	"github.com/andre2ar/go-products/pkg/jwtkeys"
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"sync"
+	"time"
+)
+
+// Authority issues access tokens signed by Keys and naming Issuer and
+// Audience, valid for TTL. Validation tolerates clocks differing by up to
+// ClockSkew.
+type Authority struct {
+	Keys      *jwtkeys.KeyRing
+	Issuer    string
+	Audience  string
+	TTL       time.Duration
+	ClockSkew time.Duration
+
+	mu  sync.RWMutex
+	now func() time.Time
+}
+
+func NewAuthority(keys *jwtkeys.KeyRing, issuer, audience string, ttl, clockSkew time.Duration) *Authority {
+	return &Authority{
+		Keys:      keys,
+		Issuer:    issuer,
+		Audience:  audience,
+		TTL:       ttl,
+		ClockSkew: clockSkew,
+		now:       time.Now,
+	}
+}
+
+// SetLifetime changes the TTL of the tokens issued from now on and the
+// clock skew tolerated when validating them.
+func (a *Authority) SetLifetime(ttl, clockSkew time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.TTL = ttl
+	a.ClockSkew = clockSkew
+}
+
+func (a *Authority) lifetime() (ttl, clockSkew time.Duration) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.TTL, a.ClockSkew
+}
+
+// Issue signs a token for subject carrying the registered claims plus
+// claims, and returns it with its parsed form.
+func (a *Authority) Issue(subject string, claims map[string]interface{}) (string, jwt.Token, error) {
+	now := a.now()
+	ttl, _ := a.lifetime()
+
+	token, err := jwt.NewBuilder().
+		JwtID(uuid.NewString()).
+		Issuer(a.Issuer).
+		Audience([]string{a.Audience}).
+		Subject(subject).
+		IssuedAt(now).
+		NotBefore(now).
+		Expiration(now.Add(ttl)).
+		Build()
+	if err != nil {
+		return "", nil, err
+	}
+	for claim, value := range claims {
+		if err := token.Set(claim, value); err != nil {
+			return "", nil, err
+		}
+	}
+
+	signed, err := a.Keys.Sign(token)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(signed), token, nil
+}
+
+// Parse verifies the signature of token and validates its claims: it must
+// name the expected issuer and audience, carry a subject and an ID, and be
+// within its iat, nbf and exp bounds.
+func (a *Authority) Parse(token string) (jwt.Token, error) {
+	_, clockSkew := a.lifetime()
+	return a.Keys.Parse([]byte(token),
+		jwt.WithValidate(true),
+		jwt.WithClock(jwt.ClockFunc(a.now)),
+		jwt.WithAcceptableSkew(clockSkew),
+		jwt.WithIssuer(a.Issuer),
+		jwt.WithAudience(a.Audience),
+		jwt.WithRequiredClaim(jwt.SubjectKey),
+		jwt.WithRequiredClaim(jwt.JwtIDKey),
+		jwt.WithRequiredClaim(jwt.IssuedAtKey),
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+	)
+}
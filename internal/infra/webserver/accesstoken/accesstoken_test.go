@@ -0,0 +1,100 @@
+package accesstoken
+
+import (
+	"github.com/andre2ar/go-products/pkg/jwtkeys"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newTestAuthority(t *testing.T, issuer, audience string) *Authority {
+	t.Helper()
+
+	key, err := jwtkeys.NewHMACKey("default", []byte("secret"), time.Time{})
+	require.NoError(t, err)
+	keys, err := jwtkeys.NewKeyRing(time.Hour, key)
+	require.NoError(t, err)
+
+	return NewAuthority(keys, issuer, audience, 5*time.Minute, 30*time.Second)
+}
+
+func TestIssueAndParse(t *testing.T) {
+	authority := newTestAuthority(t, "https://issuer", "api")
+
+	signed, issued, err := authority.Issue("user", map[string]interface{}{"sv": 2})
+	require.NoError(t, err)
+
+	token, err := authority.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "user", token.Subject())
+	assert.Equal(t, "https://issuer", token.Issuer())
+	assert.Equal(t, []string{"api"}, token.Audience())
+	assert.Equal(t, issued.JwtID(), token.JwtID())
+	assert.NotEmpty(t, token.JwtID())
+	assert.Equal(t, token.IssuedAt(), token.NotBefore())
+	assert.Equal(t, token.IssuedAt().Add(5*time.Minute), token.Expiration())
+	sv, _ := token.Get("sv")
+	assert.Equal(t, float64(2), sv)
+
+	other, _, err := authority.Issue("user", nil)
+	require.NoError(t, err)
+	otherToken, err := authority.Parse(other)
+	require.NoError(t, err)
+	assert.NotEqual(t, token.JwtID(), otherToken.JwtID())
+}
+
+func TestParseRejectsOtherIssuersAndAudiences(t *testing.T) {
+	authority := newTestAuthority(t, "https://issuer", "api")
+
+	for _, other := range []*Authority{
+		newTestAuthority(t, "https://other", "api"),
+		newTestAuthority(t, "https://issuer", "other-api"),
+	} {
+		signed, _, err := other.Issue("user", nil)
+		require.NoError(t, err)
+		_, err = authority.Parse(signed)
+		assert.Error(t, err)
+	}
+}
+
+func TestParseToleratesClockSkew(t *testing.T) {
+	authority := newTestAuthority(t, "https://issuer", "api")
+	now := time.Now()
+	authority.now = func() time.Time { return now }
+	signed, _, err := authority.Issue("user", nil)
+	require.NoError(t, err)
+
+	// Tokens are valid from iat to exp, 5 minutes later, give or take the
+	// 30 seconds of tolerated skew.
+	for offset, valid := range map[time.Duration]bool{
+		-time.Minute:                   false,
+		-20 * time.Second:              true,
+		5*time.Minute + 20*time.Second: true,
+		6 * time.Minute:                false,
+	} {
+		at := now.Add(offset)
+		authority.now = func() time.Time { return at }
+		_, err := authority.Parse(signed)
+		assert.Equal(t, valid, err == nil, "offset %s", offset)
+	}
+}
+
+func TestParseRequiresTokenID(t *testing.T) {
+	authority := newTestAuthority(t, "https://issuer", "api")
+
+	token, err := jwt.NewBuilder().
+		Issuer("https://issuer").
+		Audience([]string{"api"}).
+		Subject("user").
+		IssuedAt(time.Now()).
+		Expiration(time.Now().Add(time.Minute)).
+		Build()
+	require.NoError(t, err)
+	signed, err := authority.Keys.Sign(token)
+	require.NoError(t, err)
+
+	_, err = authority.Parse(string(signed))
+	assert.Error(t, err)
+}
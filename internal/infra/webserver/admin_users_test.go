@@ -0,0 +1,116 @@
+package webserver
+
+import (
+	"encoding/json"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func newAdminTestServer(t *testing.T) (*testServer, string) {
+	t.Helper()
+
+	server := newTestServer(t)
+	signUp(t, server, "Admin", "admin@j.com", "secret123")
+	markEmailVerified(t, server, "admin@j.com")
+	require.NoError(t, database.SeedAdmins(server.DB, []string{"ADMIN@j.com"}))
+
+	return server, login(t, server, "admin@j.com", "secret123")
+}
+
+func findUserID(t *testing.T, server *testServer, adminToken, email string) string {
+	t.Helper()
+
+	res := doRequest(t, http.MethodGet, server.URL+"/api/v1/admin/users?q="+email, adminToken, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var users []entity.User
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&users))
+	require.Len(t, users, 1)
+
+	return users[0].ID.String()
+}
+
+func TestAdminRoutesRequireAdminRole(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+
+	res := doRequest(t, http.MethodGet, server.URL+"/api/v1/admin/users", token, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	assert.Equal(t, "forbidden", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/admin/users", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestAdminListsAndSearchesUsers(t *testing.T) {
+	server, adminToken := newAdminTestServer(t)
+	signUp(t, server, "John Doe", "john@j.com", "secret123")
+	signUp(t, server, "Jane Doe", "jane@j.com", "secret123")
+
+	res := doRequest(t, http.MethodGet, server.URL+"/api/v1/admin/users?page=1&limit=2", adminToken, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "3", res.Header.Get("X-Total-Count"))
+	var users []entity.User
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&users))
+	require.Len(t, users, 2)
+	assert.Equal(t, "admin@j.com", users[0].Email)
+	assert.Equal(t, entity.RoleAdmin, users[0].Role)
+
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/admin/users?q=doe", adminToken, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "2", res.Header.Get("X-Total-Count"))
+
+	id := findUserID(t, server, adminToken, "jane@")
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/admin/users/"+id, adminToken, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var user entity.User
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&user))
+	assert.Equal(t, "Jane Doe", user.Name)
+
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/admin/users/unknown", adminToken, nil)
+	assert.Equal(t, "user_not_found", decodeProblem(t, res).Code)
+}
+
+func TestAdminSuspendsAndReactivatesUsers(t *testing.T) {
+	server, adminToken := newAdminTestServer(t)
+	signUp(t, server, "John Doe", "john@j.com", "secret123")
+	userToken := login(t, server, "john@j.com", "secret123")
+	id := findUserID(t, server, adminToken, "john@")
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/admin/users/"+id+"/suspend", adminToken, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var user entity.User
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&user))
+	assert.NotNil(t, user.SuspendedAt)
+
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/products", userToken, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{Email: "john@j.com", Password: "secret123"})
+	assert.Equal(t, "account_suspended", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/admin/users/"+id+"/reactivate", adminToken, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	login(t, server, "john@j.com", "secret123")
+}
+
+func TestAdminForcesPasswordReset(t *testing.T) {
+	server, adminToken := newAdminTestServer(t)
+	signUp(t, server, "John Doe", "john@j.com", "secret123")
+	userToken := login(t, server, "john@j.com", "secret123")
+	id := findUserID(t, server, adminToken, "john@")
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/admin/users/"+id+"/password-reset", adminToken, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/users/me", userToken, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{Email: "john@j.com", Password: "secret123"})
+	assert.Equal(t, "password_reset_required", decodeProblem(t, res).Code)
+}
@@ -0,0 +1,133 @@
+package webserver
+
+import (
+	"encoding/json"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func createAPIKey(t *testing.T, server *testServer, token string, scopes ...string) dto.CreateAPIKeyResponse {
+	t.Helper()
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/users/me/api-keys", token, dto.CreateAPIKeyInput{
+		Name:   "CI",
+		Scopes: scopes,
+	})
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	var created dto.CreateAPIKeyResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&created))
+	require.NotEmpty(t, created.Key)
+
+	return created
+}
+
+func listAPIKeys(t *testing.T, server *testServer, token string) []entity.APIKey {
+	t.Helper()
+
+	res := doRequest(t, http.MethodGet, server.URL+"/api/v1/users/me/api-keys", token, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var keys []entity.APIKey
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&keys))
+
+	return keys
+}
+
+func TestAPIKeysAccessProducts(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+	created := createAPIKey(t, server, token, entity.ScopeProductsRead, entity.ScopeProductsWrite)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/products", created.Key, dto.CreateProductInput{Name: "Product", Price: 10})
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/products", created.Key, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	keys := listAPIKeys(t, server, token)
+	require.Len(t, keys, 1)
+	assert.Equal(t, created.APIKey.Prefix, keys[0].Prefix)
+	assert.NotNil(t, keys[0].LastUsedAt)
+
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/users/me", created.Key, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "API keys only open the products routes")
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+	created := createAPIKey(t, server, token, entity.ScopeProductsRead)
+
+	res := doRequest(t, http.MethodGet, server.URL+"/api/v1/products", created.Key, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/products", created.Key, dto.CreateProductInput{Name: "Product", Price: 10})
+	assert.Equal(t, "insufficient_scope", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/users/me/api-keys", token, dto.CreateAPIKeyInput{
+		Name:   "Admin",
+		Scopes: []string{"users:write"},
+	})
+	assert.Equal(t, "scopes", decodeProblem(t, res).Errors[0].Field)
+}
+
+func TestRevokedAPIKeysAreRefusedImmediately(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+	created := createAPIKey(t, server, token, entity.ScopeProductsRead)
+
+	res := doRequest(t, http.MethodGet, server.URL+"/api/v1/products", created.Key, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = doRequest(t, http.MethodDelete, server.URL+"/api/v1/users/me/api-keys/"+created.APIKey.ID.String(), token, nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res = doRequest(t, http.MethodDelete, server.URL+"/api/v1/users/me/api-keys/"+created.APIKey.ID.String(), token, nil)
+	assert.Equal(t, "api_key_not_found", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/products", created.Key, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Empty(t, listAPIKeys(t, server, token))
+}
+
+func TestExpiredAndForgedAPIKeysAreRefused(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+	created := createAPIKey(t, server, token, entity.ScopeProductsRead)
+
+	res := doRequest(t, http.MethodGet, server.URL+"/api/v1/products", created.Key+"x", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	require.NoError(t, server.DB.Model(&entity.APIKey{}).Where("id = ?", created.APIKey.ID.String()).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/products", created.Key, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestAPIKeysAreRevokedWithSessions(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+	created := createAPIKey(t, server, token, entity.ScopeProductsRead)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/users/me/password", token, dto.ChangePasswordInput{
+		CurrentPassword: "secret123",
+		NewPassword:     "new-secret123",
+	})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	token = login(t, server, "j@j.com", "new-secret123")
+
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/products", created.Key, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Empty(t, listAPIKeys(t, server, token))
+
+	created = createAPIKey(t, server, token, entity.ScopeProductsRead)
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/products", created.Key, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode, "keys created afterwards work")
+
+	require.NoError(t, server.DB.Model(&entity.User{}).Where("email = ?", "j@j.com").Update("password_reset_required", true).Error)
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/products", created.Key, nil)
+	assert.Equal(t, "password_reset_required", decodeProblem(t, res).Code)
+}
@@ -0,0 +1,64 @@
+package webserver
+
+import (
+	"github.com/andre2ar/go-products/configs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+// corsRequest sends a request to path from a page of origin, as a preflight
+// for a POST when preflight is set.
+func corsRequest(t *testing.T, server *testServer, origin, path string, preflight bool) *http.Response {
+	t.Helper()
+
+	method := http.MethodGet
+	if preflight {
+		method = http.MethodOptions
+	}
+	req, err := http.NewRequest(method, server.URL+path, nil)
+	require.NoError(t, err)
+	req.Header.Set("Origin", origin)
+	if preflight {
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+
+	return res
+}
+
+func TestCORSAllowsConfiguredOrigins(t *testing.T) {
+	server := newTestServer(t, withConfig(func(config *configs.Conf) {
+		config.WebServerCORSOrigins = "https://app.example.com, http://localhost:3000"
+	}))
+
+	res := corsRequest(t, server, "https://app.example.com", "/api/v1/products", true)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, "https://app.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, res.Header.Get("Access-Control-Allow-Methods"), http.MethodPost)
+	assert.Contains(t, res.Header.Get("Access-Control-Allow-Headers"), "Authorization")
+	assert.Empty(t, res.Header.Get("Access-Control-Allow-Credentials"))
+
+	res = corsRequest(t, server, "http://localhost:3000", "/api/v1/products", false)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(t, "http://localhost:3000", res.Header.Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, res.Header.Get("Access-Control-Expose-Headers"), "Retry-After")
+	assert.Equal(t, "Origin", res.Header.Get("Vary"))
+
+	res = corsRequest(t, server, "https://evil.example.com", "/api/v1/products", true)
+	assert.NotEqual(t, http.StatusNoContent, res.StatusCode)
+	assert.Empty(t, res.Header.Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSIsDisabledByDefault(t *testing.T) {
+	server := newTestServer(t)
+
+	res := corsRequest(t, server, "https://app.example.com", "/healthz", false)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Empty(t, res.Header.Get("Access-Control-Allow-Origin"))
+}
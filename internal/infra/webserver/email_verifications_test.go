@@ -0,0 +1,111 @@
+package webserver
+
+import (
+	"encoding/json"
+	"github.com/andre2ar/go-products/configs"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func waitForVerificationToken(t *testing.T, mailer *mail.MemoryMailer, count int) string {
+	t.Helper()
+
+	return waitForLinkToken(t, mailer, "Verify your email", "http://localhost/verify-email", count)
+}
+
+func getCurrentUser(t *testing.T, server *testServer, token string) *entity.User {
+	t.Helper()
+
+	res := doRequest(t, http.MethodGet, server.URL+"/api/v1/users/me", token, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var user entity.User
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&user))
+
+	return &user
+}
+
+func TestEmailVerificationFlow(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+	assert.False(t, getCurrentUser(t, server, token).IsEmailVerified())
+
+	verificationToken := waitForVerificationToken(t, server.Mailer, 1)
+	assert.Equal(t, "j@j.com", server.Mailer.Messages()[0].To)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/email-verifications/"+verificationToken+"x", "", nil)
+	assert.Equal(t, "invalid_email_verification_token", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/email-verifications/"+verificationToken, "", nil)
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.True(t, getCurrentUser(t, server, token).IsEmailVerified())
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/email-verifications/"+verificationToken, "", nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+}
+
+func TestChangingEmailRequiresNewVerification(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+	oldToken := waitForVerificationToken(t, server.Mailer, 1)
+
+	res := doRequest(t, http.MethodPatch, server.URL+"/api/v1/users/me", token, map[string]string{"email": "jane@j.com"})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	newToken := waitForVerificationToken(t, server.Mailer, 2)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/email-verifications/"+oldToken, "", nil)
+	assert.Equal(t, "invalid_email_verification_token", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/email-verifications/"+newToken, "", nil)
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.True(t, getCurrentUser(t, server, token).IsEmailVerified())
+}
+
+func TestResendEmailVerification(t *testing.T) {
+	server := newTestServer(t)
+	signUp(t, server, "John Doe", "j@j.com", "secret123")
+	waitForVerificationToken(t, server.Mailer, 1)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/email-verifications", "", dto.EmailVerificationRequestInput{Email: "J@j.com"})
+	require.Equal(t, http.StatusAccepted, res.StatusCode)
+	verificationToken := waitForVerificationToken(t, server.Mailer, 2)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/email-verifications/"+verificationToken, "", nil)
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/email-verifications", "", dto.EmailVerificationRequestInput{Email: "j@j.com"})
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/email-verifications", "", dto.EmailVerificationRequestInput{Email: "unknown@j.com"})
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, server.Mailer.Messages(), 2)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/email-verifications", "", dto.EmailVerificationRequestInput{Email: "j@j.com"})
+	require.Equal(t, http.StatusAccepted, res.StatusCode)
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/email-verifications", "", dto.EmailVerificationRequestInput{Email: "j@j.com"})
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.NotEmpty(t, res.Header.Get("Retry-After"))
+}
+
+func TestCreateSessionRequiresVerifiedEmailWhenConfigured(t *testing.T) {
+	server := newTestServer(t, withConfig(func(config *configs.Conf) {
+		config.RequireEmailVerification = true
+	}))
+	signUp(t, server, "John Doe", "j@j.com", "secret123")
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{Email: "j@j.com", Password: "secret123"})
+	assert.Equal(t, "email_not_verified", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{Email: "j@j.com", Password: "wrong-password"})
+	assert.Equal(t, "invalid_credentials", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/email-verifications/"+waitForVerificationToken(t, server.Mailer, 1), "", nil)
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	login(t, server, "j@j.com", "secret123")
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/andre2ar/go-products/internal/apperror"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/database"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type AdminUserHandler struct {
+	UserRepository database.UserRepositoryInterface
+}
+
+func NewAdminUserHandler(userRepository database.UserRepositoryInterface) *AdminUserHandler {
+	return &AdminUserHandler{UserRepository: userRepository}
+}
+
+// ListUsers     godoc
+// @Summary      List users
+// @Description  Search users by name or email. The total number of matches is sent in the X-Total-Count header
+// @Tags         admin
+// @Produce      json
+// @Param        q         query     string  false  "name or email fragment"
+// @Param        page      query     string  false  "page number"
+// @Param        limit     query     string  false  "limit"
+// @Success      200       {array}   entity.User
+// @Failure      401       {object}  problem.Problem
+// @Failure      403       {object}  problem.Problem
+// @Failure      500       {object}  problem.Problem
+// @Router       /api/v1/admin/users [get]
+// @Security ApiKeyAuth
+func (h *AdminUserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil {
+		page = 0
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil {
+		limit = 0
+	}
+
+	users, total, err := h.UserRepository.Search(r.Context(), r.URL.Query().Get("q"), page, limit)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(users)
+}
+
+// GetUser       godoc
+// @Summary      Get a user
+// @Description  Get any user account
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      string  true  "user ID" Format(uuid)
+// @Success      200  {object}  entity.User
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /api/v1/admin/users/{id} [get]
+// @Security ApiKeyAuth
+func (h *AdminUserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	h.withUser(w, r, func(ctx context.Context, user *entity.User) error { return nil })
+}
+
+// SuspendUser   godoc
+// @Summary      Suspend a user
+// @Description  Block a user from logging in and revoke its sessions
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      string  true  "user ID" Format(uuid)
+// @Success      200  {object}  entity.User
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /api/v1/admin/users/{id}/suspend [post]
+// @Security ApiKeyAuth
+func (h *AdminUserHandler) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	h.withUser(w, r, func(ctx context.Context, user *entity.User) error {
+		if user.IsSuspended() {
+			return nil
+		}
+		user.Suspend(time.Now())
+		return h.UserRepository.Suspend(ctx, user)
+	})
+}
+
+// ReactivateUser godoc
+// @Summary      Reactivate a user
+// @Description  Lift the suspension of a user
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      string  true  "user ID" Format(uuid)
+// @Success      200  {object}  entity.User
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /api/v1/admin/users/{id}/reactivate [post]
+// @Security ApiKeyAuth
+func (h *AdminUserHandler) ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	h.withUser(w, r, func(ctx context.Context, user *entity.User) error {
+		if !user.IsSuspended() {
+			return nil
+		}
+		user.Reactivate()
+		return h.UserRepository.Reactivate(ctx, user)
+	})
+}
+
+// RequirePasswordReset godoc
+// @Summary      Force a password reset
+// @Description  Revoke the sessions of a user and block new ones until its password is reset
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      string  true  "user ID" Format(uuid)
+// @Success      200  {object}  entity.User
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /api/v1/admin/users/{id}/password-reset [post]
+// @Security ApiKeyAuth
+func (h *AdminUserHandler) RequirePasswordReset(w http.ResponseWriter, r *http.Request) {
+	h.withUser(w, r, func(ctx context.Context, user *entity.User) error {
+		user.RequirePasswordReset()
+		return h.UserRepository.Update(ctx, user, "PasswordResetRequired", "SessionVersion", "SessionsRevokedAt")
+	})
+}
+
+// withUser loads the user named in the URL, applies change, which stores
+// what it modifies, then writes the user back.
+func (h *AdminUserHandler) withUser(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, user *entity.User) error) {
+	user, err := h.UserRepository.FindByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if user == nil {
+		problem.Write(w, r, apperror.ErrUserNotFound)
+		return
+	}
+
+	err = change(r.Context(), user)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
+}
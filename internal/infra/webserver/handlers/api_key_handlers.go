@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/andre2ar/go-products/internal/apperror"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/database"
+	"github.com/andre2ar/go-products/internal/infra/webserver/middlewares"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"time"
+)
+
+type APIKeyHandler struct {
+	APIKeyRepository database.APIKeyRepositoryInterface
+}
+
+func NewAPIKeyHandler(apiKeyRepository database.APIKeyRepositoryInterface) *APIKeyHandler {
+	return &APIKeyHandler{APIKeyRepository: apiKeyRepository}
+}
+
+// CreateAPIKey  godoc
+// @Summary      Create an API key
+// @Description  Create an API key acting as the authenticated user on the products routes, limited to the given scopes (products:read, products:write). The key is returned only once
+// @Tags         api-keys
+// @Accept       json
+// @Produce      json
+// @Param        request  body      dto.CreateAPIKeyInput  true  "key name, scopes and optional expiry"
+// @Success      201      {object}  dto.CreateAPIKeyResponse
+// @Failure      400      {object}  problem.Problem
+// @Failure      401      {object}  problem.Problem
+// @Failure      429      {object}  problem.Problem
+// @Failure      500      {object}  problem.Problem
+// @Router       /api/v1/users/me/api-keys [post]
+// @Security ApiKeyAuth
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserFromContext(r.Context())
+
+	var input dto.CreateAPIKeyInput
+	err := decodeJSON(r, &input)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	key, plain, err := entity.NewAPIKey(user.ID, input.Name, input.Scopes, input.ExpiresAt)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	err = h.APIKeyRepository.Create(r.Context(), key)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(dto.CreateAPIKeyResponse{APIKey: key, Key: plain})
+}
+
+// ListAPIKeys   godoc
+// @Summary      List API keys
+// @Description  List the API keys of the authenticated user that were not revoked, explicitly or along with its sessions
+// @Tags         api-keys
+// @Produce      json
+// @Success      200  {array}   entity.APIKey
+// @Failure      401  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /api/v1/users/me/api-keys [get]
+// @Security ApiKeyAuth
+func (h *APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserFromContext(r.Context())
+
+	keys, err := h.APIKeyRepository.FindByUser(r.Context(), user.ID.String())
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	usable := make([]entity.APIKey, 0, len(keys))
+	for _, key := range keys {
+		if !key.RevokedWith(user) {
+			usable = append(usable, key)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(usable)
+}
+
+// RevokeAPIKey  godoc
+// @Summary      Revoke an API key
+// @Description  Revoke an API key of the authenticated user. It is refused from the next request on
+// @Tags         api-keys
+// @Param        id   path      string  true  "API key ID" Format(uuid)
+// @Success      204
+// @Failure      401  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /api/v1/users/me/api-keys/{id} [delete]
+// @Security ApiKeyAuth
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserFromContext(r.Context())
+
+	revoked, err := h.APIKeyRepository.Revoke(r.Context(), user.ID.String(), chi.URLParam(r, "id"), time.Now())
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if !revoked {
+		problem.Write(w, r, apperror.ErrAPIKeyNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/andre2ar/go-products/internal/apperror"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/database"
+	"github.com/andre2ar/go-products/internal/infra/mail"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	"github.com/andre2ar/go-products/pkg/logging"
+	"github.com/andre2ar/go-products/pkg/ratelimit"
+	"github.com/andre2ar/go-products/pkg/securetoken"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emailVerificationPurpose scopes the signing key of verification links so
+// they cannot be mistaken for any other token signed with the same secret.
+const emailVerificationPurpose = "email-verification"
+
+type EmailVerificationHandler struct {
+	UserRepository  database.UserRepositoryInterface
+	Mailer          mail.Mailer
+	Limiter         *ratelimit.WindowLimiter
+	Key             []byte
+	TTL             time.Duration
+	VerificationURL string
+}
+
+func NewEmailVerificationHandler(
+	userRepository database.UserRepositoryInterface,
+	mailer mail.Mailer,
+	limiter *ratelimit.WindowLimiter,
+	secret string,
+	ttl time.Duration,
+	verificationURL string,
+) *EmailVerificationHandler {
+	return &EmailVerificationHandler{
+		UserRepository:  userRepository,
+		Mailer:          mailer,
+		Limiter:         limiter,
+		Key:             securetoken.DeriveKey([]byte(secret), emailVerificationPurpose),
+		TTL:             ttl,
+		VerificationURL: verificationURL,
+	}
+}
+
+// ResendEmailVerification godoc
+// @Summary      Resend email verification
+// @Description  Email a new verification link. The response is the same whether or not the email is registered or already verified
+// @Tags         email-verifications
+// @Accept       json
+// @Produce      json
+// @Param        request  body  dto.EmailVerificationRequestInput  true  "account email"
+// @Success      202
+// @Failure      400  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /api/v1/email-verifications [post]
+func (h *EmailVerificationHandler) ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	var input dto.EmailVerificationRequestInput
+	err := decodeJSON(r, &input)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	if allowed, retryAfter := h.Limiter.Allow(entity.NormalizeEmail(input.Email)); !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		problem.Write(w, r, apperror.ErrTooManyRequests)
+		return
+	}
+
+	user, err := h.UserRepository.FindByEmail(r.Context(), input.Email)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.Write(w, r, err)
+		return
+	}
+
+	if user != nil && !user.IsEmailVerified() {
+		h.SendVerificationLink(r.Context(), user)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// VerifyEmail   godoc
+// @Summary      Verify email
+// @Description  Mark the email of an account as verified using the token of a verification link
+// @Tags         email-verifications
+// @Produce      json
+// @Param        token  path  string  true  "email verification token"
+// @Success      204
+// @Failure      400  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /api/v1/email-verifications/{token} [post]
+func (h *EmailVerificationHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	payload, err := securetoken.Verify(h.Key, chi.URLParam(r, "token"), time.Now())
+	if err != nil {
+		problem.Write(w, r, entity.ErrInvalidEmailVerificationToken)
+		return
+	}
+
+	// The link is bound to the address it was sent to, so changing the email
+	// afterwards invalidates it.
+	userID, email, _ := strings.Cut(payload, " ")
+	user, err := h.UserRepository.FindByID(r.Context(), userID)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if user == nil || user.Email != email {
+		problem.Write(w, r, entity.ErrInvalidEmailVerificationToken)
+		return
+	}
+
+	if !user.IsEmailVerified() {
+		user.VerifyEmail(time.Now())
+		err = h.UserRepository.Update(r.Context(), user, "EmailVerifiedAt")
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SendVerificationLink emails user a signed link confirming its current
+// address. Mail is queued for a background worker so callers answer at the
+// same speed whether or not a link was sent.
+func (h *EmailVerificationHandler) SendVerificationLink(ctx context.Context, user *entity.User) {
+	token := securetoken.Sign(h.Key, user.ID.String()+" "+user.Email, time.Now().Add(h.TTL))
+	h.sendVerificationLink(ctx, user, token)
+}
+
+func (h *EmailVerificationHandler) sendVerificationLink(ctx context.Context, user *entity.User, token string) {
+	link, err := url.Parse(h.VerificationURL)
+	if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "invalid email verification URL", slog.String("url", h.VerificationURL), slog.Any("error", err))
+		return
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	err = h.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"Use the link below to confirm this is your email address. It expires in " + h.TTL.String() + ".\n\n" +
+			link.String() + "\n\n" +
+			"If you did not create an account, you can ignore this email.\n",
+	})
+	if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "could not send email verification", slog.String("user_id", user.ID.String()), slog.Any("error", err))
+	}
+}
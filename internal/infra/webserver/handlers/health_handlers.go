@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/andre2ar/go-products/internal/infra/health"
+	"net/http"
+)
+
+type HealthHandler struct {
+	Health *health.Health
+}
+
+func NewHealthHandler(health *health.Health) *HealthHandler {
+	return &HealthHandler{Health: health}
+}
+
+// Live          godoc
+// @Summary      Liveness probe
+// @Description  Answers as long as the process is able to serve requests, without checking its dependencies
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  health.Report
+// @Router       /healthz [get]
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, health.Report{Status: health.StatusOK, Checks: map[string]health.Result{}})
+}
+
+// Ready         godoc
+// @Summary      Readiness probe
+// @Description  Checks the database connection, pending migrations and background workers. A degraded report, such as a full mail queue, is still ready. Fails as soon as the server starts shutting down so load balancers drain its traffic
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  health.Report
+// @Failure      503  {object}  health.Report
+// @Router       /readyz [get]
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	report := h.Health.Ready(r.Context())
+
+	status := http.StatusOK
+	if report.Status == health.StatusFailing {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, status, report)
+}
+
+func writeHealth(w http.ResponseWriter, status int, report health.Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
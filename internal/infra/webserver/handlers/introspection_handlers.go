@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/andre2ar/go-products/internal/apperror"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/internal/infra/database"
+	"github.com/andre2ar/go-products/internal/infra/webserver/accesstoken"
+	"github.com/andre2ar/go-products/internal/infra/webserver/middlewares"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	"github.com/andre2ar/go-products/pkg/logging"
+	"github.com/andre2ar/go-products/pkg/ratelimit"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+type IntrospectionHandler struct {
+	Tokens         *accesstoken.Authority
+	UserRepository database.UserRepositoryInterface
+	// Clients maps the IDs of the services allowed to introspect tokens to
+	// their secrets.
+	Clients map[string]string
+	// ClientFailures and IPFailures throttle failed client authentications
+	// per client ID and per client IP, so secrets can not be guessed.
+	ClientFailures *ratelimit.Backoff
+	IPFailures     *ratelimit.Backoff
+}
+
+func NewIntrospectionHandler(
+	tokens *accesstoken.Authority,
+	userRepository database.UserRepositoryInterface,
+	clients map[string]string,
+	clientFailures, ipFailures *ratelimit.Backoff,
+) *IntrospectionHandler {
+	return &IntrospectionHandler{
+		Tokens:         tokens,
+		UserRepository: userRepository,
+		Clients:        clients,
+		ClientFailures: clientFailures,
+		IPFailures:     ipFailures,
+	}
+}
+
+// IntrospectToken godoc
+// @Summary      Introspect a token
+// @Description  RFC 7662 token introspection for other services, authenticated with HTTP Basic client credentials. Tokens are active when valid and not revoked
+// @Tags         tokens
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        token            formData  string  true   "access token"
+// @Param        token_type_hint  formData  string  false  "ignored, only access tokens are issued"
+// @Success      200  {object}  dto.IntrospectionResponse
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /api/v1/tokens/introspect [post]
+func (h *IntrospectionHandler) IntrospectToken(w http.ResponseWriter, r *http.Request) {
+	id, _, _ := r.BasicAuth()
+	ip := clientIP(r)
+	clientAllowed, clientRetry := h.ClientFailures.Check(id)
+	ipAllowed, ipRetry := h.IPFailures.Check(ip)
+	if !clientAllowed || !ipAllowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(max(clientRetry, ipRetry).Seconds()))))
+		problem.Write(w, r, apperror.ErrTooManyRequests)
+		return
+	}
+
+	if !h.authenticateClient(r) {
+		h.failure(r, id, ip)
+		w.Header().Set("WWW-Authenticate", `Basic realm="introspection"`)
+		problem.Write(w, r, apperror.ErrUnauthorized)
+		return
+	}
+	h.ClientFailures.Success(id)
+
+	if err := parseForm(r); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	tokenString := r.PostForm.Get("token")
+	if tokenString == "" {
+		problem.Write(w, r, apperror.Validation(apperror.FieldError{Field: "token", Code: "required", Message: "token is required"}))
+		return
+	}
+
+	response := dto.IntrospectionResponse{Active: false}
+	token, err := h.Tokens.Parse(tokenString)
+	if err == nil {
+		user, err := h.UserRepository.FindByID(r.Context(), token.Subject())
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		sessionVersion, _ := token.PrivateClaims()[middlewares.SessionVersionClaim].(float64)
+		if user != nil && !user.IsSuspended() && int(sessionVersion) == user.SessionVersion {
+			response = dto.IntrospectionResponse{
+				Active:    true,
+				TokenType: "Bearer",
+				Username:  user.Email,
+				Subject:   token.Subject(),
+				Issuer:    token.Issuer(),
+				Audience:  token.Audience(),
+				TokenID:   token.JwtID(),
+				IssuedAt:  token.IssuedAt().Unix(),
+				NotBefore: token.NotBefore().Unix(),
+				ExpiresAt: token.Expiration().Unix(),
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// failure records a failed authentication of client id from ip and logs
+// the lockouts it causes.
+func (h *IntrospectionHandler) failure(r *http.Request, id, ip string) {
+	ctx := r.Context()
+	if h.ClientFailures.Failure(id) {
+		logging.FromContext(ctx).WarnContext(ctx, "introspection client lockout", slog.String("client_id", id), slog.String("ip", ip))
+	}
+	if h.IPFailures.Failure(ip) {
+		logging.FromContext(ctx).WarnContext(ctx, "introspection IP lockout", slog.String("client_id", id), slog.String("ip", ip))
+	}
+}
+
+// authenticateClient checks the HTTP Basic credentials of r against
+// Clients, comparing secrets in constant time.
+func (h *IntrospectionHandler) authenticateClient(r *http.Request) bool {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	expected, known := h.Clients[id]
+	if !known || expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(expected)) == 1
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	"github.com/andre2ar/go-products/pkg/jwtkeys"
+	"net/http"
+)
+
+type JWKSHandler struct {
+	Keys *jwtkeys.KeyRing
+}
+
+func NewJWKSHandler(keys *jwtkeys.KeyRing) *JWKSHandler {
+	return &JWKSHandler{Keys: keys}
+}
+
+// GetJWKS       godoc
+// @Summary      JSON Web Key Set
+// @Description  Public keys verifying access tokens, including keys scheduled to sign soon. Empty when tokens are signed with a shared secret
+// @Tags         keys
+// @Produce      json
+// @Success      200  {object}  object
+// @Failure      500  {object}  problem.Problem
+// @Router       /.well-known/jwks.json [get]
+func (h *JWKSHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	set, err := h.Keys.PublicKeys()
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(set)
+}
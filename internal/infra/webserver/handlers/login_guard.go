@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/database"
+	"github.com/andre2ar/go-products/pkg/logging"
+	"github.com/andre2ar/go-products/pkg/ratelimit"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// LoginGuard throttles password guessing. Failed logins are counted per
+// email, whether or not it belongs to an account so lockouts do not reveal
+// which ones exist, and per client IP, as resolved by middlewares.RealIP.
+type LoginGuard struct {
+	Accounts    *ratelimit.Backoff
+	IPs         *ratelimit.Backoff
+	AuditEvents database.AuditEventRepositoryInterface
+}
+
+func NewLoginGuard(accounts, ips *ratelimit.Backoff, auditEvents database.AuditEventRepositoryInterface) *LoginGuard {
+	return &LoginGuard{Accounts: accounts, IPs: ips, AuditEvents: auditEvents}
+}
+
+// LoginAttempt is a login reserved by LoginGuard, counted against its email
+// and client IP until settled by Failure, Success or Release, so parallel
+// guesses cannot all pass before the first ones fail.
+type LoginAttempt struct {
+	guard   *LoginGuard
+	ctx     context.Context
+	email   string
+	ip      string
+	settled bool
+}
+
+// Check reserves a login for email from the client of r or, when it may not
+// be attempted now, returns nil and how long until it can.
+func (g *LoginGuard) Check(r *http.Request, email string) (*LoginAttempt, time.Duration) {
+	email = entity.NormalizeEmail(email)
+	ip := clientIP(r)
+
+	accountAllowed, accountRetry := g.Accounts.Reserve(email)
+	ipAllowed, ipRetry := g.IPs.Reserve(ip)
+	if !accountAllowed || !ipAllowed {
+		if accountAllowed {
+			g.Accounts.Release(email)
+		}
+		if ipAllowed {
+			g.IPs.Release(ip)
+		}
+		return nil, max(accountRetry, ipRetry)
+	}
+	return &LoginAttempt{guard: g, ctx: r.Context(), email: email, ip: ip}, 0
+}
+
+// CheckIP is Check for logins whose account is not known up front, such as
+// those through the identity provider.
+func (g *LoginGuard) CheckIP(r *http.Request) (*LoginAttempt, time.Duration) {
+	ip := clientIP(r)
+	if allowed, retryAfter := g.IPs.Reserve(ip); !allowed {
+		return nil, retryAfter
+	}
+	return &LoginAttempt{guard: g, ctx: r.Context(), ip: ip}, 0
+}
+
+// Failure records the attempt as a failed login and audits the lockouts it
+// causes.
+func (a *LoginAttempt) Failure() {
+	if a.settled {
+		return
+	}
+	a.settled = true
+
+	g := a.guard
+	if a.email != "" && g.Accounts.Failure(a.email) {
+		g.audit(a.ctx, entity.AuditLoginAccountLockout, a.email, a.ip, lockoutDetail(g.Accounts))
+	}
+	if g.IPs.Failure(a.ip) {
+		g.audit(a.ctx, entity.AuditLoginIPLockout, a.email, a.ip, lockoutDetail(g.IPs))
+	}
+}
+
+// Success forgets the failed logins of the email of the attempt. Failures
+// of the IP are kept, so one valid account does not let a client keep
+// guessing others.
+func (a *LoginAttempt) Success() {
+	if a.settled {
+		return
+	}
+	a.settled = true
+
+	if a.email != "" {
+		a.guard.Accounts.Success(a.email)
+	}
+	a.guard.IPs.Release(a.ip)
+}
+
+// Release settles the attempt without counting it, for logins that ended
+// before the credentials were checked. It does nothing once settled, so it
+// can be deferred.
+func (a *LoginAttempt) Release() {
+	if a.settled {
+		return
+	}
+	a.settled = true
+
+	if a.email != "" {
+		a.guard.Accounts.Release(a.email)
+	}
+	a.guard.IPs.Release(a.ip)
+}
+
+func lockoutDetail(backoff *ratelimit.Backoff) string {
+	maxFailures, lockout := backoff.Limits()
+	return fmt.Sprintf("locked for %s after %d failed logins", lockout, maxFailures)
+}
+
+func (g *LoginGuard) audit(ctx context.Context, eventType, email, ip, detail string) {
+	logger := logging.FromContext(ctx)
+	logger.WarnContext(ctx, "audit event",
+		slog.String("event", eventType), slog.String("email", email), slog.String("ip", ip), slog.String("detail", detail))
+
+	err := g.AuditEvents.Create(context.WithoutCancel(ctx), entity.NewAuditEvent(eventType, email, ip, detail))
+	if err != nil {
+		logger.ErrorContext(ctx, "could not record audit event", slog.String("event", eventType), slog.Any("error", err))
+	}
+}
+
+// clientIP returns the address of the client of r without its port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
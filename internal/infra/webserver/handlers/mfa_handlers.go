@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/andre2ar/go-products/internal/apperror"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/database"
+	"github.com/andre2ar/go-products/internal/infra/metrics"
+	"github.com/andre2ar/go-products/internal/infra/webserver/middlewares"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	"github.com/andre2ar/go-products/pkg/ratelimit"
+	"github.com/andre2ar/go-products/pkg/securetoken"
+	"github.com/andre2ar/go-products/pkg/totp"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mfaChallengePurpose scopes the signing key of MFA challenge tokens so they
+// cannot be mistaken for any other token signed with the same secret.
+const mfaChallengePurpose = "mfa-challenge"
+
+type MFAHandler struct {
+	UserRepository     database.UserRepositoryInterface
+	TransactionManager database.TransactionManagerInterface
+	Limiter            *ratelimit.WindowLimiter
+	Key                []byte
+	ChallengeTTL       time.Duration
+	Issuer             string
+	Metrics            *metrics.Metrics
+
+	mu sync.RWMutex
+}
+
+func NewMFAHandler(
+	userRepository database.UserRepositoryInterface,
+	transactionManager database.TransactionManagerInterface,
+	limiter *ratelimit.WindowLimiter,
+	secret string,
+	challengeTTL time.Duration,
+	issuer string,
+	metrics *metrics.Metrics,
+) *MFAHandler {
+	return &MFAHandler{
+		UserRepository:     userRepository,
+		TransactionManager: transactionManager,
+		Limiter:            limiter,
+		Key:                securetoken.DeriveKey([]byte(secret), mfaChallengePurpose),
+		ChallengeTTL:       challengeTTL,
+		Issuer:             issuer,
+		Metrics:            metrics,
+	}
+}
+
+// SetChallengeTTL changes the lifetime of the challenge tokens issued from
+// now on.
+func (h *MFAHandler) SetChallengeTTL(ttl time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.ChallengeTTL = ttl
+}
+
+func (h *MFAHandler) challengeTTL() time.Duration {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.ChallengeTTL
+}
+
+// EnrollMFA     godoc
+// @Summary      Start two-factor enrollment
+// @Description  Generate a TOTP secret for the authenticated user. The provisioning URI is meant to be shown as a QR code; two-factor authentication is enabled once a code is confirmed
+// @Tags         mfa
+// @Produce      json
+// @Success      200  {object}  dto.MFAEnrollmentResponse
+// @Failure      401  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /api/v1/users/me/mfa [post]
+// @Security ApiKeyAuth
+func (h *MFAHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserFromContext(r.Context())
+
+	secret, err := user.StartMFAEnrollment()
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	err = h.UserRepository.Update(r.Context(), user, "MFASecret", "MFALastStep")
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dto.MFAEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(h.Issuer, user.Email, secret),
+	})
+}
+
+// ConfirmMFA    godoc
+// @Summary      Confirm two-factor enrollment
+// @Description  Enable two-factor authentication with a code from the authenticator and return single-use recovery codes, shown only once
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Param        request  body      dto.MFACodeInput  true  "authenticator code"
+// @Success      200      {object}  dto.RecoveryCodesResponse
+// @Failure      400      {object}  problem.Problem
+// @Failure      401      {object}  problem.Problem
+// @Failure      409      {object}  problem.Problem
+// @Failure      429      {object}  problem.Problem
+// @Failure      500      {object}  problem.Problem
+// @Router       /api/v1/users/me/mfa/confirm [post]
+// @Security ApiKeyAuth
+func (h *MFAHandler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserFromContext(r.Context())
+
+	var input dto.MFACodeInput
+	err := decodeJSON(r, &input)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	err = user.ConfirmMFA(input.Code, time.Now())
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	codes, recoveryCodes, err := entity.NewRecoveryCodes(user.ID)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	err = h.TransactionManager.WithinTransaction(r.Context(), func(ctx context.Context, repositories *database.Repositories) error {
+		if err := repositories.Users.Update(ctx, user, "MFAEnabledAt", "MFALastStep"); err != nil {
+			return err
+		}
+		return repositories.RecoveryCodes.Replace(ctx, user.ID.String(), codes)
+	})
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dto.RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
+
+// DisableMFA    godoc
+// @Summary      Disable two-factor authentication
+// @Description  Disable two-factor authentication of the authenticated user and discard its recovery codes
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Param        request  body  dto.DisableMFAInput  true  "current password"
+// @Success      204
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /api/v1/users/me/mfa [delete]
+// @Security ApiKeyAuth
+func (h *MFAHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserFromContext(r.Context())
+
+	var input dto.DisableMFAInput
+	err := decodeJSON(r, &input)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	if !user.ValidatePassword(input.Password) {
+		problem.Write(w, r, apperror.ErrInvalidCredentials)
+		return
+	}
+
+	user.DisableMFA()
+	err = h.TransactionManager.WithinTransaction(r.Context(), func(ctx context.Context, repositories *database.Repositories) error {
+		if err := repositories.Users.Update(ctx, user, "MFAEnabledAt", "MFASecret", "MFALastStep"); err != nil {
+			return err
+		}
+		return repositories.RecoveryCodes.Replace(ctx, user.ID.String(), nil)
+	})
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateMFASession godoc
+// @Summary      Complete a two-factor login
+// @Description  Exchange the challenge token returned by Create Session and an authenticator or recovery code for an access token
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        request  body      dto.MFASessionInput  true  "challenge token and code"
+// @Success      200      {object}  dto.AuthResponse
+// @Failure      400      {object}  problem.Problem
+// @Failure      401      {object}  problem.Problem
+// @Failure      403      {object}  problem.Problem
+// @Failure      429      {object}  problem.Problem
+// @Failure      500      {object}  problem.Problem
+// @Router       /api/v1/sessions/mfa [post]
+func (h *MFAHandler) CreateMFASession(w http.ResponseWriter, r *http.Request) {
+	var input dto.MFASessionInput
+	err := decodeJSON(r, &input)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	payload, err := securetoken.Verify(h.Key, input.MFAToken, time.Now())
+	if err != nil {
+		problem.Write(w, r, apperror.ErrInvalidMFAToken)
+		return
+	}
+	userID, sessionVersion, _ := strings.Cut(payload, " ")
+
+	// Codes are short, so attempts are capped per user rather than per
+	// challenge, which could otherwise be renewed by logging in again.
+	if allowed, retryAfter := h.Limiter.Allow(userID); !allowed {
+		h.Metrics.Login(metrics.LoginMFA, metrics.LoginThrottled)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		problem.Write(w, r, apperror.ErrTooManyRequests)
+		return
+	}
+
+	var user *entity.User
+	err = h.TransactionManager.WithinTransaction(r.Context(), func(ctx context.Context, repositories *database.Repositories) error {
+		var err error
+		user, err = repositories.Users.FindByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if user == nil || !user.IsMFAEnabled() || strconv.Itoa(user.SessionVersion) != sessionVersion {
+			return apperror.ErrInvalidMFAToken
+		}
+		if user.IsSuspended() {
+			return apperror.ErrAccountSuspended
+		}
+
+		now := time.Now()
+		if user.ValidateMFACode(input.Code, now) {
+			// The step is recorded conditionally, so concurrent logins can
+			// not both accept the same code.
+			used, err := repositories.Users.UseMFAStep(ctx, userID, user.MFALastStep)
+			if err != nil {
+				return err
+			}
+			if !used {
+				return entity.ErrInvalidMFACode
+			}
+			return nil
+		}
+
+		used, err := repositories.RecoveryCodes.Use(ctx, userID, entity.HashRecoveryCode(input.Code), now)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return entity.ErrInvalidMFACode
+		}
+		return nil
+	})
+	if err != nil {
+		switch apperror.From(err).Status {
+		case http.StatusUnauthorized:
+			h.Metrics.Login(metrics.LoginMFA, metrics.LoginFailure)
+		case http.StatusForbidden:
+			h.Metrics.Login(metrics.LoginMFA, metrics.LoginRejected)
+		}
+		problem.Write(w, r, err)
+		return
+	}
+
+	h.Metrics.Login(metrics.LoginMFA, metrics.LoginSuccess)
+	writeAccessToken(w, r, user)
+}
+
+// writeChallenge answers a login whose password was accepted for a user with
+// two-factor authentication with a short-lived token to complete it through
+// CreateMFASession. The token is bound to the user's session version, so
+// revoking sessions also invalidates pending challenges.
+func (h *MFAHandler) writeChallenge(w http.ResponseWriter, user *entity.User) {
+	payload := user.ID.String() + " " + strconv.Itoa(user.SessionVersion)
+	ttl := h.challengeTTL()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(dto.MFAChallengeResponse{
+		MFAToken:  securetoken.Sign(h.Key, payload, time.Now().Add(ttl)),
+		ExpiresIn: int(ttl / time.Second),
+	})
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/andre2ar/go-products/internal/apperror"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/database"
+	"github.com/andre2ar/go-products/internal/infra/metrics"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	"github.com/andre2ar/go-products/pkg/oidc"
+	"github.com/andre2ar/go-products/pkg/securetoken"
+	"gorm.io/gorm"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// oidcStatePurpose scopes the signing key of the login state cookie.
+	oidcStatePurpose = "oidc-state"
+	oidcStateCookie  = "oidc_state"
+	oidcCookiePath   = "/api/v1/oidc"
+)
+
+type OIDCHandler struct {
+	Provider                 *oidc.Provider
+	TransactionManager       database.TransactionManagerInterface
+	MFA                      *MFAHandler
+	LoginGuard               *LoginGuard
+	RequireEmailVerification bool
+	Key                      []byte
+	StateTTL                 time.Duration
+	// SecureCookie marks the state cookie Secure even when TLS terminates
+	// at a proxy in front of the server.
+	SecureCookie bool
+	Metrics      *metrics.Metrics
+}
+
+func NewOIDCHandler(
+	provider *oidc.Provider,
+	transactionManager database.TransactionManagerInterface,
+	mfa *MFAHandler,
+	loginGuard *LoginGuard,
+	requireEmailVerification bool,
+	secret string,
+	stateTTL time.Duration,
+	secureCookie bool,
+	metrics *metrics.Metrics,
+) *OIDCHandler {
+	return &OIDCHandler{
+		Provider:                 provider,
+		TransactionManager:       transactionManager,
+		MFA:                      mfa,
+		LoginGuard:               loginGuard,
+		RequireEmailVerification: requireEmailVerification,
+		Key:                      securetoken.DeriveKey([]byte(secret), oidcStatePurpose),
+		StateTTL:                 stateTTL,
+		SecureCookie:             secureCookie,
+		Metrics:                  metrics,
+	}
+}
+
+// StartOIDCLogin godoc
+// @Summary      Log in with the identity provider
+// @Description  Redirect to the OpenID Connect provider to log in with the authorization code flow and PKCE. The provider redirects back to /oidc/callback
+// @Tags         users
+// @Success      302
+// @Failure      502  {object}  problem.Problem
+// @Router       /api/v1/oidc/login [get]
+func (h *OIDCHandler) StartOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	// state, nonce and the PKCE verifier are kept in a signed cookie until
+	// the provider redirects back.
+	values := make([]string, 3)
+	for i := range values {
+		value, err := securetoken.Generate()
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := h.Provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		problem.Write(w, r, apperror.ErrIdentityProviderUnavailable.Wrap(err))
+		return
+	}
+
+	expiresAt := time.Now().Add(h.StateTTL)
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    securetoken.Sign(h.Key, strings.Join(values, " "), expiresAt),
+		Path:     oidcCookiePath,
+		Expires:  expiresAt,
+		MaxAge:   int(h.StateTTL.Seconds()),
+		Secure:   h.secureCookie(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback  godoc
+// @Summary      Complete a login with the identity provider
+// @Description  Exchange the authorization code sent back by the OpenID Connect provider for an access token. Accounts are created or linked by verified email on first login. Users with two-factor authentication get a challenge token to complete the login through /sessions/mfa instead
+// @Tags         users
+// @Produce      json
+// @Param        code   query     string  true  "authorization code"
+// @Param        state  query     string  true  "state sent to the provider"
+// @Success      200    {object}  dto.AuthResponse
+// @Success      202    {object}  dto.MFAChallengeResponse
+// @Failure      401    {object}  problem.Problem
+// @Failure      403    {object}  problem.Problem
+// @Failure      429    {object}  problem.Problem
+// @Failure      500    {object}  problem.Problem
+// @Failure      502    {object}  problem.Problem
+// @Router       /api/v1/oidc/callback [get]
+func (h *OIDCHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	// The account is only known once the code is exchanged, so logins are
+	// throttled per client IP alone.
+	attempt, retryAfter := h.LoginGuard.CheckIP(r)
+	if attempt == nil {
+		h.Metrics.Login(metrics.LoginOIDC, metrics.LoginThrottled)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		problem.Write(w, r, apperror.ErrTooManyRequests)
+		return
+	}
+	defer attempt.Release()
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		problem.Write(w, r, apperror.ErrOIDCLoginFailed.Wrap(err))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: oidcCookiePath, MaxAge: -1, Secure: h.secureCookie(r), HttpOnly: true})
+
+	payload, err := securetoken.Verify(h.Key, cookie.Value, time.Now())
+	if err != nil {
+		problem.Write(w, r, apperror.ErrOIDCLoginFailed.Wrap(err))
+		return
+	}
+	values := strings.Split(payload, " ")
+	if len(values) != 3 {
+		problem.Write(w, r, apperror.ErrOIDCLoginFailed)
+		return
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	query := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+		problem.Write(w, r, apperror.ErrOIDCLoginFailed)
+		return
+	}
+	if query.Get("error") != "" || query.Get("code") == "" {
+		problem.Write(w, r, apperror.ErrOIDCLoginFailed.Wrap(errors.New("provider error: "+query.Get("error"))))
+		return
+	}
+
+	claims, err := h.Provider.Exchange(r.Context(), query.Get("code"), verifier, nonce)
+	if errors.Is(err, oidc.ErrUnavailable) {
+		problem.Write(w, r, apperror.ErrIdentityProviderUnavailable.Wrap(err))
+		return
+	}
+	if err != nil {
+		attempt.Failure()
+		h.Metrics.Login(metrics.LoginOIDC, metrics.LoginFailure)
+		problem.Write(w, r, apperror.ErrOIDCLoginFailed.Wrap(err))
+		return
+	}
+
+	user, linked, err := h.provision(r.Context(), claims)
+	if errors.Is(err, apperror.ErrOIDCEmailNotVerified) {
+		h.Metrics.Login(metrics.LoginOIDC, metrics.LoginRejected)
+	}
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if linked != "" {
+		h.LoginGuard.audit(r.Context(), entity.AuditOIDCIdentityLinked, user.Email, clientIP(r),
+			fmt.Sprintf("%s subject %s of %s", linked, claims.Subject, h.Provider.Issuer))
+	}
+
+	if rejection := loginRejection(user, h.RequireEmailVerification); rejection != nil {
+		h.Metrics.Login(metrics.LoginOIDC, metrics.LoginRejected)
+		problem.Write(w, r, rejection)
+		return
+	}
+
+	if user.IsMFAEnabled() {
+		h.Metrics.Login(metrics.LoginOIDC, metrics.LoginMFARequired)
+		h.MFA.writeChallenge(w, user)
+		return
+	}
+
+	h.Metrics.Login(metrics.LoginOIDC, metrics.LoginSuccess)
+	writeAccessToken(w, r, user)
+}
+
+func (h *OIDCHandler) secureCookie(r *http.Request) bool {
+	return h.SecureCookie || r.TLS != nil
+}
+
+// provision returns the user linked to the provider account of claims. On
+// first login the account is linked to the user registered with the same
+// email, created if there is none, provided the provider verified it; how
+// it was linked is then described by linked. A user who never verified the
+// email is claimed rather than linked as is, so whoever registered it with
+// an email they do not own loses access.
+func (h *OIDCHandler) provision(ctx context.Context, claims *oidc.Claims) (user *entity.User, linked string, err error) {
+	err = h.TransactionManager.WithinTransaction(ctx, func(ctx context.Context, repositories *database.Repositories) error {
+		identity, err := repositories.Identities.FindBySubject(ctx, h.Provider.Issuer, claims.Subject)
+		if err != nil {
+			return err
+		}
+		if identity != nil {
+			user, err = repositories.Users.FindByID(ctx, identity.UserID.String())
+			if err != nil || user != nil {
+				return err
+			}
+			// The linked user was deleted; link the account anew.
+			if err := repositories.Identities.Delete(ctx, identity.ID.String()); err != nil {
+				return err
+			}
+		}
+
+		if claims.Email == "" || !claims.EmailVerified {
+			return apperror.ErrOIDCEmailNotVerified
+		}
+
+		now := time.Now()
+		linked = "linked"
+		user, err = repositories.Users.FindByEmail(ctx, claims.Email)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			linked = "created an account for"
+			user, err = entity.NewExternalUser(claims.Name, claims.Email, now)
+			if err != nil {
+				return err
+			}
+			if err := repositories.Users.Create(ctx, user); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case !user.IsEmailVerified():
+			linked = "claimed an unverified account for"
+			if err := user.Claim(now); err != nil {
+				return err
+			}
+			err = repositories.Users.Update(ctx, user, "Password", "PasswordResetRequired", "SessionVersion", "SessionsRevokedAt",
+				"MFAEnabledAt", "MFASecret", "MFALastStep", "EmailVerifiedAt")
+			if err != nil {
+				return err
+			}
+			if err := repositories.APIKeys.DeleteByUser(ctx, user.ID.String()); err != nil {
+				return err
+			}
+			if err := repositories.RecoveryCodes.Replace(ctx, user.ID.String(), nil); err != nil {
+				return err
+			}
+		}
+
+		return repositories.Identities.Create(ctx, entity.NewExternalIdentity(user.ID, h.Provider.Issuer, claims.Subject, claims.Email))
+	})
+	if err != nil {
+		// The transaction was rolled back.
+		linked = ""
+	}
+
+	return user, linked, err
+}
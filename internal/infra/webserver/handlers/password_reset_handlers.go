@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/andre2ar/go-products/internal/apperror"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/database"
+	"github.com/andre2ar/go-products/internal/infra/mail"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	"github.com/andre2ar/go-products/pkg/logging"
+	"github.com/andre2ar/go-products/pkg/ratelimit"
+	"github.com/andre2ar/go-products/pkg/securetoken"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type PasswordResetHandler struct {
+	UserRepository          database.UserRepositoryInterface
+	PasswordResetRepository database.PasswordResetRepositoryInterface
+	TransactionManager      database.TransactionManagerInterface
+	Mailer                  mail.Mailer
+	Limiter                 *ratelimit.WindowLimiter
+	TTL                     time.Duration
+	ResetURL                string
+}
+
+func NewPasswordResetHandler(
+	userRepository database.UserRepositoryInterface,
+	passwordResetRepository database.PasswordResetRepositoryInterface,
+	transactionManager database.TransactionManagerInterface,
+	mailer mail.Mailer,
+	limiter *ratelimit.WindowLimiter,
+	ttl time.Duration,
+	resetURL string,
+) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		UserRepository:          userRepository,
+		PasswordResetRepository: passwordResetRepository,
+		TransactionManager:      transactionManager,
+		Mailer:                  mailer,
+		Limiter:                 limiter,
+		TTL:                     ttl,
+		ResetURL:                resetURL,
+	}
+}
+
+// CreatePasswordReset godoc
+// @Summary      Request a password reset
+// @Description  Email a single-use password reset link. The response is the same whether or not the email is registered
+// @Tags         password-resets
+// @Accept       json
+// @Produce      json
+// @Param        request  body  dto.PasswordResetRequestInput  true  "account email"
+// @Success      202
+// @Failure      400  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /api/v1/password-resets [post]
+func (h *PasswordResetHandler) CreatePasswordReset(w http.ResponseWriter, r *http.Request) {
+	var input dto.PasswordResetRequestInput
+	err := decodeJSON(r, &input)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	if allowed, retryAfter := h.Limiter.Allow(entity.NormalizeEmail(input.Email)); !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		problem.Write(w, r, apperror.ErrTooManyRequests)
+		return
+	}
+
+	user, err := h.UserRepository.FindByEmail(r.Context(), input.Email)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.Write(w, r, err)
+		return
+	}
+
+	if user != nil {
+		reset, token, err := entity.NewPasswordReset(user.ID, h.TTL)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		err = h.PasswordResetRepository.Create(r.Context(), reset)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		// Mail is queued for a background worker so response times do not
+		// reveal whether the email belongs to an account.
+		h.sendResetLink(r.Context(), user, token)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword godoc
+// @Summary      Reset password
+// @Description  Set a new password using a password reset token, revoking every session of the user
+// @Tags         password-resets
+// @Accept       json
+// @Produce      json
+// @Param        token    path  string                   true  "password reset token"
+// @Param        request  body  dto.PasswordResetInput  true  "new password"
+// @Success      204
+// @Failure      400  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /api/v1/password-resets/{token} [post]
+func (h *PasswordResetHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input dto.PasswordResetInput
+	err := decodeJSON(r, &input)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	tokenHash := securetoken.Hash(chi.URLParam(r, "token"))
+	err = h.TransactionManager.WithinTransaction(r.Context(), func(ctx context.Context, repositories *database.Repositories) error {
+		now := time.Now()
+
+		reset, err := repositories.PasswordResets.Consume(ctx, tokenHash, now)
+		if err != nil {
+			return err
+		}
+		if reset == nil {
+			return entity.ErrInvalidPasswordResetToken
+		}
+
+		user, err := repositories.Users.FindByID(ctx, reset.UserID.String())
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return entity.ErrInvalidPasswordResetToken
+		}
+
+		if err := user.ChangePassword(input.Password); err != nil {
+			return err
+		}
+		if err := repositories.Users.Update(ctx, user, "Password", "PasswordResetRequired", "SessionVersion", "SessionsRevokedAt"); err != nil {
+			return err
+		}
+
+		return repositories.PasswordResets.MarkAllUsed(ctx, user.ID.String(), now)
+	})
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *PasswordResetHandler) sendResetLink(ctx context.Context, user *entity.User, token string) {
+	link, err := url.Parse(h.ResetURL)
+	if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "invalid password reset URL", slog.String("url", h.ResetURL), slog.Any("error", err))
+		return
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	err = h.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"Use the link below to choose a new password. It expires in " + h.TTL.String() + " and can only be used once.\n\n" +
+			link.String() + "\n\n" +
+			"If you did not ask for a password reset, you can ignore this email.\n",
+	})
+	if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "could not send password reset email", slog.String("user_id", user.ID.String()), slog.Any("error", err))
+	}
+}
@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"github.com/andre2ar/go-products/internal/apperror"
 	"github.com/andre2ar/go-products/internal/dto"
 	"github.com/andre2ar/go-products/internal/entity"
 	"github.com/andre2ar/go-products/internal/infra/database"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
 	entityPkg "github.com/andre2ar/go-products/pkg/entity"
 	"github.com/go-chi/chi/v5"
 	"net/http"
@@ -27,32 +29,29 @@ func NewProductHandler(db database.ProductRepositoryInterface) *ProductHandler {
 // @Produce      json
 // @Param        request     body      dto.CreateProductInput  true  "product request"
 // @Success      201
-// @Failure      500         {object}  Error
+// @Failure      400         {object}  problem.Problem
+// @Failure      401         {object}  problem.Problem
+// @Failure      429         {object}  problem.Problem
+// @Failure      500         {object}  problem.Problem
 // @Router       /api/v1/products [post]
 // @Security ApiKeyAuth
 func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	var product dto.CreateProductInput
-	err := json.NewDecoder(r.Body).Decode(&product)
+	err := decodeJSON(r, &product)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		err := Error{Message: err.Error()}
-		json.NewEncoder(w).Encode(err)
+		problem.Write(w, r, err)
 		return
 	}
 
 	newProduct, err := entity.NewProduct(product.Name, product.Price)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		err := Error{Message: err.Error()}
-		json.NewEncoder(w).Encode(err)
+		problem.Write(w, r, err)
 		return
 	}
 
-	err = h.ProductRepository.Create(newProduct)
+	err = h.ProductRepository.Create(r.Context(), newProduct)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		err := Error{Message: err.Error()}
-		json.NewEncoder(w).Encode(err)
+		problem.Write(w, r, err)
 		return
 	}
 
@@ -68,8 +67,9 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 // @Param        page      query     string  false  "page number"
 // @Param        limit     query     string  false  "limit"
 // @Success      200       {array}   entity.Product
-// @Failure      404       {object}  Error
-// @Failure      500       {object}  Error
+// @Failure      401       {object}  problem.Problem
+// @Failure      429       {object}  problem.Problem
+// @Failure      500       {object}  problem.Problem
 // @Router       /api/v1/products [get]
 // @Security ApiKeyAuth
 func (h *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
@@ -86,11 +86,9 @@ func (h *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 	}
 	sort := r.URL.Query().Get("sort")
 
-	products, err := h.ProductRepository.FindAll(pageInt, limitInt, sort)
+	products, err := h.ProductRepository.FindAll(r.Context(), pageInt, limitInt, sort)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		err := Error{Message: err.Error()}
-		json.NewEncoder(w).Encode(err)
+		problem.Write(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -106,30 +104,27 @@ func (h *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 // @Produce      json
 // @Param        id   path      string  true  "product ID" Format(uuid)
 // @Success      200  {object}  entity.Product
-// @Failure      404
-// @Failure      500  {object}  Error
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
 // @Router       /api/v1/products/{id} [get]
 // @Security ApiKeyAuth
 func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		err := Error{Message: entity.ErrIDIsRequired.Error()}
-		json.NewEncoder(w).Encode(err)
+		problem.Write(w, r, entity.ErrIDIsRequired)
 		return
 	}
-	product, err := h.ProductRepository.FindByID(id)
+	product, err := h.ProductRepository.FindByID(r.Context(), id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		err := Error{Message: err.Error()}
-		json.NewEncoder(w).Encode(err)
+		problem.Write(w, r, err)
 		return
 	}
 
 	if product == nil {
-		w.WriteHeader(http.StatusNotFound)
-		err := Error{Message: "Product not found"}
-		json.NewEncoder(w).Encode(err)
+		problem.Write(w, r, apperror.ErrProductNotFound)
 		return
 	}
 
@@ -147,45 +142,43 @@ func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 // @Param        id        	path      string                  true  "product ID" Format(uuid)
 // @Param        request     body      dto.CreateProductInput  true  "product request"
 // @Success      200
-// @Failure      404
-// @Failure      500       {object}  Error
+// @Failure      400       {object}  problem.Problem
+// @Failure      401       {object}  problem.Problem
+// @Failure      404       {object}  problem.Problem
+// @Failure      429       {object}  problem.Problem
+// @Failure      500       {object}  problem.Problem
 // @Router       /api/v1/products/{id} [put]
 // @Security ApiKeyAuth
 func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		err := Error{Message: entity.ErrIDIsRequired.Error()}
-		json.NewEncoder(w).Encode(err)
+		problem.Write(w, r, entity.ErrIDIsRequired)
 		return
 	}
-	var product entity.Product
-	err := json.NewDecoder(r.Body).Decode(&product)
+	var input dto.CreateProductInput
+	err := decodeJSON(r, &input)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		err := Error{Message: err.Error()}
-		json.NewEncoder(w).Encode(err)
+		problem.Write(w, r, err)
 		return
 	}
-	product.ID, err = entityPkg.ParseID(id)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		err := Error{Message: err.Error()}
-		json.NewEncoder(w).Encode(err)
+	if _, err = entityPkg.ParseID(id); err != nil {
+		problem.Write(w, r, apperror.ErrProductNotFound.Wrap(err))
 		return
 	}
-	_, err = h.ProductRepository.FindByID(id)
+	product, err := h.ProductRepository.FindByID(r.Context(), id)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		err := Error{Message: err.Error()}
-		json.NewEncoder(w).Encode(err)
+		problem.Write(w, r, err)
 		return
 	}
-	err = h.ProductRepository.Update(&product)
+	if product == nil {
+		problem.Write(w, r, apperror.ErrProductNotFound)
+		return
+	}
+	product.Name = input.Name
+	product.Price = input.Price
+	err = h.ProductRepository.Update(r.Context(), product)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		err := Error{Message: err.Error()}
-		json.NewEncoder(w).Encode(err)
+		problem.Write(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -198,27 +191,32 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 // @Accept       json
 // @Produce      json
 // @Param        id        path      string                  true  "product ID" Format(uuid)
-// @Success      200
-// @Failure      404
-// @Failure      500       {object}  Error
+// @Success      204
+// @Failure      400       {object}  problem.Problem
+// @Failure      401       {object}  problem.Problem
+// @Failure      404       {object}  problem.Problem
+// @Failure      429       {object}  problem.Problem
+// @Failure      500       {object}  problem.Problem
 // @Router       /api/v1/products/{id} [delete]
 // @Security ApiKeyAuth
 func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		w.WriteHeader(http.StatusBadRequest)
+		problem.Write(w, r, entity.ErrIDIsRequired)
 		return
 	}
-	product, err := h.ProductRepository.FindByID(id)
-	if product == nil || err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		err := Error{Message: "Product not found"}
-		json.NewEncoder(w).Encode(err)
+	product, err := h.ProductRepository.FindByID(r.Context(), id)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if product == nil {
+		problem.Write(w, r, apperror.ErrProductNotFound)
 		return
 	}
-	err = h.ProductRepository.Delete(id)
+	err = h.ProductRepository.Delete(r.Context(), id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
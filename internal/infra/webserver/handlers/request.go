@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/andre2ar/go-products/internal/apperror"
+	"github.com/andre2ar/go-products/internal/infra/tracing"
+	"github.com/andre2ar/go-products/pkg/validator"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// parseForm parses the form of r like r.ParseForm, reporting a body over
+// the size limit as decodeJSON does.
+func parseForm(r *http.Request) error {
+	err := r.ParseForm()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return apperror.ErrBodyTooLarge.Wrap(err)
+	}
+	if err != nil {
+		return apperror.ErrInvalidBody.Wrap(err)
+	}
+	return nil
+}
+
+// decodeJSON decodes the request body into the struct pointed to by v and
+// validates it, reporting unknown fields, type mismatches and rule
+// violations together as a single validation error. Each field is checked
+// for a type mismatch on its own, as json.Unmarshal only reports the first.
+func decodeJSON(r *http.Request, v interface{}) error {
+	_, span := tracing.Start(r.Context(), "decodeJSON")
+	defer span.End()
+
+	body, err := io.ReadAll(r.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return apperror.ErrBodyTooLarge.Wrap(err)
+	}
+	if err != nil {
+		return apperror.ErrInvalidBody.Wrap(err)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return apperror.ErrInvalidBody.Wrap(err)
+	}
+
+	var fields []apperror.FieldError
+	invalid := map[string]bool{}
+	known := knownFields(v)
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field, ok := known[strings.ToLower(key)]
+		if !ok {
+			fields = append(fields, apperror.FieldError{Field: key, Code: "unknown", Message: key + " is not a known field"})
+			continue
+		}
+
+		var typeErr *json.UnmarshalTypeError
+		if err := json.Unmarshal(raw[key], reflect.New(field.typ).Interface()); errors.As(err, &typeErr) {
+			name := field.name
+			if typeErr.Field != "" {
+				name += "." + typeErr.Field
+			}
+			invalid[field.name] = true
+			fields = append(fields, apperror.FieldError{Field: name, Code: "type", Message: name + " must be a " + typeErr.Type.String()})
+		}
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if err := json.Unmarshal(body, v); err != nil && !errors.As(err, &typeErr) {
+		return apperror.ErrInvalidBody.Wrap(err)
+	}
+
+	if err := validator.Validate(v); err != nil {
+		for _, fieldErr := range apperror.From(err).Fields {
+			if !invalid[fieldErr.Field] {
+				fields = append(fields, fieldErr)
+			}
+		}
+	}
+
+	if len(fields) > 0 {
+		return apperror.Validation(fields...)
+	}
+	return nil
+}
+
+// jsonField is a field of a request body: its JSON name and Go type.
+type jsonField struct {
+	name string
+	typ  reflect.Type
+}
+
+// knownFields returns the fields of the struct pointed to by v, keyed by
+// their lowercased JSON name, which json.Unmarshal matches without case.
+func knownFields(v interface{}) map[string]jsonField {
+	t := reflect.Indirect(reflect.ValueOf(v)).Type()
+	known := make(map[string]jsonField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		if name != "-" {
+			known[strings.ToLower(name)] = jsonField{name: name, typ: t.Field(i).Type}
+		}
+	}
+	return known
+}
@@ -1,103 +1,363 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"github.com/andre2ar/go-products/internal/apperror"
 	"github.com/andre2ar/go-products/internal/dto"
 	"github.com/andre2ar/go-products/internal/entity"
 	"github.com/andre2ar/go-products/internal/infra/database"
-	"github.com/go-chi/jwtauth/v5"
+	"github.com/andre2ar/go-products/internal/infra/metrics"
+	"github.com/andre2ar/go-products/internal/infra/tracing"
+	"github.com/andre2ar/go-products/internal/infra/webserver/accesstoken"
+	"github.com/andre2ar/go-products/internal/infra/webserver/middlewares"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	"gorm.io/gorm"
+	"math"
 	"net/http"
-	"time"
+	"strconv"
+	"strings"
 )
 
-type Error struct {
-	Message string `json:"message"`
-}
-
 type UserHandler struct {
-	UserRepository database.UserRepositoryInterface
+	UserRepository           database.UserRepositoryInterface
+	TransactionManager       database.TransactionManagerInterface
+	EmailVerification        *EmailVerificationHandler
+	MFA                      *MFAHandler
+	LoginGuard               *LoginGuard
+	RequireEmailVerification bool
+	Metrics                  *metrics.Metrics
 }
 
-func NewUserHandler(userRepository database.UserRepositoryInterface) *UserHandler {
-	return &UserHandler{UserRepository: userRepository}
+func NewUserHandler(
+	userRepository database.UserRepositoryInterface,
+	transactionManager database.TransactionManagerInterface,
+	emailVerification *EmailVerificationHandler,
+	mfa *MFAHandler,
+	loginGuard *LoginGuard,
+	requireEmailVerification bool,
+	metrics *metrics.Metrics,
+) *UserHandler {
+	return &UserHandler{
+		UserRepository:           userRepository,
+		TransactionManager:       transactionManager,
+		EmailVerification:        emailVerification,
+		MFA:                      mfa,
+		LoginGuard:               loginGuard,
+		RequireEmailVerification: requireEmailVerification,
+		Metrics:                  metrics,
+	}
 }
 
 // CreateSession godoc
 // @Summary      Create Session
-// @Description  Create Session
+// @Description  Create Session. Users with two-factor authentication get a challenge token to complete the login through /sessions/mfa instead of an access token
 // @Tags         users
 // @Accept       json
 // @Produce      json
 // @Param        request   body     dto.LoginCredentialsInput  true  "user credentials"
 // @Success      200  {object}  dto.AuthResponse
-// @Failure      404  {object}  Error
-// @Failure      500  {object}  Error
+// @Success      202  {object}  dto.MFAChallengeResponse
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
 // @Router       /api/v1/sessions [post]
 func (h *UserHandler) CreateSession(w http.ResponseWriter, r *http.Request) {
-	jwt := r.Context().Value("Jwt").(*jwtauth.JWTAuth)
-	jwtExpiresIn := r.Context().Value("JwtExpiresIn").(int)
-
 	var loginCredentials dto.LoginCredentialsInput
-	err := json.NewDecoder(r.Body).Decode(&loginCredentials)
+	err := decodeJSON(r, &loginCredentials)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		problem.Write(w, r, err)
 		return
 	}
 
-	user, err := h.UserRepository.FindByEmail(loginCredentials.Email)
-	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		err := Error{Message: err.Error()}
-		json.NewEncoder(w).Encode(err)
+	// Throttled attempts are refused before any password is hashed.
+	attempt, retryAfter := h.LoginGuard.Check(r, loginCredentials.Email)
+	if attempt == nil {
+		h.Metrics.Login(metrics.LoginPassword, metrics.LoginThrottled)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		problem.Write(w, r, apperror.ErrTooManyRequests)
 		return
 	}
+	defer attempt.Release()
 
-	if !user.ValidatePassword(loginCredentials.Password) {
-		w.WriteHeader(http.StatusUnauthorized)
+	user, err := h.UserRepository.FindByEmail(r.Context(), loginCredentials.Email)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.Write(w, r, err)
 		return
 	}
 
-	_, tokenString, _ := jwt.Encode(map[string]interface{}{
-		"sub": user.ID.String(),
-		"exp": time.Now().Add(time.Second * time.Duration(jwtExpiresIn)).Unix(),
-	})
+	if !checkPassword(r.Context(), user, loginCredentials.Password) {
+		attempt.Failure()
+		h.Metrics.Login(metrics.LoginPassword, metrics.LoginFailure)
+		problem.Write(w, r, apperror.ErrInvalidCredentials)
+		return
+	}
+	attempt.Success()
 
-	accessToken := dto.AuthResponse{AccessToken: tokenString}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(accessToken)
+	if rejection := loginRejection(user, h.RequireEmailVerification); rejection != nil {
+		h.Metrics.Login(metrics.LoginPassword, metrics.LoginRejected)
+		problem.Write(w, r, rejection)
+		return
+	}
+
+	if user.IsMFAEnabled() {
+		h.Metrics.Login(metrics.LoginPassword, metrics.LoginMFARequired)
+		h.MFA.writeChallenge(w, user)
+		return
+	}
+
+	h.Metrics.Login(metrics.LoginPassword, metrics.LoginSuccess)
+	writeAccessToken(w, r, user)
+}
+
+// loginRejection returns why user may not log in although it authenticated,
+// or nil when it may.
+func loginRejection(user *entity.User, requireEmailVerification bool) error {
+	switch {
+	case user.IsSuspended():
+		return apperror.ErrAccountSuspended
+	case requireEmailVerification && !user.IsEmailVerified():
+		return apperror.ErrEmailNotVerified
+	case user.PasswordResetRequired:
+		return apperror.ErrPasswordResetRequired
+	}
+	return nil
 }
 
 // CreateUser    godoc
 // @Summary      Create user
-// @Description  Create user
+// @Description  Create user and email it a link to verify its address
 // @Tags         users
 // @Accept       json
 // @Produce      json
 // @Param        request     body      dto.CreateUserInput  true  "user request"
 // @Success      201
-// @Failure      500         {object}  Error
+// @Failure      400         {object}  problem.Problem
+// @Failure      409         {object}  problem.Problem
+// @Failure      429         {object}  problem.Problem
+// @Failure      500         {object}  problem.Problem
 // @Router       /api/v1/users [post]
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	var user dto.CreateUserInput
-	err := json.NewDecoder(r.Body).Decode(&user)
+	err := decodeJSON(r, &user)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		problem.Write(w, r, err)
 		return
 	}
 	u, err := entity.NewUser(user.Name, user.Email, user.Password)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		errorResponse := Error{Message: err.Error()}
-		json.NewEncoder(w).Encode(errorResponse)
+		problem.Write(w, r, err)
 		return
 	}
-	err = h.UserRepository.Create(u)
+	err = h.UserRepository.Create(r.Context(), u)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		errorResponse := Error{Message: err.Error()}
-		json.NewEncoder(w).Encode(errorResponse)
+		problem.Write(w, r, err)
 		return
 	}
+	h.EmailVerification.SendVerificationLink(r.Context(), u)
 	w.WriteHeader(http.StatusCreated)
 }
+
+// GetCurrentUser godoc
+// @Summary      Get current user
+// @Description  Get the profile of the authenticated user
+// @Tags         users
+// @Produce      json
+// @Success      200  {object}  entity.User
+// @Failure      401  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Router       /api/v1/users/me [get]
+// @Security ApiKeyAuth
+func (h *UserHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserFromContext(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
+}
+
+// UpdateCurrentUser godoc
+// @Summary      Update current user
+// @Description  Update the name or email of the authenticated user. A new email must be verified again
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        request  body      dto.UpdateUserInput  true  "fields to update"
+// @Success      200      {object}  entity.User
+// @Failure      400      {object}  problem.Problem
+// @Failure      401      {object}  problem.Problem
+// @Failure      409      {object}  problem.Problem
+// @Failure      429      {object}  problem.Problem
+// @Failure      500      {object}  problem.Problem
+// @Router       /api/v1/users/me [patch]
+// @Security ApiKeyAuth
+func (h *UserHandler) UpdateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserFromContext(r.Context())
+
+	var input dto.UpdateUserInput
+	err := decodeJSON(r, &input)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	var fields []string
+	if input.Name != nil {
+		user.Name = strings.TrimSpace(*input.Name)
+		fields = append(fields, "Name")
+	}
+	emailChanged := input.Email != nil && user.ChangeEmail(*input.Email)
+	if emailChanged {
+		fields = append(fields, "Email", "EmailVerifiedAt")
+	}
+
+	if len(fields) > 0 {
+		err = h.UserRepository.Update(r.Context(), user, fields...)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+	}
+	if emailChanged {
+		h.EmailVerification.SendVerificationLink(r.Context(), user)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
+}
+
+// DeleteCurrentUser godoc
+// @Summary      Delete current user
+// @Description  Delete the account of the authenticated user, along with its API keys, recovery codes, password resets and linked identities
+// @Tags         users
+// @Accept       json
+// @Param        request  body  dto.DeleteUserInput  true  "current password"
+// @Success      204
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /api/v1/users/me [delete]
+// @Security ApiKeyAuth
+func (h *UserHandler) DeleteCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserFromContext(r.Context())
+
+	var input dto.DeleteUserInput
+	err := decodeJSON(r, &input)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	// A token alone is not enough to delete the account, so a leaked one
+	// cannot.
+	if !user.ValidatePassword(input.Password) {
+		problem.Write(w, r, apperror.ErrInvalidCredentials)
+		return
+	}
+
+	err = h.TransactionManager.WithinTransaction(r.Context(), func(ctx context.Context, repositories *database.Repositories) error {
+		userID := user.ID.String()
+		if err := repositories.APIKeys.DeleteByUser(ctx, userID); err != nil {
+			return err
+		}
+		if err := repositories.RecoveryCodes.Replace(ctx, userID, nil); err != nil {
+			return err
+		}
+		if err := repositories.PasswordResets.DeleteByUser(ctx, userID); err != nil {
+			return err
+		}
+		if err := repositories.Identities.DeleteByUser(ctx, userID); err != nil {
+			return err
+		}
+		return repositories.Users.Delete(ctx, userID)
+	})
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangePassword godoc
+// @Summary      Change password
+// @Description  Change the password of the authenticated user, revoking every other session
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        request  body      dto.ChangePasswordInput  true  "current and new password"
+// @Success      200      {object}  dto.AuthResponse
+// @Failure      400      {object}  problem.Problem
+// @Failure      401      {object}  problem.Problem
+// @Failure      429      {object}  problem.Problem
+// @Failure      500      {object}  problem.Problem
+// @Router       /api/v1/users/me/password [post]
+// @Security ApiKeyAuth
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserFromContext(r.Context())
+
+	var input dto.ChangePasswordInput
+	err := decodeJSON(r, &input)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	if !user.ValidatePassword(input.CurrentPassword) {
+		problem.Write(w, r, apperror.ErrInvalidCredentials)
+		return
+	}
+
+	err = user.ChangePassword(input.NewPassword)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	err = h.UserRepository.Update(r.Context(), user, "Password", "PasswordResetRequired", "SessionVersion", "SessionsRevokedAt")
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	writeAccessToken(w, r, user)
+}
+
+// checkPassword reports whether password is the one of user, spending as
+// long hashing it when there is no user so response times do not reveal
+// which emails have an account. The hashing gets a span of its own, being
+// by design the slowest step of a login.
+func checkPassword(ctx context.Context, user *entity.User, password string) bool {
+	_, span := tracing.Start(ctx, "checkPassword")
+	defer span.End()
+
+	if user == nil {
+		entity.RejectPassword(password)
+		return false
+	}
+	return user.ValidatePassword(password)
+}
+
+// writeAccessToken issues a token for user, bound to its current session
+// version, and writes it as the response.
+func writeAccessToken(w http.ResponseWriter, r *http.Request, user *entity.User) {
+	tokens := r.Context().Value("Jwt").(*accesstoken.Authority)
+
+	signed, _, err := tokens.Issue(user.ID.String(), map[string]interface{}{
+		middlewares.SessionVersionClaim: user.SessionVersion,
+	})
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	accessToken := dto.AuthResponse{AccessToken: signed}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(accessToken)
+}
@@ -0,0 +1,98 @@
+package webserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/andre2ar/go-products/internal/infra/database"
+	"github.com/andre2ar/go-products/internal/infra/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func decodeHealth(t *testing.T, res *http.Response) health.Report {
+	t.Helper()
+
+	assert.Equal(t, "no-store", res.Header.Get("Cache-Control"))
+	var report health.Report
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&report))
+
+	return report
+}
+
+func TestLiveness(t *testing.T) {
+	server := newTestServer(t)
+
+	res := doRequest(t, http.MethodGet, server.URL+"/healthz", "", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, health.StatusOK, decodeHealth(t, res).Status)
+}
+
+func TestReadinessChecksDatabaseAndWorkers(t *testing.T) {
+	checks := health.New(time.Second)
+	workerErr := errors.New("mail worker is not running")
+	var workerDown atomic.Bool
+	checks.Add("mail_queue", func(ctx context.Context) error {
+		if workerDown.Load() {
+			return workerErr
+		}
+		return nil
+	})
+	server := newTestServer(t, withDependencies(Dependencies{
+		Health: checks,
+	}))
+
+	workerDown.Store(true)
+	require.NoError(t, server.DB.Migrator().DropTable("external_identities"))
+	res := doRequest(t, http.MethodGet, server.URL+"/readyz", "", nil)
+	require.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	report := decodeHealth(t, res)
+	assert.Equal(t, health.StatusFailing, report.Status)
+	assert.Equal(t, health.StatusOK, report.Checks["database"].Status)
+	assert.Equal(t, "pending migrations: external_identities", report.Checks["migrations"].Error)
+	assert.Equal(t, workerErr.Error(), report.Checks["mail_queue"].Error)
+
+	workerDown.Store(false)
+	require.NoError(t, database.Migrate(server.DB))
+	res = doRequest(t, http.MethodGet, server.URL+"/readyz", "", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	report = decodeHealth(t, res)
+	assert.Equal(t, health.StatusOK, report.Status)
+	assert.Equal(t, health.StatusOK, report.Checks["database"].Status)
+	assert.Equal(t, health.StatusOK, report.Checks["migrations"].Status)
+	assert.Equal(t, health.StatusOK, report.Checks["mail_queue"].Status)
+}
+
+func TestReadinessToleratesDegradedChecks(t *testing.T) {
+	checks := health.New(time.Second)
+	checks.Add("mail_queue", func(ctx context.Context) error { return health.Degraded(errors.New("mail queue is full")) })
+	server := newTestServer(t, withDependencies(Dependencies{
+		Health: checks,
+	}))
+
+	res := doRequest(t, http.MethodGet, server.URL+"/readyz", "", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	report := decodeHealth(t, res)
+	assert.Equal(t, health.StatusDegraded, report.Status)
+	assert.Equal(t, "mail queue is full", report.Checks["mail_queue"].Error)
+}
+
+func TestReadinessFailsOnceDraining(t *testing.T) {
+	checks := health.New(time.Second)
+	server := newTestServer(t, withDependencies(Dependencies{
+		Health: checks,
+	}))
+
+	checks.Drain()
+
+	res := doRequest(t, http.MethodGet, server.URL+"/readyz", "", nil)
+	require.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, health.ErrDraining.Error(), decodeHealth(t, res).Checks["shutdown"].Error)
+
+	res = doRequest(t, http.MethodGet, server.URL+"/healthz", "", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode, "the process is still alive")
+}
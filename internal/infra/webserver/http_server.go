@@ -0,0 +1,121 @@
+package webserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/andre2ar/go-products/configs"
+	"github.com/andre2ar/go-products/internal/infra/metrics"
+	"github.com/andre2ar/go-products/pkg/tlscert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// NewServer returns the HTTP server running handler, bounded by the
+// timeouts and header size limit of config so slow or oversized requests
+// can not hold connections. With a certificate configured it serves TLS,
+// negotiating HTTP/2, and reloads the certificate when its files change;
+// otherwise it accepts HTTP/2 without TLS (h2c) when enabled.
+func NewServer(config *configs.Conf, handler http.Handler, logger *slog.Logger) (*http.Server, error) {
+	server := &http.Server{
+		Handler:           handler,
+		ReadTimeout:       time.Duration(config.WebServerReadTimeout) * time.Second,
+		ReadHeaderTimeout: time.Duration(config.WebServerReadHeaderTimeout) * time.Second,
+		WriteTimeout:      time.Duration(config.WebServerWriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(config.WebServerIdleTimeout) * time.Second,
+		MaxHeaderBytes:    config.WebServerMaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+
+	switch {
+	case config.WebServerTLSCertFile != "":
+		certificates, err := tlscert.New(config.WebServerTLSCertFile, config.WebServerTLSKeyFile, logger)
+		if err != nil {
+			return nil, err
+		}
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certificates.GetCertificate,
+		}
+	case config.WebServerH2C:
+		server.Handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: server.IdleTimeout})
+	}
+
+	return server, nil
+}
+
+// NewMetricsServer returns the HTTP server exposing m at /metrics. It
+// listens apart from the API, on an address only the scraper reaches, and
+// is bounded by the same timeouts.
+func NewMetricsServer(config *configs.Conf, m *metrics.Metrics, logger *slog.Logger) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+
+	return &http.Server{
+		Handler:           mux,
+		ReadTimeout:       time.Duration(config.WebServerReadTimeout) * time.Second,
+		ReadHeaderTimeout: time.Duration(config.WebServerReadHeaderTimeout) * time.Second,
+		WriteTimeout:      time.Duration(config.WebServerWriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(config.WebServerIdleTimeout) * time.Second,
+		MaxHeaderBytes:    config.WebServerMaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+}
+
+// Listen opens the listener of the server: the Unix domain socket of config
+// when set, or its TCP port otherwise. A socket file left behind by a
+// server which did not stop cleanly is replaced, while one still accepting
+// connections is reported as in use.
+func Listen(config *configs.Conf) (net.Listener, error) {
+	if config.WebServerSocket == "" {
+		return net.Listen("tcp", ":"+config.WebServerPort)
+	}
+
+	info, err := os.Stat(config.WebServerSocket)
+	if err == nil && info.Mode().Type() == fs.ModeSocket {
+		conn, err := net.Dial("unix", config.WebServerSocket)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is in use", config.WebServerSocket)
+		}
+		err = os.Remove(config.WebServerSocket)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return net.Listen("unix", config.WebServerSocket)
+}
+
+// Serve serves server on listener until it is shut down, over TLS when it
+// has a TLS configuration. It returns nil once the server was shut down.
+func Serve(server *http.Server, listener net.Listener) error {
+	var err error
+	if server.TLSConfig != nil {
+		err = server.ServeTLS(listener, "", "")
+	} else {
+		err = server.Serve(listener)
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// ServerURL returns where the server configured by config can be reached.
+func ServerURL(config *configs.Conf) string {
+	if config.WebServerSocket != "" {
+		return "unix:" + config.WebServerSocket
+	}
+	if config.WebServerTLSCertFile != "" {
+		return "https://localhost:" + config.WebServerPort
+	}
+	return "http://localhost:" + config.WebServerPort
+}
@@ -0,0 +1,192 @@
+package webserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/andre2ar/go-products/configs"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/pkg/tlscert/tlscerttest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// protoHandler answers with the protocol of the request.
+var protoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, r.Proto)
+})
+
+// startServer serves handler as configured by configure, on a free port
+// unless it sets a socket, and returns the address it listens on.
+func startServer(t *testing.T, configure func(config *configs.Conf), handler http.Handler) string {
+	t.Helper()
+
+	config := configs.Defaults()
+	config.WebServerPort = "0"
+	configure(&config)
+
+	server, err := NewServer(&config, handler, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	listener, err := Listen(&config)
+	require.NoError(t, err)
+	done := make(chan error)
+	go func() { done <- Serve(server, listener) }()
+	t.Cleanup(func() {
+		require.NoError(t, server.Shutdown(context.Background()))
+		assert.NoError(t, <-done)
+	})
+
+	return listener.Addr().String()
+}
+
+func readBody(t *testing.T, res *http.Response) string {
+	t.Helper()
+
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestRequestBodiesAreLimited(t *testing.T) {
+	server := newTestServer(t, withConfig(func(config *configs.Conf) {
+		config.WebServerMaxBodyBytes = 64
+	}))
+	body := `{"name": "` + strings.Repeat("a", 100) + `", "email": "j@j.com", "password": "secret123"}`
+
+	res, err := http.Post(server.URL+"/api/v1/users", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	assert.Equal(t, "body_too_large", decodeProblem(t, res).Code)
+
+	// Without a Content-Length, the body is cut once the limit is read.
+	res, err = http.Post(server.URL+"/api/v1/users", "application/json", io.MultiReader(strings.NewReader(body)))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	assert.Equal(t, "body_too_large", decodeProblem(t, res).Code)
+}
+
+func TestSlowRequestHeadersAreTimedOut(t *testing.T) {
+	addr := startServer(t, func(config *configs.Conf) {
+		config.WebServerReadHeaderTimeout = 1
+	}, protoHandler)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n")
+	require.NoError(t, err)
+
+	start := time.Now()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = bufio.NewReader(conn).ReadString('\n')
+	assert.Error(t, err, "the connection is closed without an answer")
+	assert.Less(t, time.Since(start), 3*time.Second)
+}
+
+// unixClient returns a client sending every request to socket.
+func unixClient(socket string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+}
+
+func TestServeOverUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "api.sock")
+	startServer(t, func(config *configs.Conf) {
+		config.WebServerSocket = socket
+	}, protoHandler)
+
+	client := unixClient(socket)
+	res, err := client.Get("http://unix/")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1", readBody(t, res))
+
+	_, err = Listen(&configs.Conf{WebServerSocket: socket})
+	assert.ErrorContains(t, err, "in use")
+}
+
+func TestServeOverUnixSocketTellsClientsApart(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "api.sock")
+	configure := func(config *configs.Conf) {
+		config.WebServerSocket = socket
+	}
+	api := newTestServer(t, withConfig(configure), withConfig(func(config *configs.Conf) {
+		config.WebServerTrustedProxies = ""
+		config.LoginIPMaxAttempts = 1
+	}))
+	startServer(t, configure, api.Config.Handler)
+
+	client := unixClient(socket)
+	loginFrom := func(ip string) int {
+		body, err := json.Marshal(dto.LoginCredentialsInput{Email: "j@j.com", Password: "wrong-password"})
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, "http://unix/api/v1/sessions", bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", ip)
+
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, loginFrom("10.0.0.1"))
+	assert.Equal(t, http.StatusTooManyRequests, loginFrom("10.0.0.1"))
+	assert.Equal(t, http.StatusUnauthorized, loginFrom("10.0.0.2"), "clients behind the proxy on the socket are throttled apart")
+}
+
+func TestServeTLSNegotiatesHTTP2(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	require.NoError(t, tlscerttest.Write(certFile, keyFile, "localhost"))
+	addr := startServer(t, func(config *configs.Conf) {
+		config.WebServerTLSCertFile = certFile
+		config.WebServerTLSKeyFile = keyFile
+	}, protoHandler)
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	res, err := client.Get("https://" + addr + "/")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", readBody(t, res))
+}
+
+func TestServeH2C(t *testing.T) {
+	addr := startServer(t, func(config *configs.Conf) {
+		config.WebServerH2C = true
+	}, protoHandler)
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	res, err := client.Get("http://" + addr + "/")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", readBody(t, res))
+
+	res, err = http.Get("http://" + addr + "/")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1", readBody(t, res), "HTTP/1.1 clients are still served")
+}
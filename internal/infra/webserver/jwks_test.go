@@ -0,0 +1,92 @@
+package webserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/andre2ar/go-products/configs"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writePEMKey(t *testing.T, key interface{}) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	return path
+}
+
+func TestTokensVerifyOfflineWithJWKS(t *testing.T) {
+	_, current, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	next, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	spec := "2024-01=" + writePEMKey(t, current) + ",2099-01=" + writePEMKey(t, next) + "@2099-01-01T00:00:00Z"
+
+	server := newTestServer(t, withConfig(func(config *configs.Conf) {
+		keys, err := configs.LoadTokenKeys(spec, config.JWTSecret, time.Hour)
+		require.NoError(t, err)
+		config.TokenKeys = keys
+	}))
+	token := signUpAndLogin(t, server)
+
+	res := doRequest(t, http.MethodGet, server.URL+"/.well-known/jwks.json", "", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	set, err := jwk.Parse(body)
+	require.NoError(t, err)
+	assert.Equal(t, 2, set.Len(), "the scheduled key is published ahead of time")
+
+	message, err := jws.Parse([]byte(token))
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01", message.Signatures()[0].ProtectedHeaders().KeyID())
+	assert.Equal(t, "EdDSA", message.Signatures()[0].ProtectedHeaders().Algorithm().String())
+
+	parsed, err := jwt.Parse([]byte(token), jwt.WithKeySet(set))
+	require.NoError(t, err)
+	assert.NotEmpty(t, parsed.Subject())
+
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/products", token, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestTokensSignedByUnknownKeysAreRejected(t *testing.T) {
+	server := newTestServer(t)
+	signUpAndLogin(t, server)
+
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherKeys, err := configs.LoadTokenKeys("default="+writePEMKey(t, other), "secret", time.Hour)
+	require.NoError(t, err)
+	token := jwt.New()
+	require.NoError(t, token.Set(jwt.SubjectKey, "someone"))
+	require.NoError(t, token.Set(jwt.ExpirationKey, time.Now().Add(time.Hour)))
+	forged, err := otherKeys.Sign(token)
+	require.NoError(t, err)
+
+	res := doRequest(t, http.MethodGet, server.URL+"/api/v1/products", string(forged), nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	res = doRequest(t, http.MethodGet, server.URL+"/.well-known/jwks.json", "", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"keys":[]}`, string(body), "shared secrets are never published")
+}
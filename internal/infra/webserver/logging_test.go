@@ -0,0 +1,79 @@
+package webserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe to write from the server while the test
+// reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// records returns the JSON records written so far with msg.
+func (b *syncBuffer) records(t *testing.T, msg string) []map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(b.buf.Bytes()))
+	for scanner.Scan() {
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		if record["msg"] == msg {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func TestRequestsAreLoggedAsJSON(t *testing.T) {
+	var logs syncBuffer
+	logger, err := logging.New(&logs, "info", "json")
+	require.NoError(t, err)
+	server := newTestServer(t, withDependencies(Dependencies{Logger: logger}))
+	token := signUpAndLogin(t, server)
+	user := getCurrentUser(t, server, token)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/products", token, dto.CreateProductInput{Name: "Product", Price: 10})
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/products/"+user.ID.String(), token, nil)
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	var record map[string]interface{}
+	require.Eventually(t, func() bool {
+		for _, candidate := range logs.records(t, "request") {
+			if candidate["route"] == "/api/v1/products/{id}" {
+				record = candidate
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, http.MethodGet, record["method"])
+	assert.Equal(t, "/api/v1/products/"+user.ID.String(), record["path"])
+	assert.Equal(t, float64(http.StatusNotFound), record["status"])
+	assert.Equal(t, user.ID.String(), record["user_id"])
+	assert.NotEmpty(t, record["request_id"])
+	assert.Contains(t, record, "latency_ms")
+	assert.Greater(t, record["bytes"], float64(0))
+}
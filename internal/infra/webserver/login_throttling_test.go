@@ -0,0 +1,147 @@
+package webserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/andre2ar/go-products/configs"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// loginFrom attempts a login as if the request came from ip through a proxy
+// setting X-Real-IP.
+func loginFrom(t *testing.T, server *testServer, ip, email, password string) *http.Response {
+	t.Helper()
+
+	body, err := json.Marshal(dto.LoginCredentialsInput{Email: email, Password: password})
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/sessions", bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Real-IP", ip)
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+
+	return res
+}
+
+func TestLoginFailuresAreProgressivelyDelayed(t *testing.T) {
+	server := newTestServer(t)
+	signUp(t, server, "John Doe", "j@j.com", "secret123")
+
+	for i := 0; i < 4; i++ {
+		res := loginFrom(t, server, "10.0.0.1", "j@j.com", "wrong-password")
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+
+	res := loginFrom(t, server, "10.0.0.1", "J@j.com", "secret123")
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(t, "1", res.Header.Get("Retry-After"))
+	assert.Equal(t, "too_many_requests", decodeProblem(t, res).Code)
+}
+
+func TestParallelLoginFailuresAreDelayed(t *testing.T) {
+	server := newTestServer(t)
+	signUp(t, server, "John Doe", "j@j.com", "secret123")
+
+	statuses := make(chan int, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(statuses); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- loginFrom(t, server, "10.0.0.1", "j@j.com", "wrong-password").StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	var failures int
+	for status := range statuses {
+		if status == http.StatusUnauthorized {
+			failures++
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, status)
+		}
+	}
+	assert.LessOrEqual(t, failures, 4, "only the attempts allowed before the first delay are checked")
+}
+
+func TestAccountLockout(t *testing.T) {
+	server := newTestServer(t, withConfig(func(config *configs.Conf) {
+		config.LoginBaseDelay = 0
+	}))
+	signUp(t, server, "John Doe", "j@j.com", "secret123")
+	signUp(t, server, "Jane Doe", "jane@j.com", "secret123")
+
+	for _, email := range []string{"j@j.com", "unknown@j.com"} {
+		for i := 0; i < 5; i++ {
+			res := loginFrom(t, server, "10.0.0.1", email, "wrong-password")
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		}
+
+		res := loginFrom(t, server, "10.0.0.2", email, "secret123")
+		assert.Equal(t, http.StatusTooManyRequests, res.StatusCode, "unknown emails lock out like accounts")
+		retryAfter, err := strconv.Atoi(res.Header.Get("Retry-After"))
+		require.NoError(t, err)
+		assert.InDelta(t, 900, retryAfter, 1)
+	}
+
+	res := loginFrom(t, server, "10.0.0.1", "jane@j.com", "secret123")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	events, err := database.NewAuditEvent(server.DB).FindByType(context.Background(), entity.AuditLoginAccountLockout)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "unknown@j.com", events[0].Email)
+	assert.Equal(t, "j@j.com", events[1].Email)
+	assert.Equal(t, "10.0.0.1", events[1].IP)
+}
+
+func TestSuccessfulLoginResetsAccountFailures(t *testing.T) {
+	server := newTestServer(t, withConfig(func(config *configs.Conf) {
+		config.LoginBaseDelay = 0
+	}))
+	signUp(t, server, "John Doe", "j@j.com", "secret123")
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 4; i++ {
+			res := loginFrom(t, server, "10.0.0.1", "j@j.com", "wrong-password")
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		}
+		res := loginFrom(t, server, "10.0.0.1", "j@j.com", "secret123")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	}
+}
+
+func TestIPLockout(t *testing.T) {
+	server := newTestServer(t, withConfig(func(config *configs.Conf) {
+		config.LoginIPMaxAttempts = 3
+	}))
+	signUp(t, server, "John Doe", "j@j.com", "secret123")
+
+	for _, email := range []string{"a@j.com", "b@j.com", "c@j.com"} {
+		res := loginFrom(t, server, "10.0.0.1", email, "wrong-password")
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+
+	res := loginFrom(t, server, "10.0.0.1", "j@j.com", "secret123")
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	res = loginFrom(t, server, "10.0.0.2", "j@j.com", "secret123")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	events, err := database.NewAuditEvent(server.DB).FindByType(context.Background(), entity.AuditLoginIPLockout)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "10.0.0.1", events[0].IP)
+}
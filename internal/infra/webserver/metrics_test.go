@@ -0,0 +1,115 @@
+package webserver
+
+import (
+	"github.com/andre2ar/go-products/configs"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/internal/infra/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newMetricsTestServer starts a test server along with the metrics server
+// exposing its metrics.
+func newMetricsTestServer(t *testing.T) (server *testServer, metricsServer *httptest.Server) {
+	t.Helper()
+
+	config := configs.Defaults()
+	m := metrics.New()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server = newTestServer(t, withDependencies(Dependencies{Logger: logger, Metrics: m}))
+	metricsServer = httptest.NewServer(NewMetricsServer(&config, m, logger).Handler)
+	t.Cleanup(metricsServer.Close)
+
+	return server, metricsServer
+}
+
+// scrapeMetrics returns the metrics exposed by metricsServer in the text
+// format.
+func scrapeMetrics(t *testing.T, metricsServer *httptest.Server) string {
+	t.Helper()
+
+	res := doRequest(t, http.MethodGet, metricsServer.URL+"/metrics", "", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	return string(body)
+}
+
+// metricLine returns the sample of metrics whose name and labels start with
+// series, or an empty string.
+func metricLine(metrics, series string) string {
+	for _, line := range strings.Split(metrics, "\n") {
+		if strings.HasPrefix(line, series) {
+			return line
+		}
+	}
+	return ""
+}
+
+func TestMetricsAreNotServedByTheAPI(t *testing.T) {
+	server := newTestServer(t)
+
+	res := doRequest(t, http.MethodGet, server.URL+"/metrics", "", nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestMetricsExposeHTTPRequests(t *testing.T) {
+	server, metricsServer := newMetricsTestServer(t)
+	token := signUpAndLogin(t, server)
+
+	res := doRequest(t, http.MethodGet, server.URL+"/api/v1/products/8b7a6b9e-6c1e-4a4e-9d9c-0f6a0a4b1a11", token, nil)
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+	res = doRequest(t, http.MethodGet, server.URL+"/unknown/path", "", nil)
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	metrics := scrapeMetrics(t, metricsServer)
+	assert.Equal(t, `http_requests_total{method="GET",route="/api/v1/products/{id}",status="404"} 1`,
+		metricLine(metrics, `http_requests_total{method="GET",route="/api/v1/products/{id}"`))
+	assert.Equal(t, `http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		metricLine(metrics, `http_requests_total{method="GET",route="unmatched"`))
+	assert.NotEmpty(t, metricLine(metrics, `http_request_duration_seconds_count{method="POST",route="/api/v1/sessions",status="200"}`))
+	assert.NotContains(t, metrics, "/unknown/path")
+}
+
+func TestMetricsExposeLoginAttempts(t *testing.T) {
+	server, metricsServer := newMetricsTestServer(t)
+	signUpAndLogin(t, server)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{Email: "j@j.com", Password: "wrong"})
+	require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	token := login(t, server, "j@j.com", "secret123")
+	enableMFA(t, server, token)
+	startMFALogin(t, server)
+
+	metrics := scrapeMetrics(t, metricsServer)
+	assert.Equal(t, `auth_login_attempts_total{method="password",result="success"} 2`,
+		metricLine(metrics, `auth_login_attempts_total{method="password",result="success"}`))
+	assert.Equal(t, `auth_login_attempts_total{method="password",result="failure"} 1`,
+		metricLine(metrics, `auth_login_attempts_total{method="password",result="failure"}`))
+	assert.Equal(t, `auth_login_attempts_total{method="password",result="mfa_required"} 1`,
+		metricLine(metrics, `auth_login_attempts_total{method="password",result="mfa_required"}`))
+}
+
+func TestMetricsExposeDatabaseQueriesAndProducts(t *testing.T) {
+	server, metricsServer := newMetricsTestServer(t)
+	token := signUpAndLogin(t, server)
+
+	for _, name := range []string{"Product 1", "Product 2"} {
+		res := doRequest(t, http.MethodPost, server.URL+"/api/v1/products", token, dto.CreateProductInput{Name: name, Price: 10})
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+	}
+
+	metrics := scrapeMetrics(t, metricsServer)
+	assert.Equal(t, "products 2", metricLine(metrics, "products "))
+	assert.Equal(t, `db_query_duration_seconds_count{operation="create",table="products"} 2`,
+		metricLine(metrics, `db_query_duration_seconds_count{operation="create",table="products"}`))
+	assert.NotEmpty(t, metricLine(metrics, `db_query_duration_seconds_count{operation="query",table="users"}`))
+	assert.NotEmpty(t, metricLine(metrics, "go_goroutines "))
+}
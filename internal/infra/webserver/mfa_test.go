@@ -0,0 +1,152 @@
+package webserver
+
+import (
+	"encoding/json"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/pkg/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// enableMFA enrolls the user of token in two-factor authentication and
+// returns its TOTP secret and recovery codes.
+func enableMFA(t *testing.T, server *testServer, token string) (string, []string) {
+	t.Helper()
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/users/me/mfa", token, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var enrollment dto.MFAEnrollmentResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&enrollment))
+
+	code, err := totp.Code(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/users/me/mfa/confirm", token, dto.MFACodeInput{Code: code})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var recovery dto.RecoveryCodesResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&recovery))
+
+	return enrollment.Secret, recovery.RecoveryCodes
+}
+
+func startMFALogin(t *testing.T, server *testServer) string {
+	t.Helper()
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{Email: "j@j.com", Password: "secret123"})
+	require.Equal(t, http.StatusAccepted, res.StatusCode)
+	var challenge dto.MFAChallengeResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&challenge))
+	require.NotEmpty(t, challenge.MFAToken)
+
+	return challenge.MFAToken
+}
+
+func TestMFAEnrollment(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/users/me/mfa/confirm", token, dto.MFACodeInput{Code: "123456"})
+	assert.Equal(t, "mfa_not_enrolled", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/users/me/mfa", token, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var enrollment dto.MFAEnrollmentResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&enrollment))
+	uri, err := url.Parse(enrollment.ProvisioningURI)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, enrollment.Secret, uri.Query().Get("secret"))
+	assert.Equal(t, "/Go Products:j@j.com", uri.Path)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/users/me/mfa/confirm", token, dto.MFACodeInput{Code: "000000"})
+	assert.Equal(t, "invalid_mfa_code", decodeProblem(t, res).Code)
+	assert.Nil(t, getCurrentUser(t, server, token).MFAEnabledAt)
+
+	code, err := totp.Code(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/users/me/mfa/confirm", token, dto.MFACodeInput{Code: code})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var recovery dto.RecoveryCodesResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&recovery))
+	assert.Len(t, recovery.RecoveryCodes, 10)
+	assert.True(t, getCurrentUser(t, server, token).IsMFAEnabled())
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/users/me/mfa", token, nil)
+	assert.Equal(t, "mfa_already_enabled", decodeProblem(t, res).Code)
+}
+
+func TestMFALoginWithAuthenticatorCode(t *testing.T) {
+	server := newTestServer(t)
+	secret, _ := enableMFA(t, server, signUpAndLogin(t, server))
+
+	mfaToken := startMFALogin(t, server)
+
+	res := doRequest(t, http.MethodGet, server.URL+"/api/v1/products", mfaToken, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "challenge tokens are not access tokens")
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions/mfa", "", dto.MFASessionInput{MFAToken: mfaToken, Code: "000000"})
+	assert.Equal(t, "invalid_mfa_code", decodeProblem(t, res).Code)
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions/mfa", "", dto.MFASessionInput{MFAToken: mfaToken + "x", Code: "000000"})
+	assert.Equal(t, "invalid_mfa_token", decodeProblem(t, res).Code)
+
+	// The code used to confirm enrollment may still be current, so log in
+	// with the next one.
+	code, err := totp.Code(secret, time.Now().Add(totp.Period))
+	require.NoError(t, err)
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions/mfa", "", dto.MFASessionInput{MFAToken: mfaToken, Code: code})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var session dto.AuthResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&session))
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/products", session.AccessToken, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions/mfa", "", dto.MFASessionInput{MFAToken: mfaToken, Code: code})
+	assert.Equal(t, "invalid_mfa_code", decodeProblem(t, res).Code, "codes are single-use")
+}
+
+func TestMFALoginWithRecoveryCode(t *testing.T) {
+	server := newTestServer(t)
+	_, recoveryCodes := enableMFA(t, server, signUpAndLogin(t, server))
+
+	mfaToken := startMFALogin(t, server)
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions/mfa", "", dto.MFASessionInput{MFAToken: mfaToken, Code: recoveryCodes[0]})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions/mfa", "", dto.MFASessionInput{MFAToken: mfaToken, Code: recoveryCodes[0]})
+	assert.Equal(t, "invalid_mfa_code", decodeProblem(t, res).Code)
+}
+
+func TestMFALoginIsRateLimited(t *testing.T) {
+	server := newTestServer(t)
+	enableMFA(t, server, signUpAndLogin(t, server))
+
+	mfaToken := startMFALogin(t, server)
+	for i := 0; i < 5; i++ {
+		res := doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions/mfa", "", dto.MFASessionInput{MFAToken: mfaToken, Code: "000000"})
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions/mfa", "", dto.MFASessionInput{MFAToken: startMFALogin(t, server), Code: "000000"})
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.NotEmpty(t, res.Header.Get("Retry-After"))
+}
+
+func TestDisableMFA(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+	enableMFA(t, server, token)
+	mfaToken := startMFALogin(t, server)
+
+	res := doRequest(t, http.MethodDelete, server.URL+"/api/v1/users/me/mfa", token, dto.DisableMFAInput{Password: "wrong-password"})
+	assert.Equal(t, "invalid_credentials", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodDelete, server.URL+"/api/v1/users/me/mfa", token, dto.DisableMFAInput{Password: "secret123"})
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	login(t, server, "j@j.com", "secret123")
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions/mfa", "", dto.MFASessionInput{MFAToken: mfaToken, Code: "000000"})
+	assert.Equal(t, "invalid_mfa_token", decodeProblem(t, res).Code)
+}
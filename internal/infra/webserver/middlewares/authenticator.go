@@ -0,0 +1,33 @@
+package middlewares
+
+import (
+	"github.com/andre2ar/go-products/internal/apperror"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	"github.com/go-chi/jwtauth/v5"
+	"net/http"
+)
+
+// Authenticator rejects requests whose token, previously verified by
+// Verifier, is missing or invalid, answering with a problem document.
+// Requests authenticated by APIKey are let through.
+func Authenticator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if UserFromContext(r.Context()) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, _, err := jwtauth.FromContext(r.Context())
+		if err != nil {
+			problem.Write(w, r, apperror.ErrUnauthorized.Wrap(err))
+			return
+		}
+
+		if token == nil {
+			problem.Write(w, r, apperror.ErrUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
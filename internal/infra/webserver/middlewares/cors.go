@@ -0,0 +1,90 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	corsAllowedMethods = "GET, POST, PATCH, DELETE"
+	corsAllowedHeaders = "Authorization, Content-Type"
+	corsExposedHeaders = "Retry-After, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset"
+	// corsMaxAge is how many seconds browsers may cache a preflight answer.
+	corsMaxAge = "600"
+)
+
+// CORSOrigins are the origins whose pages may call the API from a browser,
+// replaceable while serving. "*" allows any origin.
+type CORSOrigins struct {
+	mu        sync.RWMutex
+	anyOrigin bool
+	origins   map[string]bool
+}
+
+func NewCORSOrigins(origins []string) *CORSOrigins {
+	o := &CORSOrigins{}
+	o.Configure(origins)
+	return o
+}
+
+// Configure replaces the allowed origins, applied from the next request on.
+func (o *CORSOrigins) Configure(origins []string) {
+	allowed := map[string]bool{}
+	anyOrigin := false
+	for _, origin := range origins {
+		if origin == "*" {
+			anyOrigin = true
+		}
+		allowed[strings.TrimSuffix(strings.ToLower(origin), "/")] = true
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.anyOrigin = anyOrigin
+	o.origins = allowed
+}
+
+// Allows reports whether pages served from origin may call the API.
+func (o *CORSOrigins) Allows(origin string) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	return o.anyOrigin || o.origins[strings.ToLower(origin)]
+}
+
+// CORS lets pages of the allowed origins call the API: it answers their
+// preflight requests and lets them read the responses, including the rate
+// limit headers. Requests from other origins get no CORS headers, so
+// browsers keep their pages from reading the responses. Credentials are not
+// allowed, so pages authenticate with a bearer token rather than cookies.
+func CORS(origins *CORSOrigins) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			if !origins.Allows(origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+				w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
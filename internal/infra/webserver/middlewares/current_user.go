@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"context"
+	"github.com/andre2ar/go-products/internal/apperror"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/database"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	"github.com/andre2ar/go-products/pkg/logging"
+	"github.com/go-chi/jwtauth/v5"
+	"log/slog"
+	"net/http"
+)
+
+// SessionVersionClaim carries the user's SessionVersion at the time the
+// token was issued.
+const SessionVersionClaim = "sv"
+
+type currentUserContextKey struct{}
+
+// CurrentUser loads the user identified by the token subject, placed in the
+// context by Verifier, and rejects tokens whose user no longer exists,
+// is suspended or had its sessions revoked since the token was issued.
+// Users already loaded by APIKey are kept.
+func CurrentUser(users database.UserRepositoryInterface) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if UserFromContext(r.Context()) != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, claims, err := jwtauth.FromContext(r.Context())
+			if err != nil || token == nil {
+				problem.Write(w, r, apperror.ErrUnauthorized)
+				return
+			}
+
+			user, err := users.FindByID(r.Context(), token.Subject())
+			if err != nil {
+				problem.Write(w, r, err)
+				return
+			}
+
+			sessionVersion, _ := claims[SessionVersionClaim].(float64)
+			if user == nil || int(sessionVersion) != user.SessionVersion {
+				problem.Write(w, r, apperror.ErrUnauthorized)
+				return
+			}
+
+			if user.IsSuspended() {
+				problem.Write(w, r, apperror.ErrAccountSuspended)
+				return
+			}
+
+			ctx := logging.With(r.Context(), slog.String("user_id", user.ID.String()))
+			ctx = context.WithValue(ctx, currentUserContextKey{}, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// UserFromContext returns the user loaded by CurrentUser, if any.
+func UserFromContext(ctx context.Context) *entity.User {
+	user, _ := ctx.Value(currentUserContextKey{}).(*entity.User)
+	return user
+}
@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"github.com/andre2ar/go-products/internal/apperror"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	"net/http"
+)
+
+// MaxBodySize refuses request bodies larger than limit bytes. Bodies
+// declaring a larger Content-Length are refused before being read, while
+// the others fail once limit bytes were read. A zero limit disables the
+// middleware.
+func MaxBodySize(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				problem.Write(w, r, apperror.ErrBodyTooLarge)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package middlewares
+
+import (
+	"github.com/andre2ar/go-products/internal/infra/metrics"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// unmatchedRoute labels requests matching no route, so scanners probing
+// random paths cannot blow up the number of series.
+const unmatchedRoute = "unmatched"
+
+// Metrics counts requests and observes their duration in m, labelled by
+// method, chi route pattern and status.
+func Metrics(m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			route := unmatchedRoute
+			if routeContext := chi.RouteContext(r.Context()); routeContext != nil && routeContext.RoutePattern() != "" {
+				route = routeContext.RoutePattern()
+			}
+
+			labels := []string{r.Method, route, strconv.Itoa(status)}
+			m.HTTPRequests.WithLabelValues(labels...).Inc()
+			m.HTTPRequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package middlewares
+
+import (
+	"github.com/andre2ar/go-products/internal/apperror"
+	"github.com/andre2ar/go-products/internal/infra/webserver/accesstoken"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	"github.com/andre2ar/go-products/pkg/logging"
+	"github.com/andre2ar/go-products/pkg/ratelimit"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimit limits the requests of each client to the routes of group with
+// bucket, answering 429 with a Retry-After header once its bucket is empty.
+// Clients presenting a valid access token share a bucket per subject, the
+// others, API keys included, one per IP address. Responses carry the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers unless
+// the limit is disabled. Requests are let through when the store fails. The
+// token is verified here once for Verifier to reuse.
+func RateLimit(group string, bucket *ratelimit.TokenBucket, tokens *accesstoken.Authority) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := verify(r, tokens)
+			r = r.WithContext(ctx)
+			result, err := bucket.Take(ctx, group+":"+rateLimitKey(r))
+			if err != nil {
+				logging.FromContext(ctx).ErrorContext(ctx, "could not rate limit the request", slog.String("group", group), slog.Any("error", err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if result.Limit > 0 {
+				w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+				w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+				w.Header().Set("RateLimit-Reset", ceilSeconds(result.Reset))
+			}
+			if !result.Allowed {
+				w.Header().Set("Retry-After", ceilSeconds(result.RetryAfter))
+				problem.Write(w, r, apperror.ErrTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey identifies the client of r by the subject of its access
+// token, when valid, or by its IP address.
+func rateLimitKey(r *http.Request) string {
+	if token, ok := r.Context().Value(jwtauth.TokenCtxKey).(jwt.Token); ok && token != nil {
+		return "sub:" + token.Subject()
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,79 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// RealIP sets the RemoteAddr of requests forwarded by one of trustedProxies
+// to the address of their client, taken from X-Forwarded-For, skipping the
+// trusted proxies it went through, or else from X-Real-IP. Forwarding
+// headers of other peers are ignored, since any client can set them, so
+// rate limits and login throttling key on addresses clients cannot pick.
+// When socket is set the server listens on a Unix socket, whose peers have
+// no address and can only be local processes such as the proxy in front of
+// it, so their forwarding headers are trusted too; otherwise every client
+// would share the limits of the proxy.
+func RealIP(trustedProxies []netip.Prefix, socket bool) func(http.Handler) http.Handler {
+	trusted := func(addr netip.Addr) bool {
+		for _, prefix := range trustedProxies {
+			if prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, ok := parseAddr(r.RemoteAddr)
+			if ok && trusted(peer) || !ok && socket {
+				if client, ok := forwardedFor(r, trusted); ok {
+					r.RemoteAddr = client.String()
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedFor returns the client of a request forwarded by a trusted proxy:
+// the last address of X-Forwarded-For not trusted, as the ones before it may
+// be forged by the client, or the first when all are, falling back to
+// X-Real-IP.
+func forwardedFor(r *http.Request, trusted func(netip.Addr) bool) (netip.Addr, bool) {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	if len(hops) > 0 {
+		var client netip.Addr
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				return netip.Addr{}, false
+			}
+			client = addr
+			if !trusted(addr) {
+				break
+			}
+		}
+		return client, true
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+	return addr, err == nil
+}
+
+// parseAddr parses the address of a host:port or bare host RemoteAddr.
+func parseAddr(remoteAddr string) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	return addr, err == nil
+}
@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"fmt"
+	"github.com/andre2ar/go-products/internal/apperror"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recoverer turns panics into internal error problem documents.
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
+			}
+
+			problem.Write(w, r, apperror.ErrInternal.Wrap(fmt.Errorf("panic: %v\n%s", rvr, debug.Stack())))
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"github.com/andre2ar/go-products/pkg/logging"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// RequestLogger puts a logger carrying the request ID in the context of
+// every request and logs each request once served, with its route pattern,
+// status, latency, bytes written and the fields added by handlers and
+// middlewares through logging.With, such as the user ID. It must run after
+// middleware.RequestID.
+func RequestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			requestLogger := logger.With(slog.String("request_id", middleware.GetReqID(r.Context())))
+			ctx, entry := logging.NewEntry(logging.NewContext(r.Context(), requestLogger))
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+
+			var route string
+			if routeContext := chi.RouteContext(r.Context()); routeContext != nil {
+				route = routeContext.RoutePattern()
+			}
+
+			attrs := []any{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", route),
+				slog.Int("status", status),
+				slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.String("remote_addr", r.RemoteAddr),
+			}
+			requestLogger.Log(ctx, level, "request", append(attrs, entry.Attrs()...)...)
+		})
+	}
+}
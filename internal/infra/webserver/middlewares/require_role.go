@@ -0,0 +1,27 @@
+package middlewares
+
+import (
+	"github.com/andre2ar/go-products/internal/apperror"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	"net/http"
+)
+
+// RequireRole only lets through users loaded by CurrentUser holding role.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := UserFromContext(r.Context())
+			if user == nil {
+				problem.Write(w, r, apperror.ErrUnauthorized)
+				return
+			}
+
+			if user.Role != role {
+				problem.Write(w, r, apperror.ErrForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package middlewares
+
+import (
+	"context"
+	"github.com/andre2ar/go-products/internal/infra/webserver/accesstoken"
+	"github.com/go-chi/jwtauth/v5"
+	"net/http"
+)
+
+// Verifier parses and validates the bearer token of the request, from the
+// Authorization header or the jwt cookie, with tokens, and stores the result
+// in the context the way jwtauth.Verifier does, for Authenticator and
+// CurrentUser to act on. Tokens already verified by RateLimit are not parsed
+// again, and requests already authenticated by APIKey are passed through
+// untouched.
+func Verifier(tokens *accesstoken.Authority) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if UserFromContext(r.Context()) != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(verify(r, tokens)))
+		})
+	}
+}
+
+// verify returns the context of r holding its parsed token or the reason it
+// is missing or invalid, parsing it only when no middleware did before.
+func verify(r *http.Request, tokens *accesstoken.Authority) context.Context {
+	ctx := r.Context()
+	if ctx.Value(jwtauth.TokenCtxKey) != nil || ctx.Value(jwtauth.ErrorCtxKey) != nil {
+		return ctx
+	}
+
+	tokenString := jwtauth.TokenFromHeader(r)
+	if tokenString == "" {
+		tokenString = jwtauth.TokenFromCookie(r)
+	}
+
+	if tokenString == "" {
+		return jwtauth.NewContext(ctx, nil, jwtauth.ErrNoTokenFound)
+	}
+
+	token, err := tokens.Parse(tokenString)
+	if err != nil {
+		err = jwtauth.ErrorReason(err)
+	}
+	return jwtauth.NewContext(ctx, token, err)
+}
@@ -0,0 +1,220 @@
+package webserver
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/andre2ar/go-products/configs"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/database"
+	"github.com/andre2ar/go-products/pkg/oidc"
+	"github.com/andre2ar/go-products/pkg/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"testing"
+)
+
+// newOIDCProvider starts an identity provider the server can be configured
+// with by withOIDC.
+func newOIDCProvider(t *testing.T) *oidctest.Server {
+	provider := oidctest.NewServer("go-products", "client-secret")
+	t.Cleanup(provider.Close)
+	return provider
+}
+
+// withOIDC configures the server to log users in through provider.
+func withOIDC(provider *oidctest.Server) testOption {
+	return withConfig(func(config *configs.Conf) {
+		config.OIDCIssuer = provider.URL
+		config.OIDCClientID = "go-products"
+		config.OIDCClientSecret = "client-secret"
+		config.OIDCRedirectURL = "http://localhost/api/v1/oidc/callback"
+		config.OIDCScopes = "openid email profile"
+		config.OIDCStateTTL = 600
+	})
+}
+
+// loginWithOIDC goes through the whole browser flow: the redirect to the
+// provider, its redirect back and the callback, returning the callback
+// response.
+func loginWithOIDC(t *testing.T, server *testServer) *http.Response {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	browser := &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	res, err := browser.Get(server.URL + "/api/v1/oidc/login")
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusFound, res.StatusCode)
+
+	res, err = browser.Get(res.Header.Get("Location"))
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusFound, res.StatusCode)
+
+	// The provider redirects to the configured redirect URL, which points
+	// at a fixed host rather than the test server.
+	callback, err := url.Parse(res.Header.Get("Location"))
+	require.NoError(t, err)
+	res, err = browser.Get(server.URL + callback.Path + "?" + callback.RawQuery)
+	require.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+
+	return res
+}
+
+func decodeAccessToken(t *testing.T, res *http.Response) string {
+	t.Helper()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var auth dto.AuthResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&auth))
+	require.NotEmpty(t, auth.AccessToken)
+
+	return auth.AccessToken
+}
+
+func TestOIDCLoginProvisionsUsers(t *testing.T) {
+	provider := newOIDCProvider(t)
+	server := newTestServer(t, withOIDC(provider))
+	provider.SetIdentity(oidc.Claims{Subject: "user-1", Email: "J@J.com", EmailVerified: true, Name: "John Doe"})
+
+	user := getCurrentUser(t, server, decodeAccessToken(t, loginWithOIDC(t, server)))
+	assert.Equal(t, "John Doe", user.Name)
+	assert.Equal(t, "j@j.com", user.Email)
+	assert.True(t, user.IsEmailVerified())
+
+	// Later logins find the user through the linked identity, even with a
+	// different email at the provider.
+	provider.SetIdentity(oidc.Claims{Subject: "user-1", Email: "john@example.com", EmailVerified: true})
+	again := getCurrentUser(t, server, decodeAccessToken(t, loginWithOIDC(t, server)))
+	assert.Equal(t, user.ID, again.ID)
+
+	events, err := database.NewAuditEvent(server.DB).FindByType(context.Background(), entity.AuditOIDCIdentityLinked)
+	require.NoError(t, err)
+	require.Len(t, events, 1, "only linking the account is audited")
+	assert.Equal(t, "j@j.com", events[0].Email)
+	assert.Contains(t, events[0].Detail, "created an account for subject user-1")
+}
+
+func TestOIDCLoginLinksExistingUsersByVerifiedEmail(t *testing.T) {
+	provider := newOIDCProvider(t)
+	server := newTestServer(t, withOIDC(provider))
+	token := signUpAndLogin(t, server)
+	markEmailVerified(t, server, "j@j.com")
+	user := getCurrentUser(t, server, token)
+
+	provider.SetIdentity(oidc.Claims{Subject: "user-1", Email: "j@j.com", EmailVerified: false})
+	res := loginWithOIDC(t, server)
+	assert.Equal(t, "oidc_email_not_verified", decodeProblem(t, res).Code)
+
+	provider.SetIdentity(oidc.Claims{Subject: "user-1", Email: "j@j.com", EmailVerified: true})
+	linked := getCurrentUser(t, server, decodeAccessToken(t, loginWithOIDC(t, server)))
+	assert.Equal(t, user.ID, linked.ID)
+	assert.True(t, linked.IsEmailVerified())
+
+	login(t, server, "j@j.com", "secret123")
+	getCurrentUser(t, server, token)
+}
+
+func TestOIDCLoginClaimsUnverifiedUsers(t *testing.T) {
+	provider := newOIDCProvider(t)
+	server := newTestServer(t, withOIDC(provider))
+	// Someone registers the email of the owner of the provider account,
+	// without being able to verify it.
+	token := signUpAndLogin(t, server)
+	enableMFA(t, server, token)
+	created := createAPIKey(t, server, token, entity.ScopeProductsRead)
+
+	provider.SetIdentity(oidc.Claims{Subject: "user-1", Email: "j@j.com", EmailVerified: true})
+	claimed := getCurrentUser(t, server, decodeAccessToken(t, loginWithOIDC(t, server)))
+	assert.True(t, claimed.IsEmailVerified())
+	assert.False(t, claimed.IsMFAEnabled(), "the MFA of whoever registered the email is dropped")
+
+	res := loginFrom(t, server, "10.0.0.1", "j@j.com", "secret123")
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "the password of whoever registered the email is replaced")
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/users/me", token, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/products", created.Key, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	events, err := database.NewAuditEvent(server.DB).FindByType(context.Background(), entity.AuditOIDCIdentityLinked)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Contains(t, events[0].Detail, "claimed an unverified account for subject user-1")
+}
+
+func TestOIDCLoginHonorsMFA(t *testing.T) {
+	provider := newOIDCProvider(t)
+	server := newTestServer(t, withOIDC(provider))
+	enableMFA(t, server, signUpAndLogin(t, server))
+	markEmailVerified(t, server, "j@j.com")
+
+	provider.SetIdentity(oidc.Claims{Subject: "user-1", Email: "j@j.com", EmailVerified: true})
+	res := loginWithOIDC(t, server)
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+}
+
+func TestOIDCLoginAppliesLoginRejections(t *testing.T) {
+	provider := newOIDCProvider(t)
+	server := newTestServer(t, withOIDC(provider))
+	signUp(t, server, "John Doe", "j@j.com", "secret123")
+	markEmailVerified(t, server, "j@j.com")
+	require.NoError(t, server.DB.Model(&entity.User{}).Where("email = ?", "j@j.com").Update("password_reset_required", true).Error)
+
+	provider.SetIdentity(oidc.Claims{Subject: "user-1", Email: "j@j.com", EmailVerified: true})
+	res := loginWithOIDC(t, server)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	assert.Equal(t, "password_reset_required", decodeProblem(t, res).Code)
+}
+
+func TestOIDCLoginIsThrottledPerIP(t *testing.T) {
+	provider := newOIDCProvider(t)
+	server := newTestServer(t, withOIDC(provider), withConfig(func(config *configs.Conf) {
+		config.OIDCClientSecret = "wrong-secret"
+		config.LoginIPMaxAttempts = 2
+	}))
+	provider.SetIdentity(oidc.Claims{Subject: "user-1", Email: "j@j.com", EmailVerified: true})
+
+	for i := 0; i < 2; i++ {
+		res := loginWithOIDC(t, server)
+		require.Equal(t, "oidc_login_failed", decodeProblem(t, res).Code)
+	}
+
+	res := loginWithOIDC(t, server)
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.NotEmpty(t, res.Header.Get("Retry-After"))
+
+	events, err := database.NewAuditEvent(server.DB).FindByType(context.Background(), entity.AuditLoginIPLockout)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestOIDCCallbackRequiresMatchingState(t *testing.T) {
+	server := newTestServer(t, withOIDC(newOIDCProvider(t)))
+
+	res := doRequest(t, http.MethodGet, server.URL+"/api/v1/oidc/callback?code=code&state=state", "", nil)
+	assert.Equal(t, "oidc_login_failed", decodeProblem(t, res).Code)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/oidc/callback?code=code&state=forged", nil)
+	require.NoError(t, err)
+	req.AddCookie(&http.Cookie{Name: "oidc_state", Value: "forged"})
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "oidc_login_failed", decodeProblem(t, res).Code)
+}
+
+func TestOIDCRoutesAreDisabledWithoutIssuer(t *testing.T) {
+	server := newTestServer(t)
+
+	res := doRequest(t, http.MethodGet, server.URL+"/api/v1/oidc/login", "", nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
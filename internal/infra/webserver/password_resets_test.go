@@ -0,0 +1,99 @@
+package webserver
+
+import (
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func waitForResetToken(t *testing.T, mailer *mail.MemoryMailer, count int) string {
+	t.Helper()
+
+	return waitForLinkToken(t, mailer, "Reset your password", "http://localhost/reset-password", count)
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/password-resets", "", dto.PasswordResetRequestInput{Email: "J@J.com"})
+	require.Equal(t, http.StatusAccepted, res.StatusCode)
+	resetToken := waitForResetToken(t, server.Mailer, 1)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/password-resets/"+resetToken, "", dto.PasswordResetInput{Password: "short"})
+	assert.Equal(t, "validation_failed", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/password-resets/"+resetToken, "", dto.PasswordResetInput{Password: "new-secret123"})
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/users/me", token, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	login(t, server, "j@j.com", "new-secret123")
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/password-resets/"+resetToken, "", dto.PasswordResetInput{Password: "other-secret123"})
+	assert.Equal(t, "invalid_password_reset_token", decodeProblem(t, res).Code)
+}
+
+func TestPasswordResetInvalidatesOtherTokens(t *testing.T) {
+	server := newTestServer(t)
+	signUpAndLogin(t, server)
+
+	doRequest(t, http.MethodPost, server.URL+"/api/v1/password-resets", "", dto.PasswordResetRequestInput{Email: "j@j.com"})
+	first := waitForResetToken(t, server.Mailer, 1)
+	doRequest(t, http.MethodPost, server.URL+"/api/v1/password-resets", "", dto.PasswordResetRequestInput{Email: "j@j.com"})
+	second := waitForResetToken(t, server.Mailer, 2)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/password-resets/"+second, "", dto.PasswordResetInput{Password: "new-secret123"})
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/password-resets/"+first, "", dto.PasswordResetInput{Password: "other-secret123"})
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestPasswordResetDoesNotRevealUnknownEmails(t *testing.T) {
+	server := newTestServer(t)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/password-resets", "", dto.PasswordResetRequestInput{Email: "unknown@j.com"})
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, server.Mailer.Messages())
+}
+
+func TestPasswordResetIsRateLimitedPerEmail(t *testing.T) {
+	server := newTestServer(t)
+
+	for i := 0; i < 3; i++ {
+		res := doRequest(t, http.MethodPost, server.URL+"/api/v1/password-resets", "", dto.PasswordResetRequestInput{Email: "unknown@j.com"})
+		require.Equal(t, http.StatusAccepted, res.StatusCode)
+	}
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/password-resets", "", dto.PasswordResetRequestInput{Email: "UNKNOWN@j.com"})
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.NotEmpty(t, res.Header.Get("Retry-After"))
+	assert.Equal(t, "too_many_requests", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/password-resets", "", dto.PasswordResetRequestInput{Email: "other@j.com"})
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+}
+
+func TestPasswordResetClearsForcedReset(t *testing.T) {
+	server := newTestServer(t)
+	signUp(t, server, "John Doe", "j@j.com", "secret123")
+	require.NoError(t, server.DB.Model(&entity.User{}).Where("email = ?", "j@j.com").Update("password_reset_required", true).Error)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{Email: "j@j.com", Password: "secret123"})
+	require.Equal(t, "password_reset_required", decodeProblem(t, res).Code)
+
+	doRequest(t, http.MethodPost, server.URL+"/api/v1/password-resets", "", dto.PasswordResetRequestInput{Email: "j@j.com"})
+	resetToken := waitForResetToken(t, server.Mailer, 1)
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/password-resets/"+resetToken, "", dto.PasswordResetInput{Password: "new-secret123"})
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	login(t, server, "j@j.com", "new-secret123")
+}
@@ -0,0 +1,63 @@
+package problem
+
+import (
+	"encoding/json"
+	"github.com/andre2ar/go-products/internal/apperror"
+	"github.com/andre2ar/go-products/internal/infra/tracing"
+	"github.com/andre2ar/go-products/pkg/logging"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+)
+
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details document, extended with a stable
+// error code, the request and trace IDs and field-level validation errors.
+type Problem struct {
+	Type      string                `json:"type"`
+	Title     string                `json:"title"`
+	Status    int                   `json:"status"`
+	Detail    string                `json:"detail,omitempty"`
+	Instance  string                `json:"instance,omitempty"`
+	Code      string                `json:"code"`
+	RequestID string                `json:"request_id,omitempty"`
+	TraceID   string                `json:"trace_id,omitempty"`
+	Errors    []apperror.FieldError `json:"errors,omitempty"`
+}
+
+// Write renders err as a problem+json response. Errors that are not
+// application errors are logged and answered with a generic internal error
+// so driver or ORM messages never reach the client.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	appErr := apperror.From(err)
+	requestID := middleware.GetReqID(r.Context())
+
+	if appErr.Status >= http.StatusInternalServerError {
+		logging.FromContext(r.Context()).ErrorContext(r.Context(), "request failed", slog.Any("error", err))
+	}
+
+	p := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(appErr.Status),
+		Status:    appErr.Status,
+		Detail:    appErr.Message,
+		Instance:  r.URL.Path,
+		Code:      appErr.Code,
+		RequestID: requestID,
+		TraceID:   tracing.TraceID(r.Context()),
+		Errors:    appErr.Fields,
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(appErr.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, apperror.ErrNotFound)
+}
+
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, apperror.ErrMethodNotAllowed)
+}
@@ -0,0 +1,137 @@
+package webserver
+
+import (
+	"github.com/andre2ar/go-products/configs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+// getFrom sends a GET request for path as if it came from ip through a
+// proxy setting X-Real-IP, authenticated by token when set.
+func getFrom(t *testing.T, server *testServer, ip, token, path string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Real-IP", ip)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+
+	return res
+}
+
+// withRateLimits limits products to bursts of 2 requests and users to
+// bursts of 10.
+func withRateLimits() testOption {
+	return withConfig(func(config *configs.Conf) {
+		config.RateLimitProductsPerMinute = 1
+		config.RateLimitProductsBurst = 2
+		config.RateLimitUsersPerMinute = 60
+		config.RateLimitUsersBurst = 10
+	})
+}
+
+func TestRateLimitPerSubject(t *testing.T) {
+	server := newTestServer(t, withRateLimits())
+	token := signUpAndLogin(t, server)
+	signUp(t, server, "Jane Doe", "jane@j.com", "secret123")
+	otherToken := login(t, server, "jane@j.com", "secret123")
+
+	res := getFrom(t, server, "10.0.0.1", token, "/api/v1/products")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "2", res.Header.Get("RateLimit-Limit"))
+	assert.Equal(t, "1", res.Header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", res.Header.Get("RateLimit-Reset"))
+
+	res = getFrom(t, server, "10.0.0.2", token, "/api/v1/products")
+	require.Equal(t, http.StatusOK, res.StatusCode, "the bucket follows the subject across addresses")
+	assert.Equal(t, "0", res.Header.Get("RateLimit-Remaining"))
+
+	res = getFrom(t, server, "10.0.0.3", token, "/api/v1/products")
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(t, "60", res.Header.Get("Retry-After"))
+	assert.Equal(t, "0", res.Header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "too_many_requests", decodeProblem(t, res).Code)
+
+	res = getFrom(t, server, "10.0.0.1", otherToken, "/api/v1/products")
+	assert.Equal(t, http.StatusOK, res.StatusCode, "other subjects have their own bucket")
+	res = getFrom(t, server, "10.0.0.1", "", "/api/v1/products")
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "anonymous clients are limited per address")
+	assert.Equal(t, "1", res.Header.Get("RateLimit-Remaining"))
+
+	res = getFrom(t, server, "10.0.0.3", token, "/api/v1/users/me")
+	assert.Equal(t, http.StatusOK, res.StatusCode, "route groups are limited separately")
+	assert.Equal(t, "10", res.Header.Get("RateLimit-Limit"))
+}
+
+func TestRateLimitPerAddress(t *testing.T) {
+	server := newTestServer(t, withRateLimits())
+
+	for i := 0; i < 2; i++ {
+		res := getFrom(t, server, "10.0.0.1", "not-a-token", "/api/v1/products")
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+
+	res := getFrom(t, server, "10.0.0.1", "", "/api/v1/products")
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode, "invalid tokens count against the address")
+	assert.Equal(t, "60", res.Header.Get("Retry-After"))
+
+	res = getFrom(t, server, "10.0.0.2", "", "/api/v1/products")
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestRateLimitIgnoresForwardingHeadersOfUntrustedPeers(t *testing.T) {
+	server := newTestServer(t, withConfig(func(config *configs.Conf) {
+		config.WebServerTrustedProxies = "10.0.0.0/8"
+		config.RateLimitProductsPerMinute = 1
+		config.RateLimitProductsBurst = 2
+	}))
+
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		res := getFrom(t, server, ip, "", "/api/v1/products")
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+
+	res := getFrom(t, server, "10.0.0.3", "", "/api/v1/products")
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode, "the peer is limited by its own address")
+}
+
+func TestRateLimitPerForwardedAddress(t *testing.T) {
+	server := newTestServer(t, withRateLimits())
+
+	forwardedFor := func(chain string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/products", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Forwarded-For", chain)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+
+	for _, chain := range []string{"10.0.0.1", "10.0.0.2, 10.0.0.1"} {
+		res := forwardedFor(chain)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+
+	res := forwardedFor("10.0.0.3, 10.0.0.1, 127.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode, "addresses added by the client are not trusted")
+
+	res = forwardedFor("10.0.0.2")
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	server := newTestServer(t)
+
+	res := getFrom(t, server, "10.0.0.1", "", "/api/v1/products")
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Empty(t, res.Header.Get("RateLimit-Limit"))
+}
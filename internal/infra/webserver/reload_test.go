@@ -0,0 +1,110 @@
+package webserver
+
+import (
+	"encoding/json"
+	"github.com/andre2ar/go-products/configs"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tokenLifetime(t *testing.T, token string) time.Duration {
+	t.Helper()
+
+	parsed, err := jwt.ParseInsecure([]byte(token))
+	require.NoError(t, err)
+	return parsed.Expiration().Sub(parsed.IssuedAt())
+}
+
+func TestReloadAppliesTokenLifetimeAndRateLimits(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("jwt_secret: a-secret-of-at-least-thirty-two-bytes\njwt_expires_in: 300\nlogin_base_delay: 0\n"), 0o600))
+	options := configs.Options{File: file}
+	config, err := configs.Load(options)
+	require.NoError(t, err)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	reloader := configs.NewReloader(config, options, logger)
+
+	server := newTestServer(t, withDependencies(Dependencies{
+		Logger:   logger,
+		Reloader: reloader,
+	}))
+	token := signUpAndLogin(t, server)
+	assert.Equal(t, 300*time.Second, tokenLifetime(t, token))
+
+	require.NoError(t, os.WriteFile(file, []byte("jwt_secret: a-secret-of-at-least-thirty-two-bytes\njwt_expires_in: 60\nlogin_base_delay: 0\nlogin_free_attempts: 0\nlogin_max_attempts: 2\n"), 0o600))
+	require.NoError(t, reloader.Reload())
+
+	assert.Equal(t, 60*time.Second, tokenLifetime(t, login(t, server, "j@j.com", "secret123")))
+	for i := 0; i < 2; i++ {
+		res := loginFrom(t, server, "10.0.0.1", "j@j.com", "wrong-password")
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+	res := loginFrom(t, server, "10.0.0.1", "j@j.com", "secret123")
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+
+	require.NoError(t, os.WriteFile(file, []byte("jwt_secret: a-secret-of-at-least-thirty-two-bytes\njwt_expires_in: 0\n"), 0o600))
+	assert.Error(t, reloader.Reload())
+	signUp(t, server, "Jane Doe", "jane@j.com", "secret123")
+	assert.Equal(t, 60*time.Second, tokenLifetime(t, login(t, server, "jane@j.com", "secret123")), "an invalid configuration is not applied")
+}
+
+func TestReloadAppliesMFAChallengeTTL(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("jwt_secret: a-secret-of-at-least-thirty-two-bytes\nmfa_challenge_ttl: 300\n"), 0o600))
+	options := configs.Options{File: file}
+	config, err := configs.Load(options)
+	require.NoError(t, err)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	reloader := configs.NewReloader(config, options, logger)
+
+	server := newTestServer(t, withDependencies(Dependencies{
+		Logger:   logger,
+		Reloader: reloader,
+	}))
+	enableMFA(t, server, signUpAndLogin(t, server))
+
+	require.NoError(t, os.WriteFile(file, []byte("jwt_secret: a-secret-of-at-least-thirty-two-bytes\nmfa_challenge_ttl: 120\n"), 0o600))
+	require.NoError(t, reloader.Reload())
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{Email: "j@j.com", Password: "secret123"})
+	require.Equal(t, http.StatusAccepted, res.StatusCode)
+	var challenge dto.MFAChallengeResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&challenge))
+	assert.Equal(t, 120, challenge.ExpiresIn)
+}
+
+func TestReloadAppliesCORSOrigins(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("jwt_secret: a-secret-of-at-least-thirty-two-bytes\nwebserver_cors_origins: https://app.example.com\n"), 0o600))
+	options := configs.Options{File: file}
+	config, err := configs.Load(options)
+	require.NoError(t, err)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	reloader := configs.NewReloader(config, options, logger)
+
+	server := newTestServer(t, withConfig(func(config *configs.Conf) {
+		config.WebServerCORSOrigins = "https://app.example.com"
+	}), withDependencies(Dependencies{
+		Logger:   logger,
+		Reloader: reloader,
+	}))
+	res := corsRequest(t, server, "https://app.example.com", "/api/v1/products", true)
+	assert.Equal(t, "https://app.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+
+	require.NoError(t, os.WriteFile(file, []byte("jwt_secret: a-secret-of-at-least-thirty-two-bytes\nwebserver_cors_origins: https://new.example.com\n"), 0o600))
+	require.NoError(t, reloader.Reload())
+
+	res = corsRequest(t, server, "https://app.example.com", "/api/v1/products", true)
+	assert.Empty(t, res.Header.Get("Access-Control-Allow-Origin"))
+	res = corsRequest(t, server, "https://new.example.com", "/api/v1/products", true)
+	assert.Equal(t, "https://new.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+}
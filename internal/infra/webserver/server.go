@@ -0,0 +1,312 @@
+package webserver
+
+import (
+	"github.com/andre2ar/go-products/configs"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/database"
+	"github.com/andre2ar/go-products/internal/infra/health"
+	"github.com/andre2ar/go-products/internal/infra/mail"
+	"github.com/andre2ar/go-products/internal/infra/metrics"
+	"github.com/andre2ar/go-products/internal/infra/webserver/accesstoken"
+	"github.com/andre2ar/go-products/internal/infra/webserver/handlers"
+	"github.com/andre2ar/go-products/internal/infra/webserver/middlewares"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	"github.com/andre2ar/go-products/pkg/oidc"
+	"github.com/andre2ar/go-products/pkg/ratelimit"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/swaggo/http-swagger/v2"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"gorm.io/gorm"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// defaultHealthTimeout bounds the readiness checks when Dependencies do not
+// provide them.
+const defaultHealthTimeout = 5 * time.Second
+
+// Dependencies are the external services the API is built on. Mailer is
+// called while serving requests, so it should hand messages over to a
+// background worker as mail.Queue does. Logger defaults to slog.Default(),
+// Metrics to a fresh registry, Tracer to a provider recording nothing and
+// Health to checks with a 5 seconds timeout. The database checks are added
+// to Health, while background workers add their own. RateLimitStore keeps
+// the rate limits of the route groups and defaults to one in memory; a
+// shared store applies them across servers. When Reloader is set, the
+// token lifetimes, rate limits and CORS origins follow its reloads.
+type Dependencies struct {
+	DB             *gorm.DB
+	Mailer         mail.Mailer
+	Logger         *slog.Logger
+	Metrics        *metrics.Metrics
+	Tracer         trace.TracerProvider
+	Health         *health.Health
+	RateLimitStore ratelimit.Store
+	Reloader       *configs.Reloader
+}
+
+// NewRouter wires repositories, handlers and middlewares on top of deps and
+// returns the handler serving the whole API.
+func NewRouter(config *configs.Conf, deps Dependencies) http.Handler {
+	if deps.Logger == nil {
+		deps.Logger = slog.Default()
+	}
+	if deps.Metrics == nil {
+		deps.Metrics = metrics.New()
+	}
+	if deps.Tracer == nil {
+		deps.Tracer = noop.NewTracerProvider()
+	}
+	if deps.Health == nil {
+		deps.Health = health.New(defaultHealthTimeout)
+	}
+	if deps.RateLimitStore == nil {
+		deps.RateLimitStore = ratelimit.NewMemoryStore()
+	}
+	deps.Health.Add("database", database.PingCheck(deps.DB))
+	deps.Health.Add("migrations", database.MigrationsCheck(deps.DB))
+
+	transactionManager := database.NewTransactionManager(deps.DB)
+	tokens := accesstoken.NewAuthority(
+		config.TokenKeys,
+		config.JWTIssuer,
+		config.JWTAudience,
+		time.Duration(config.JWTExpiresIn)*time.Second,
+		time.Duration(config.JWTClockSkew)*time.Second,
+	)
+
+	productRepository := database.NewProduct(deps.DB)
+	productHandler := handlers.NewProductHandler(productRepository)
+	err := deps.Metrics.RegisterCount("products", "Number of products stored.", productRepository.Count)
+	if err != nil {
+		deps.Logger.Error("could not register the products gauge", slog.Any("error", err))
+	}
+
+	userRepository := database.NewUser(deps.DB)
+	emailVerificationLimiter := ratelimit.NewWindowLimiter(config.EmailVerificationRateLimit, time.Hour)
+	emailVerificationHandler := handlers.NewEmailVerificationHandler(
+		userRepository,
+		deps.Mailer,
+		emailVerificationLimiter,
+		config.JWTSecret,
+		time.Duration(config.EmailVerificationTTL)*time.Second,
+		config.EmailVerificationURL,
+	)
+	mfaLimiter := ratelimit.NewWindowLimiter(config.MFARateLimit, time.Duration(config.MFAChallengeTTL)*time.Second)
+	mfaHandler := handlers.NewMFAHandler(
+		userRepository,
+		transactionManager,
+		mfaLimiter,
+		config.JWTSecret,
+		time.Duration(config.MFAChallengeTTL)*time.Second,
+		config.MFAIssuer,
+		deps.Metrics,
+	)
+	loginLockout := time.Duration(config.LoginLockout) * time.Second
+	accountBackoff := ratelimit.NewBackoff(config.LoginFreeAttempts, time.Duration(config.LoginBaseDelay)*time.Second, config.LoginMaxAttempts, loginLockout)
+	ipBackoff := ratelimit.NewBackoff(config.LoginIPMaxAttempts, 0, config.LoginIPMaxAttempts, loginLockout)
+	loginGuard := handlers.NewLoginGuard(accountBackoff, ipBackoff, database.NewAuditEvent(deps.DB))
+	userHandler := handlers.NewUserHandler(userRepository, transactionManager, emailVerificationHandler, mfaHandler, loginGuard, config.RequireEmailVerification, deps.Metrics)
+	adminUserHandler := handlers.NewAdminUserHandler(userRepository)
+	apiKeyRepository := database.NewAPIKey(deps.DB)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyRepository)
+	// Failed client credentials are throttled like failed logins, with
+	// counts of their own.
+	introspectionClientBackoff := ratelimit.NewBackoff(config.LoginFreeAttempts, time.Duration(config.LoginBaseDelay)*time.Second, config.LoginMaxAttempts, loginLockout)
+	introspectionIPBackoff := ratelimit.NewBackoff(config.LoginIPMaxAttempts, 0, config.LoginIPMaxAttempts, loginLockout)
+	introspectionHandler := handlers.NewIntrospectionHandler(
+		tokens,
+		userRepository,
+		parseClients(config.IntrospectionClients),
+		introspectionClientBackoff,
+		introspectionIPBackoff,
+	)
+
+	var oidcHandler *handlers.OIDCHandler
+	if config.OIDCIssuer != "" {
+		provider := oidc.NewProvider(oidc.Config{
+			Issuer:       config.OIDCIssuer,
+			ClientID:     config.OIDCClientID,
+			ClientSecret: config.OIDCClientSecret,
+			RedirectURL:  config.OIDCRedirectURL,
+			Scopes:       strings.Fields(config.OIDCScopes),
+		}, &http.Client{Timeout: 10 * time.Second})
+		oidcHandler = handlers.NewOIDCHandler(provider, transactionManager, mfaHandler, loginGuard, config.RequireEmailVerification,
+			config.JWTSecret, time.Duration(config.OIDCStateTTL)*time.Second, config.OIDCCookieSecure, deps.Metrics)
+	}
+
+	passwordResetLimiter := ratelimit.NewWindowLimiter(config.PasswordResetRateLimit, time.Hour)
+	passwordResetHandler := handlers.NewPasswordResetHandler(
+		userRepository,
+		database.NewPasswordReset(deps.DB),
+		transactionManager,
+		deps.Mailer,
+		passwordResetLimiter,
+		time.Duration(config.PasswordResetTTL)*time.Second,
+		config.PasswordResetURL,
+	)
+
+	productsLimiter := ratelimit.NewTokenBucket(deps.RateLimitStore, ratelimit.PerMinute(config.RateLimitProductsPerMinute, config.RateLimitProductsBurst))
+	usersLimiter := ratelimit.NewTokenBucket(deps.RateLimitStore, ratelimit.PerMinute(config.RateLimitUsersPerMinute, config.RateLimitUsersBurst))
+	corsOrigins := middlewares.NewCORSOrigins(parseList(config.WebServerCORSOrigins))
+
+	if deps.Reloader != nil {
+		deps.Reloader.Subscribe(func(config *configs.Conf) {
+			tokens.SetLifetime(time.Duration(config.JWTExpiresIn)*time.Second, time.Duration(config.JWTClockSkew)*time.Second)
+			emailVerificationLimiter.Configure(config.EmailVerificationRateLimit, time.Hour)
+			mfaLimiter.Configure(config.MFARateLimit, time.Duration(config.MFAChallengeTTL)*time.Second)
+			mfaHandler.SetChallengeTTL(time.Duration(config.MFAChallengeTTL) * time.Second)
+			passwordResetLimiter.Configure(config.PasswordResetRateLimit, time.Hour)
+			loginLockout := time.Duration(config.LoginLockout) * time.Second
+			accountBackoff.Configure(config.LoginFreeAttempts, time.Duration(config.LoginBaseDelay)*time.Second, config.LoginMaxAttempts, loginLockout)
+			ipBackoff.Configure(config.LoginIPMaxAttempts, 0, config.LoginIPMaxAttempts, loginLockout)
+			introspectionClientBackoff.Configure(config.LoginFreeAttempts, time.Duration(config.LoginBaseDelay)*time.Second, config.LoginMaxAttempts, loginLockout)
+			introspectionIPBackoff.Configure(config.LoginIPMaxAttempts, 0, config.LoginIPMaxAttempts, loginLockout)
+			productsLimiter.Configure(ratelimit.PerMinute(config.RateLimitProductsPerMinute, config.RateLimitProductsBurst))
+			usersLimiter.Configure(ratelimit.PerMinute(config.RateLimitUsersPerMinute, config.RateLimitUsersBurst))
+			corsOrigins.Configure(parseList(config.WebServerCORSOrigins))
+		})
+	}
+
+	router := chi.NewRouter()
+
+	router.Use(middleware.RequestID)
+	router.Use(middlewares.RealIP(parseProxies(config.WebServerTrustedProxies), config.WebServerSocket != ""))
+	router.Use(middlewares.RequestLogger(deps.Logger))
+	router.Use(middlewares.Tracing(deps.Tracer))
+	router.Use(middlewares.Metrics(deps.Metrics))
+	router.Use(middlewares.Recoverer)
+	router.Use(middlewares.CORS(corsOrigins))
+	router.Use(middlewares.MaxBodySize(int64(config.WebServerMaxBodyBytes)))
+
+	router.Use(middleware.WithValue("Jwt", tokens))
+
+	router.NotFound(problem.NotFound)
+	router.MethodNotAllowed(problem.MethodNotAllowed)
+
+	healthHandler := handlers.NewHealthHandler(deps.Health)
+	router.Get("/healthz", healthHandler.Live)
+	router.Get("/readyz", healthHandler.Ready)
+	router.Get("/.well-known/jwks.json", handlers.NewJWKSHandler(config.TokenKeys).GetJWKS)
+
+	router.Route("/api/v1", func(router chi.Router) {
+		router.Get("/docs/*", httpSwagger.Handler(httpSwagger.URL(config.DocsUrl+"/api/v1/docs/doc.json")))
+
+		router.Post("/sessions", userHandler.CreateSession)
+		router.Post("/sessions/mfa", mfaHandler.CreateMFASession)
+
+		if oidcHandler != nil {
+			router.Get("/oidc/login", oidcHandler.StartOIDCLogin)
+			router.Get("/oidc/callback", oidcHandler.OIDCCallback)
+		}
+
+		router.Post("/tokens/introspect", introspectionHandler.IntrospectToken)
+
+		router.Post("/password-resets", passwordResetHandler.CreatePasswordReset)
+		router.Post("/password-resets/{token}", passwordResetHandler.ResetPassword)
+
+		router.Post("/email-verifications", emailVerificationHandler.ResendEmailVerification)
+		router.Post("/email-verifications/{token}", emailVerificationHandler.VerifyEmail)
+
+		router.Route("/users", func(router chi.Router) {
+			router.Use(middlewares.RateLimit("users", usersLimiter, tokens))
+
+			router.Post("/", userHandler.CreateUser)
+
+			router.Route("/me", func(router chi.Router) {
+				router.Use(middlewares.Verifier(tokens))
+				router.Use(middlewares.Authenticator)
+				router.Use(middlewares.CurrentUser(userRepository))
+
+				router.Get("/", userHandler.GetCurrentUser)
+				router.Patch("/", userHandler.UpdateCurrentUser)
+				router.Delete("/", userHandler.DeleteCurrentUser)
+				router.Post("/password", userHandler.ChangePassword)
+
+				router.Post("/mfa", mfaHandler.EnrollMFA)
+				router.Post("/mfa/confirm", mfaHandler.ConfirmMFA)
+				router.Delete("/mfa", mfaHandler.DisableMFA)
+
+				router.Get("/api-keys", apiKeyHandler.ListAPIKeys)
+				router.Post("/api-keys", apiKeyHandler.CreateAPIKey)
+				router.Delete("/api-keys/{id}", apiKeyHandler.RevokeAPIKey)
+			})
+		})
+
+		router.Route("/admin/users", func(router chi.Router) {
+			router.Use(middlewares.Verifier(tokens))
+			router.Use(middlewares.Authenticator)
+			router.Use(middlewares.CurrentUser(userRepository))
+			router.Use(middlewares.RequireRole(entity.RoleAdmin))
+
+			router.Get("/", adminUserHandler.ListUsers)
+			router.Get("/{id}", adminUserHandler.GetUser)
+			router.Post("/{id}/suspend", adminUserHandler.SuspendUser)
+			router.Post("/{id}/reactivate", adminUserHandler.ReactivateUser)
+			router.Post("/{id}/password-reset", adminUserHandler.RequirePasswordReset)
+		})
+
+		router.Route("/products", func(router chi.Router) {
+			router.Use(middlewares.RateLimit("products", productsLimiter, tokens))
+			router.Use(middlewares.APIKey(apiKeyRepository, userRepository))
+			router.Use(middlewares.Verifier(tokens))
+			router.Use(middlewares.Authenticator)
+			router.Use(middlewares.CurrentUser(userRepository))
+
+			read := router.With(middlewares.RequireScope(entity.ScopeProductsRead))
+			read.Get("/", productHandler.GetProducts)
+			read.Get("/{id}", productHandler.GetProduct)
+
+			write := router.With(middlewares.RequireScope(entity.ScopeProductsWrite))
+			write.Post("/", productHandler.CreateProduct)
+			write.Put("/{id}", productHandler.UpdateProduct)
+			write.Delete("/{id}", productHandler.DeleteProduct)
+		})
+	})
+
+	return router
+}
+
+// parseProxies reads trusted proxies from spec, a comma separated list of
+// IP addresses and CIDR ranges.
+func parseProxies(spec string) []netip.Prefix {
+	var proxies []netip.Prefix
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			proxies = append(proxies, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return proxies
+}
+
+// parseList reads the entries of spec, a comma separated list.
+func parseList(spec string) []string {
+	var entries []string
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// parseClients reads client credentials from spec, a comma separated list
+// of id:secret pairs.
+func parseClients(spec string) map[string]string {
+	clients := map[string]string{}
+	for _, entry := range strings.Split(spec, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if ok && id != "" && secret != "" {
+			clients[id] = secret
+		}
+	}
+	return clients
+}
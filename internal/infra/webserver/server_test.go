@@ -0,0 +1,423 @@
+package webserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/andre2ar/go-products/configs"
+	"github.com/andre2ar/go-products/internal/apperror"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/internal/infra/database"
+	"github.com/andre2ar/go-products/internal/infra/mail"
+	"github.com/andre2ar/go-products/internal/infra/metrics"
+	"github.com/andre2ar/go-products/internal/infra/webserver/problem"
+	entityPkg "github.com/andre2ar/go-products/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// testServer is an API server started for a test, along with the database
+// and mailer it was given.
+type testServer struct {
+	*httptest.Server
+	DB     *gorm.DB
+	Mailer *mail.MemoryMailer
+}
+
+// testOption adjusts the configuration and dependencies of a test server
+// before it starts.
+type testOption func(config *configs.Conf, deps *Dependencies)
+
+// withConfig adjusts the test configuration with configure.
+func withConfig(configure func(config *configs.Conf)) testOption {
+	return func(config *configs.Conf, _ *Dependencies) {
+		configure(config)
+	}
+}
+
+// withDependencies starts the server with deps, such as the logger, tracer
+// or metrics to write to. The database and mailer are provided by the test
+// server, as are a silent logger and metrics when unset.
+func withDependencies(deps Dependencies) testOption {
+	return func(_ *configs.Conf, current *Dependencies) {
+		*current = deps
+	}
+}
+
+// newTestServer starts a server with the test configuration and an
+// in-memory database and mailer, adjusted by options in order.
+func newTestServer(t *testing.T, options ...testOption) *testServer {
+	t.Helper()
+
+	config := &configs.Conf{
+		JWTSecret:    "a-secret-of-at-least-thirty-two-bytes",
+		JWTExpiresIn: 300,
+		JWTIssuer:    "http://localhost",
+		JWTAudience:  "go-products",
+		JWTClockSkew: 30,
+
+		WebServerTrustedProxies: "127.0.0.1",
+
+		IntrospectionClients:   "inventory:inventory-secret",
+		PasswordResetURL:       "http://localhost/reset-password",
+		PasswordResetTTL:       3600,
+		PasswordResetRateLimit: 3,
+
+		EmailVerificationURL:       "http://localhost/verify-email",
+		EmailVerificationTTL:       3600,
+		EmailVerificationRateLimit: 3,
+
+		MFAIssuer:       "Go Products",
+		MFAChallengeTTL: 300,
+		MFARateLimit:    5,
+
+		LoginFreeAttempts:  3,
+		LoginBaseDelay:     1,
+		LoginMaxAttempts:   5,
+		LoginIPMaxAttempts: 20,
+		LoginLockout:       900,
+	}
+	var deps Dependencies
+	for _, option := range options {
+		option(config, &deps)
+	}
+	if deps.Logger == nil {
+		deps.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	if deps.Metrics == nil {
+		deps.Metrics = metrics.New()
+	}
+
+	var err error
+	if config.TokenKeys == nil {
+		config.TokenKeys, err = configs.LoadTokenKeys("", config.JWTSecret, time.Hour)
+		require.NoError(t, err)
+	}
+
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	m := deps.Metrics
+	require.NoError(t, db.Use(database.NewQueryMetrics(m.DBQueryDuration, m.DBQueryErrors)))
+	require.NoError(t, db.Use(database.NewQueryTracing()))
+	require.NoError(t, database.Migrate(db))
+
+	mailer := mail.NewMemoryMailer()
+	deps.DB, deps.Mailer = db, mailer
+	server := httptest.NewServer(NewRouter(config, deps))
+	t.Cleanup(server.Close)
+
+	return &testServer{Server: server, DB: db, Mailer: mailer}
+}
+
+// waitForLinkToken waits until mailer has sent count messages with subject
+// and returns the token query parameter of the link starting with linkURL in
+// the last one.
+func waitForLinkToken(t *testing.T, mailer *mail.MemoryMailer, subject, linkURL string, count int) string {
+	t.Helper()
+
+	var messages []mail.Message
+	require.Eventually(t, func() bool {
+		messages = messages[:0]
+		for _, message := range mailer.Messages() {
+			if message.Subject == subject {
+				messages = append(messages, message)
+			}
+		}
+		return len(messages) == count
+	}, time.Second, 10*time.Millisecond)
+
+	match := regexp.MustCompile(regexp.QuoteMeta(linkURL) + `\?token=(\S+)`).FindStringSubmatch(messages[count-1].Body)
+	require.Len(t, match, 2)
+	token, err := url.QueryUnescape(match[1])
+	require.NoError(t, err)
+
+	return token
+}
+
+func doRequest(t *testing.T, method, url, token string, body interface{}) *http.Response {
+	t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&payload).Encode(body))
+	}
+
+	req, err := http.NewRequest(method, url, &payload)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+
+	return res
+}
+
+func signUp(t *testing.T, server *testServer, name, email, password string) {
+	t.Helper()
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/users", "", dto.CreateUserInput{
+		Name:     name,
+		Email:    email,
+		Password: password,
+	})
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+}
+
+// markEmailVerified verifies the email of a signed up user as if the link
+// sent to it had been followed.
+func markEmailVerified(t *testing.T, server *testServer, email string) {
+	t.Helper()
+
+	require.NoError(t, server.DB.Model(&entity.User{}).Where("email = ?", email).Update("email_verified_at", time.Now()).Error)
+}
+
+func login(t *testing.T, server *testServer, email, password string) string {
+	t.Helper()
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{
+		Email:    email,
+		Password: password,
+	})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var auth dto.AuthResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&auth))
+	require.NotEmpty(t, auth.AccessToken)
+
+	return auth.AccessToken
+}
+
+func signUpAndLogin(t *testing.T, server *testServer) string {
+	t.Helper()
+
+	signUp(t, server, "John Doe", "j@j.com", "secret123")
+	return login(t, server, "j@j.com", "secret123")
+}
+
+func TestSignUpAndCreateSession(t *testing.T) {
+	server := newTestServer(t)
+
+	token := signUpAndLogin(t, server)
+
+	assert.NotEmpty(t, token)
+}
+
+func TestCreateSessionWithWrongPassword(t *testing.T) {
+	server := newTestServer(t)
+	signUpAndLogin(t, server)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{
+		Email:    "j@j.com",
+		Password: "wrong-password",
+	})
+
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestCreateSessionWithUnknownEmailLooksLikeWrongPassword(t *testing.T) {
+	server := newTestServer(t)
+	signUpAndLogin(t, server)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{
+		Email:    "unknown@j.com",
+		Password: "secret123",
+	})
+	unknownEmail := decodeProblem(t, res)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{
+		Email:    "j@j.com",
+		Password: "wrong-password",
+	})
+	wrongPassword := decodeProblem(t, res)
+
+	assert.Equal(t, http.StatusUnauthorized, unknownEmail.Status)
+	assert.Equal(t, wrongPassword.Code, unknownEmail.Code)
+	assert.Equal(t, wrongPassword.Detail, unknownEmail.Detail)
+}
+
+func TestSignUpWithDuplicateEmail(t *testing.T) {
+	server := newTestServer(t)
+	signUpAndLogin(t, server)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/users", "", dto.CreateUserInput{
+		Name:     "Other John",
+		Email:    "J@J.COM",
+		Password: "secret123",
+	})
+
+	assert.Equal(t, http.StatusConflict, res.StatusCode)
+	assert.Equal(t, "email_already_in_use", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{
+		Email:    "J@j.com",
+		Password: "secret123",
+	})
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestProductsRequireToken(t *testing.T) {
+	server := newTestServer(t)
+
+	res := doRequest(t, http.MethodGet, server.URL+"/api/v1/products", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/products", "invalid-token", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestProductCRUD(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+	productsURL := server.URL + "/api/v1/products"
+
+	res := doRequest(t, http.MethodPost, productsURL, token, dto.CreateProductInput{Name: "Product 1", Price: 10})
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	res = doRequest(t, http.MethodPost, productsURL, token, dto.CreateProductInput{Name: "", Price: 10})
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = doRequest(t, http.MethodGet, productsURL, token, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var products []entity.Product
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&products))
+	require.Len(t, products, 1)
+	assert.Equal(t, "Product 1", products[0].Name)
+	assert.Equal(t, 10.0, products[0].Price)
+
+	productURL := productsURL + "/" + products[0].ID.String()
+
+	res = doRequest(t, http.MethodGet, productURL, token, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var product entity.Product
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&product))
+	assert.Equal(t, products[0].ID, product.ID)
+
+	res = doRequest(t, http.MethodPut, productURL, token, dto.CreateProductInput{Name: "Product 2", Price: 20})
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = doRequest(t, http.MethodGet, productURL, token, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&product))
+	assert.Equal(t, "Product 2", product.Name)
+	assert.Equal(t, 20.0, product.Price)
+
+	res = doRequest(t, http.MethodDelete, productURL, token, nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	res = doRequest(t, http.MethodGet, productURL, token, nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res = doRequest(t, http.MethodDelete, productURL, token, nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func decodeProblem(t *testing.T, res *http.Response) problem.Problem {
+	t.Helper()
+
+	assert.Equal(t, problem.ContentType, res.Header.Get("Content-Type"))
+	var p problem.Problem
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&p))
+	assert.Equal(t, res.StatusCode, p.Status)
+	assert.NotEmpty(t, p.RequestID)
+
+	return p
+}
+
+func TestErrorsAreProblemDocuments(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+
+	res := doRequest(t, http.MethodGet, server.URL+"/api/v1/products", "", nil)
+	assert.Equal(t, "unauthorized", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/products", token, dto.CreateProductInput{Name: "", Price: 10})
+	p := decodeProblem(t, res)
+	assert.Equal(t, "validation_failed", p.Code)
+	require.Len(t, p.Errors, 1)
+	assert.Equal(t, "name", p.Errors[0].Field)
+	assert.Equal(t, "required", p.Errors[0].Code)
+
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/products/"+entityPkg.NewID().String(), token, nil)
+	assert.Equal(t, "product_not_found", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodDelete, server.URL+"/api/v1/products/"+entityPkg.NewID().String(), token, nil)
+	assert.Equal(t, "product_not_found", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{Email: "j@j.com", Password: "wrong"})
+	assert.Equal(t, "invalid_credentials", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/unknown", "", nil)
+	assert.Equal(t, "not_found", decodeProblem(t, res).Code)
+}
+
+func TestMalformedBodyDoesNotLeakDecoderErrors(t *testing.T) {
+	server := newTestServer(t)
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/users", bytes.NewBufferString("{not json"))
+	require.NoError(t, err)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	p := decodeProblem(t, res)
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, "invalid_body", p.Code)
+	assert.Equal(t, "request body is malformed", p.Detail)
+}
+
+func TestSignUpReportsEveryViolation(t *testing.T) {
+	server := newTestServer(t)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/users", "", map[string]interface{}{
+		"name":     "",
+		"email":    "not-an-email",
+		"password": "short",
+		"admin":    true,
+	})
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	p := decodeProblem(t, res)
+	assert.Equal(t, "validation_failed", p.Code)
+	assert.ElementsMatch(t, []apperror.FieldError{
+		{Field: "admin", Code: "unknown", Message: "admin is not a known field"},
+		{Field: "name", Code: "required", Message: "name is required"},
+		{Field: "email", Code: "email", Message: "email must be a valid email address"},
+		{Field: "password", Code: "password", Message: "password must have at least 8 characters, at most 72 bytes, and contain letters and digits"},
+	}, p.Errors)
+}
+
+func TestCreateProductRejectsWrongTypes(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/products", token, map[string]interface{}{
+		"name":  10,
+		"price": "ten",
+	})
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	p := decodeProblem(t, res)
+	assert.ElementsMatch(t, []apperror.FieldError{
+		{Field: "name", Code: "type", Message: "name must be a string"},
+		{Field: "price", Code: "type", Message: "price must be a float64"},
+	}, p.Errors, "every type mismatch is reported")
+}
@@ -0,0 +1,166 @@
+package webserver
+
+import (
+	"encoding/json"
+	"github.com/andre2ar/go-products/configs"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/internal/infra/webserver/accesstoken"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func introspect(t *testing.T, server *testServer, clientID, clientSecret, token string) *http.Response {
+	t.Helper()
+
+	form := url.Values{"token": {token}}
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/tokens/introspect", strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.SetBasicAuth(clientID, clientSecret)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+
+	return res
+}
+
+func decodeIntrospection(t *testing.T, res *http.Response) dto.IntrospectionResponse {
+	t.Helper()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var introspection dto.IntrospectionResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&introspection))
+
+	return introspection
+}
+
+func TestIntrospectActiveToken(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+
+	res := introspect(t, server, "inventory", "inventory-secret", token)
+	assert.Equal(t, "no-store", res.Header.Get("Cache-Control"))
+	introspection := decodeIntrospection(t, res)
+	assert.True(t, introspection.Active)
+	assert.Equal(t, "Bearer", introspection.TokenType)
+	assert.Equal(t, "j@j.com", introspection.Username)
+	assert.Equal(t, "http://localhost", introspection.Issuer)
+	assert.Equal(t, []string{"go-products"}, introspection.Audience)
+	assert.NotEmpty(t, introspection.Subject)
+	assert.NotEmpty(t, introspection.TokenID)
+	assert.Equal(t, int64(300), introspection.ExpiresAt-introspection.IssuedAt)
+	assert.Equal(t, introspection.IssuedAt, introspection.NotBefore)
+}
+
+func TestIntrospectRevokedToken(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/users/me/password", token, dto.ChangePasswordInput{
+		CurrentPassword: "secret123",
+		NewPassword:     "new-secret123",
+	})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = introspect(t, server, "inventory", "inventory-secret", token)
+	assert.Equal(t, dto.IntrospectionResponse{Active: false}, decodeIntrospection(t, res))
+}
+
+func TestTokensForOtherIssuersOrAudiencesAreRejected(t *testing.T) {
+	keys, err := configs.LoadTokenKeys("", "secret", time.Hour)
+	require.NoError(t, err)
+	server := newTestServer(t, withConfig(func(config *configs.Conf) {
+		config.TokenKeys = keys
+	}))
+	signUpAndLogin(t, server)
+
+	for name, authority := range map[string]*accesstoken.Authority{
+		"issuer":   accesstoken.NewAuthority(keys, "http://elsewhere", "go-products", time.Minute, 0),
+		"audience": accesstoken.NewAuthority(keys, "http://localhost", "other-api", time.Minute, 0),
+	} {
+		t.Run(name, func(t *testing.T) {
+			token, _, err := authority.Issue("someone", nil)
+			require.NoError(t, err)
+
+			res := doRequest(t, http.MethodGet, server.URL+"/api/v1/products", token, nil)
+			assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+			res = introspect(t, server, "inventory", "inventory-secret", token)
+			assert.False(t, decodeIntrospection(t, res).Active)
+		})
+	}
+}
+
+func TestIntrospectionRequiresClientCredentials(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+
+	res := introspect(t, server, "", "", token)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(t, `Basic realm="introspection"`, res.Header.Get("WWW-Authenticate"))
+
+	res = introspect(t, server, "inventory", "wrong-secret", token)
+	assert.Equal(t, "unauthorized", decodeProblem(t, res).Code)
+
+	res = introspect(t, server, "inventory", "inventory-secret", "")
+	assert.Equal(t, "validation_failed", decodeProblem(t, res).Code)
+}
+
+func TestIntrospectionBodiesAreLimited(t *testing.T) {
+	server := newTestServer(t, withConfig(func(config *configs.Conf) {
+		config.WebServerMaxBodyBytes = 64
+	}))
+
+	// Without a Content-Length, the body is only found too large once read.
+	body := url.Values{"token": {strings.Repeat("a", 100)}}.Encode()
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/tokens/introspect", io.MultiReader(strings.NewReader(body)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("inventory", "inventory-secret")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	assert.Equal(t, "body_too_large", decodeProblem(t, res).Code)
+}
+
+func TestIntrospectionClientCredentialsAreThrottled(t *testing.T) {
+	server := newTestServer(t, withConfig(func(config *configs.Conf) {
+		config.LoginBaseDelay = 0
+	}))
+	token := signUpAndLogin(t, server)
+
+	for i := 0; i < 5; i++ {
+		res := introspect(t, server, "inventory", "wrong-secret", token)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+
+	res := introspect(t, server, "inventory", "inventory-secret", token)
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode, "the client is locked out")
+	assert.Equal(t, "900", res.Header.Get("Retry-After"))
+}
+
+func TestIntrospectionIPsAreThrottled(t *testing.T) {
+	server := newTestServer(t, withConfig(func(config *configs.Conf) {
+		config.LoginIPMaxAttempts = 3
+	}))
+	token := signUpAndLogin(t, server)
+
+	for _, clientID := range []string{"a", "b", "c"} {
+		res := introspect(t, server, clientID, "guess", token)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+
+	res := introspect(t, server, "inventory", "inventory-secret", token)
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode, "the IP is locked out")
+}
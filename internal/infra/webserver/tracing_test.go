@@ -0,0 +1,148 @@
+package webserver
+
+import (
+	"encoding/json"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/andre2ar/go-products/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testTraceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testParentSpanID = "00f067aa0ba902b7"
+)
+
+func newTracedTestServer(t *testing.T, logs *syncBuffer) (*testServer, *tracetest.SpanRecorder) {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	logger, err := logging.New(logs, "info", "json")
+	require.NoError(t, err)
+	server := newTestServer(t, withDependencies(Dependencies{
+		Logger: logger,
+		Tracer: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+	}))
+
+	return server, recorder
+}
+
+// doTracedRequest is doRequest sent as part of the trace testTraceID.
+func doTracedRequest(t *testing.T, method, url, token string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("traceparent", "00-"+testTraceID+"-"+testParentSpanID+"-01")
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+
+	return res
+}
+
+// findSpan waits for a span of the test trace called name, child of parent
+// unless parent is nil, and returns it. The server span ends once the
+// response is sent, so it may not be recorded yet when the client gets it.
+func findSpan(t *testing.T, recorder *tracetest.SpanRecorder, parent sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	var found sdktrace.ReadOnlySpan
+	require.Eventually(t, func() bool {
+		for _, span := range recorder.Ended() {
+			if span.SpanContext().TraceID().String() != testTraceID || span.Name() != name {
+				continue
+			}
+			if parent == nil || span.Parent().SpanID() == parent.SpanContext().SpanID() {
+				found = span
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond, "no span called %s", name)
+
+	return found
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestRequestsAreTracedThroughRepositoriesAndQueries(t *testing.T) {
+	server, recorder := newTracedTestServer(t, &syncBuffer{})
+	token := signUpAndLogin(t, server)
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/products", token, dto.CreateProductInput{Name: "Product", Price: 10})
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/products", token, nil)
+	var products []entity.Product
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&products))
+	require.Len(t, products, 1)
+
+	res = doTracedRequest(t, http.MethodGet, server.URL+"/api/v1/products/"+products[0].ID.String(), token)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	request := findSpan(t, recorder, nil, "GET /api/v1/products/{id}")
+	assert.Equal(t, testParentSpanID, request.Parent().SpanID().String())
+	assert.True(t, request.Parent().IsRemote())
+	assert.Equal(t, "/api/v1/products/{id}", spanAttribute(request, "http.route").AsString())
+	assert.Equal(t, int64(http.StatusOK), spanAttribute(request, "http.response.status_code").AsInt64())
+
+	findSpan(t, recorder, request, "UserRepository.FindByID")
+	repository := findSpan(t, recorder, request, "ProductRepository.FindByID")
+	query := findSpan(t, recorder, repository, "db.query")
+	assert.Equal(t, "products", spanAttribute(query, "db.collection.name").AsString())
+	assert.True(t, strings.HasPrefix(spanAttribute(query, "db.query.text").AsString(), "SELECT * FROM `products`"))
+	assert.NotContains(t, spanAttribute(query, "db.query.text").AsString(), products[0].ID.String(), "bound values are left out")
+}
+
+func TestLoginsTraceDecodingAndPasswordHashing(t *testing.T) {
+	server, recorder := newTracedTestServer(t, &syncBuffer{})
+	signUp(t, server, "John Doe", "j@j.com", "secret123")
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/sessions",
+		strings.NewReader(`{"email":"j@j.com","password":"secret123"}`))
+	require.NoError(t, err)
+	req.Header.Set("traceparent", "00-"+testTraceID+"-"+testParentSpanID+"-01")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	request := findSpan(t, recorder, nil, "POST /api/v1/sessions")
+	findSpan(t, recorder, request, "decodeJSON")
+	findSpan(t, recorder, request, "checkPassword")
+}
+
+func TestErrorsAndLogsCarryTheTraceID(t *testing.T) {
+	var logs syncBuffer
+	server, _ := newTracedTestServer(t, &logs)
+	token := signUpAndLogin(t, server)
+
+	res := doTracedRequest(t, http.MethodGet, server.URL+"/api/v1/products/"+testParentSpanID, token)
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+	assert.Equal(t, testTraceID, decodeProblem(t, res).TraceID)
+
+	require.Eventually(t, func() bool {
+		for _, record := range logs.records(t, "request") {
+			if record["route"] == "/api/v1/products/{id}" {
+				return record["trace_id"] == testTraceID
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,114 @@
+package webserver
+
+import (
+	"encoding/json"
+	"github.com/andre2ar/go-products/internal/dto"
+	"github.com/andre2ar/go-products/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestGetCurrentUser(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+
+	res := doRequest(t, http.MethodGet, server.URL+"/api/v1/users/me", token, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	assert.Equal(t, "John Doe", body["name"])
+	assert.Equal(t, "j@j.com", body["email"])
+	assert.NotContains(t, body, "password")
+
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/users/me", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestUpdateCurrentUser(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+
+	res := doRequest(t, http.MethodPatch, server.URL+"/api/v1/users/me", token, map[string]string{"name": " Jane Doe "})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var user entity.User
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&user))
+	assert.Equal(t, "Jane Doe", user.Name)
+	assert.Equal(t, "j@j.com", user.Email)
+
+	res = doRequest(t, http.MethodPatch, server.URL+"/api/v1/users/me", token, map[string]string{"email": "JANE@j.com"})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&user))
+	assert.Equal(t, "jane@j.com", user.Email)
+
+	for _, name := range []string{"", " \t "} {
+		res = doRequest(t, http.MethodPatch, server.URL+"/api/v1/users/me", token, map[string]string{"name": name})
+		assert.Equal(t, "validation_failed", decodeProblem(t, res).Code)
+	}
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/users", "", dto.CreateUserInput{Name: "Other", Email: "other@j.com", Password: "secret123"})
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	res = doRequest(t, http.MethodPatch, server.URL+"/api/v1/users/me", token, map[string]string{"email": "other@j.com"})
+	assert.Equal(t, "email_already_in_use", decodeProblem(t, res).Code)
+}
+
+func TestDeleteCurrentUser(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+	createAPIKey(t, server, token, entity.ScopeProductsRead)
+
+	res := doRequest(t, http.MethodDelete, server.URL+"/api/v1/users/me", token, nil)
+	assert.Equal(t, "invalid_body", decodeProblem(t, res).Code)
+	res = doRequest(t, http.MethodDelete, server.URL+"/api/v1/users/me", token, dto.DeleteUserInput{Password: "wrong-password"})
+	assert.Equal(t, "invalid_credentials", decodeProblem(t, res).Code, "a token alone does not delete the account")
+
+	res = doRequest(t, http.MethodDelete, server.URL+"/api/v1/users/me", token, dto.DeleteUserInput{Password: "secret123"})
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	var keys int64
+	require.NoError(t, server.DB.Model(&entity.APIKey{}).Count(&keys).Error)
+	assert.Zero(t, keys, "the API keys of the user are deleted along with it")
+
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/users/me", token, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{Email: "j@j.com", Password: "secret123"})
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	server := newTestServer(t)
+	token := signUpAndLogin(t, server)
+
+	res := doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{Email: "j@j.com", Password: "secret123"})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var otherSession dto.AuthResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&otherSession))
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/users/me/password", token, dto.ChangePasswordInput{
+		CurrentPassword: "wrong-password",
+		NewPassword:     "new-secret123",
+	})
+	assert.Equal(t, "invalid_credentials", decodeProblem(t, res).Code)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/users/me/password", token, dto.ChangePasswordInput{
+		CurrentPassword: "secret123",
+		NewPassword:     "new-secret123",
+	})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var newSession dto.AuthResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&newSession))
+
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/users/me", otherSession.AccessToken, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/products", token, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	res = doRequest(t, http.MethodGet, server.URL+"/api/v1/users/me", newSession.AccessToken, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{Email: "j@j.com", Password: "secret123"})
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	res = doRequest(t, http.MethodPost, server.URL+"/api/v1/sessions", "", dto.LoginCredentialsInput{Email: "j@j.com", Password: "new-secret123"})
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
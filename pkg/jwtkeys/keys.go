@@ -0,0 +1,216 @@
+// Package jwtkeys signs and verifies JWTs with a ring of keys identified by
+// kid, rotated on a schedule.
+//
+// Each key signs from its ActiveFrom time until the next key becomes active
+// and keeps verifying for an overlap after that, so tokens it signed stay
+// valid until they expire. Keys whose ActiveFrom is in the future are already
+// published, letting verifiers cache them before they are used.
+package jwtkeys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"sort"
+	"time"
+)
+
+var (
+	ErrNoKeys         = errors.New("jwtkeys: at least one key is required")
+	ErrNoActiveKey    = errors.New("jwtkeys: no key is active yet")
+	ErrDuplicateKey   = errors.New("jwtkeys: duplicate key id")
+	ErrUnsupportedKey = errors.New("jwtkeys: unsupported key type")
+)
+
+// Key is a signing key and the public key verifying its signatures.
+// Symmetric keys have no public key and are never published.
+type Key struct {
+	ID         string
+	Algorithm  jwa.SignatureAlgorithm
+	ActiveFrom time.Time
+
+	private jwk.Key
+	public  jwk.Key
+}
+
+// ParsePEM loads a PEM encoded RSA, ECDSA or Ed25519 private key, picking
+// the algorithm from its type: RS256, ES256/ES384/ES512 or EdDSA.
+func ParsePEM(id string, data []byte, activeFrom time.Time) (*Key, error) {
+	raw, err := jwk.ParseKey(data, jwk.WithPEM(true))
+	if err != nil {
+		return nil, fmt.Errorf("jwtkeys: key %s: %w", id, err)
+	}
+
+	var rawKey interface{}
+	if err := raw.Raw(&rawKey); err != nil {
+		return nil, fmt.Errorf("jwtkeys: key %s: %w", id, err)
+	}
+
+	var algorithm jwa.SignatureAlgorithm
+	switch k := rawKey.(type) {
+	case *rsa.PrivateKey:
+		algorithm = jwa.RS256
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			algorithm = jwa.ES256
+		case elliptic.P384():
+			algorithm = jwa.ES384
+		case elliptic.P521():
+			algorithm = jwa.ES512
+		default:
+			return nil, fmt.Errorf("%w: key %s uses an unsupported curve", ErrUnsupportedKey, id)
+		}
+	case ed25519.PrivateKey:
+		algorithm = jwa.EdDSA
+	default:
+		return nil, fmt.Errorf("%w: key %s must be an RSA, ECDSA or Ed25519 private key", ErrUnsupportedKey, id)
+	}
+
+	return newKey(id, algorithm, raw, activeFrom, true)
+}
+
+// NewHMACKey returns an HS256 key for secret. Tokens it signs can only be
+// verified by holders of the secret.
+func NewHMACKey(id string, secret []byte, activeFrom time.Time) (*Key, error) {
+	raw, err := jwk.FromRaw(secret)
+	if err != nil {
+		return nil, fmt.Errorf("jwtkeys: key %s: %w", id, err)
+	}
+	return newKey(id, jwa.HS256, raw, activeFrom, false)
+}
+
+func newKey(id string, algorithm jwa.SignatureAlgorithm, private jwk.Key, activeFrom time.Time, asymmetric bool) (*Key, error) {
+	if err := private.Set(jwk.KeyIDKey, id); err != nil {
+		return nil, err
+	}
+	if err := private.Set(jwk.AlgorithmKey, algorithm); err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: id, Algorithm: algorithm, ActiveFrom: activeFrom, private: private}
+	if asymmetric {
+		public, err := jwk.PublicKeyOf(private)
+		if err != nil {
+			return nil, fmt.Errorf("jwtkeys: key %s: %w", id, err)
+		}
+		if err := public.Set(jwk.KeyUsageKey, jwk.ForSignature); err != nil {
+			return nil, err
+		}
+		key.public = public
+	}
+
+	return key, nil
+}
+
+// KeyRing holds keys ordered by ActiveFrom. Overlap is how long a key keeps
+// verifying once the next key is active; it should be at least the lifetime
+// of the tokens signed.
+type KeyRing struct {
+	Overlap time.Duration
+
+	keys []*Key
+	now  func() time.Time
+}
+
+func NewKeyRing(overlap time.Duration, keys ...*Key) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	ids := map[string]bool{}
+	for _, key := range keys {
+		if ids[key.ID] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateKey, key.ID)
+		}
+		ids[key.ID] = true
+	}
+
+	sorted := append([]*Key(nil), keys...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ActiveFrom.Before(sorted[j].ActiveFrom) })
+
+	return &KeyRing{Overlap: overlap, keys: sorted, now: time.Now}, nil
+}
+
+// SigningKey returns the key signing new tokens: the most recently
+// activated one.
+func (k *KeyRing) SigningKey() (*Key, error) {
+	now := k.now()
+
+	var current *Key
+	for _, key := range k.keys {
+		if key.ActiveFrom.After(now) {
+			break
+		}
+		current = key
+	}
+	if current == nil {
+		return nil, ErrNoActiveKey
+	}
+	return current, nil
+}
+
+// Sign signs token with the current signing key, naming it in the kid
+// header.
+func (k *KeyRing) Sign(token jwt.Token) ([]byte, error) {
+	key, err := k.SigningKey()
+	if err != nil {
+		return nil, err
+	}
+	return jwt.Sign(token, jwt.WithKey(key.Algorithm, key.private))
+}
+
+// Parse verifies the signature of a token against the key named by its kid
+// header, which must be active and not retired, and parses it. Claims are
+// validated with options, as jwt.Parse does.
+func (k *KeyRing) Parse(token []byte, options ...jwt.ParseOption) (jwt.Token, error) {
+	set := jwk.NewSet()
+	now := k.now()
+	for i, key := range k.keys {
+		if key.ActiveFrom.After(now) || k.retired(i, now) {
+			continue
+		}
+
+		verifying := key.public
+		if verifying == nil {
+			verifying = key.private
+		}
+		if err := set.AddKey(verifying); err != nil {
+			return nil, err
+		}
+	}
+
+	return jwt.Parse(token, append([]jwt.ParseOption{jwt.WithKeySet(set)}, options...)...)
+}
+
+// PublicKeys returns the public keys of every asymmetric key that is not
+// retired, including those not active yet, as a JWK set to publish.
+func (k *KeyRing) PublicKeys() (jwk.Set, error) {
+	set := jwk.NewSet()
+	now := k.now()
+	for i, key := range k.keys {
+		if key.public == nil || k.retired(i, now) {
+			continue
+		}
+		if err := set.AddKey(key.public); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// retired reports whether the key at index i stopped verifying because the
+// key after it has been active for longer than Overlap.
+func (k *KeyRing) retired(i int, now time.Time) bool {
+	if i+1 >= len(k.keys) {
+		return false
+	}
+	next := k.keys[i+1]
+	return !next.ActiveFrom.Add(k.Overlap).After(now)
+}
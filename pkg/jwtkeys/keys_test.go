@@ -0,0 +1,167 @@
+package jwtkeys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func pemOf(t *testing.T, key interface{}) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func signedToken(t *testing.T, ring *KeyRing) []byte {
+	t.Helper()
+
+	token := jwt.New()
+	require.NoError(t, token.Set(jwt.SubjectKey, "user"))
+	signed, err := ring.Sign(token)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestParsePEMPicksAlgorithm(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for expected, raw := range map[jwa.SignatureAlgorithm]interface{}{
+		jwa.RS256: rsaKey,
+		jwa.ES256: ecKey,
+		jwa.EdDSA: edKey,
+	} {
+		key, err := ParsePEM("k1", pemOf(t, raw), time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, expected, key.Algorithm)
+
+		ring, err := NewKeyRing(time.Hour, key)
+		require.NoError(t, err)
+		signed := signedToken(t, ring)
+
+		message, err := jws.Parse(signed)
+		require.NoError(t, err)
+		assert.Equal(t, "k1", message.Signatures()[0].ProtectedHeaders().KeyID())
+		assert.Equal(t, expected, message.Signatures()[0].ProtectedHeaders().Algorithm())
+
+		parsed, err := ring.Parse(signed)
+		require.NoError(t, err)
+		assert.Equal(t, "user", parsed.Subject())
+	}
+
+	_, err = ParsePEM("k1", []byte("not a key"), time.Time{})
+	assert.Error(t, err)
+}
+
+func TestKeyRotation(t *testing.T) {
+	now := time.Now()
+	_, first, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, second, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	firstKey, err := ParsePEM("first", pemOf(t, first), now.Add(-time.Hour))
+	require.NoError(t, err)
+	secondKey, err := ParsePEM("second", pemOf(t, second), now.Add(time.Hour))
+	require.NoError(t, err)
+	ring, err := NewKeyRing(30*time.Minute, secondKey, firstKey)
+	require.NoError(t, err)
+	ring.now = func() time.Time { return now }
+
+	signedByFirst := signedToken(t, ring)
+	published, err := ring.PublicKeys()
+	require.NoError(t, err)
+	assert.Equal(t, 2, published.Len(), "upcoming keys are published ahead of time")
+
+	// The second key takes over; tokens of the first keep verifying during
+	// the overlap.
+	now = now.Add(time.Hour)
+	signedBySecond := signedToken(t, ring)
+	message, err := jws.Parse(signedBySecond)
+	require.NoError(t, err)
+	assert.Equal(t, "second", message.Signatures()[0].ProtectedHeaders().KeyID())
+	_, err = ring.Parse(signedByFirst)
+	assert.NoError(t, err)
+
+	now = now.Add(30 * time.Minute)
+	_, err = ring.Parse(signedByFirst)
+	assert.Error(t, err, "retired keys stop verifying")
+	_, err = ring.Parse(signedBySecond)
+	assert.NoError(t, err)
+	published, err = ring.PublicKeys()
+	require.NoError(t, err)
+	assert.Equal(t, 1, published.Len())
+}
+
+func TestHMACKeysAreNotPublished(t *testing.T) {
+	key, err := NewHMACKey("default", []byte("secret"), time.Time{})
+	require.NoError(t, err)
+	ring, err := NewKeyRing(time.Hour, key)
+	require.NoError(t, err)
+
+	_, err = ring.Parse(signedToken(t, ring))
+	assert.NoError(t, err)
+
+	published, err := ring.PublicKeys()
+	require.NoError(t, err)
+	assert.Equal(t, 0, published.Len())
+}
+
+func TestPublicKeysOmitPrivateMaterial(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := ParsePEM("k1", pemOf(t, edKey), time.Time{})
+	require.NoError(t, err)
+	ring, err := NewKeyRing(time.Hour, key)
+	require.NoError(t, err)
+
+	published, err := ring.PublicKeys()
+	require.NoError(t, err)
+	encoded, err := json.Marshal(published)
+	require.NoError(t, err)
+
+	var jwks struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	require.NoError(t, json.Unmarshal(encoded, &jwks))
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "k1", jwks.Keys[0]["kid"])
+	assert.Equal(t, "EdDSA", jwks.Keys[0]["alg"])
+	assert.Equal(t, "sig", jwks.Keys[0]["use"])
+	assert.NotContains(t, jwks.Keys[0], "d")
+}
+
+func TestNewKeyRingRejectsInvalidRings(t *testing.T) {
+	_, err := NewKeyRing(time.Hour)
+	assert.ErrorIs(t, err, ErrNoKeys)
+
+	key, err := NewHMACKey("default", []byte("secret"), time.Time{})
+	require.NoError(t, err)
+	_, err = NewKeyRing(time.Hour, key, key)
+	assert.ErrorIs(t, err, ErrDuplicateKey)
+
+	future, err := NewHMACKey("future", []byte("secret"), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	ring, err := NewKeyRing(time.Hour, future)
+	require.NoError(t, err)
+	_, err = ring.Sign(jwt.New())
+	assert.ErrorIs(t, err, ErrNoActiveKey)
+}
@@ -0,0 +1,95 @@
+// Package lifecycle coordinates the shutdown of the components of an
+// application.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Stop stops a component, giving up when ctx is done.
+type Stop func(ctx context.Context) error
+
+type component struct {
+	name string
+	stop Stop
+}
+
+// Manager stops the components of an application in the reverse order they
+// were started, like deferred calls, so each one stops before the ones it
+// depends on: the HTTP server before the workers it feeds, the workers
+// before the database they use. Each stop is given Timeout of its own, so a
+// slow one, such as the drain delay, does not eat into the time of those
+// stopping after it.
+type Manager struct {
+	Timeout time.Duration
+	Logger  *slog.Logger
+
+	mu         sync.Mutex
+	components []component
+	stopped    bool
+}
+
+func New(timeout time.Duration, logger *slog.Logger) *Manager {
+	return &Manager{Timeout: timeout, Logger: logger}
+}
+
+// OnShutdown registers stop to be called when shutting down, before the
+// stops registered earlier.
+func (m *Manager) OnShutdown(name string, stop Stop) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.components = append(m.components, component{name: name, stop: stop})
+}
+
+// Shutdown stops every registered component once. A component failing or
+// running out of time does not keep the next ones from stopping, so the
+// database is closed even when requests could not be drained; the failures
+// are returned joined, each prefixed with the name of its component.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopped {
+		return nil
+	}
+	m.stopped = true
+
+	var errs []error
+	for i := len(m.components) - 1; i >= 0; i-- {
+		component := m.components[i]
+		start := time.Now()
+
+		stopCtx, cancel := context.WithTimeout(ctx, m.Timeout)
+		err := component.stop(stopCtx)
+		cancel()
+		if err != nil {
+			m.Logger.Error("could not stop component", slog.String("component", component.name), slog.Any("error", err))
+			errs = append(errs, fmt.Errorf("%s: %w", component.name, err))
+			continue
+		}
+		m.Logger.Info("component stopped", slog.String("component", component.name), slog.Duration("duration", time.Since(start)))
+	}
+	return errors.Join(errs...)
+}
+
+// Delay is a Stop waiting for delay, or until ctx is done, without failing.
+// It gives load balancers time to notice a failing readiness check before
+// the server stops accepting connections.
+func Delay(delay time.Duration) Stop {
+	return func(ctx context.Context) error {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		return nil
+	}
+}
@@ -0,0 +1,86 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func newTestManager(timeout time.Duration) *Manager {
+	return New(timeout, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestShutdownStopsInReverseOrder(t *testing.T) {
+	m := newTestManager(time.Second)
+	var stopped []string
+	for _, name := range []string{"database", "worker", "server"} {
+		name := name
+		m.OnShutdown(name, func(context.Context) error {
+			stopped = append(stopped, name)
+			return nil
+		})
+	}
+
+	assert.NoError(t, m.Shutdown(context.Background()))
+	assert.Equal(t, []string{"server", "worker", "database"}, stopped)
+
+	assert.NoError(t, m.Shutdown(context.Background()))
+	assert.Len(t, stopped, 3, "components are stopped once")
+}
+
+func TestShutdownKeepsStoppingAfterFailures(t *testing.T) {
+	m := newTestManager(20 * time.Millisecond)
+	var databaseClosed bool
+	m.OnShutdown("database", func(context.Context) error {
+		databaseClosed = true
+		return nil
+	})
+	m.OnShutdown("worker", func(context.Context) error {
+		return errors.New("queue not drained")
+	})
+	m.OnShutdown("server", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	err := m.Shutdown(context.Background())
+	assert.True(t, databaseClosed)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "server: context deadline exceeded")
+	assert.ErrorContains(t, err, "worker: queue not drained")
+}
+
+func TestShutdownTimesEachStopOut(t *testing.T) {
+	m := newTestManager(50 * time.Millisecond)
+	var errs []error
+	for _, name := range []string{"database", "server", "readiness"} {
+		m.OnShutdown(name, func(ctx context.Context) error {
+			select {
+			case <-time.After(30 * time.Millisecond):
+			case <-ctx.Done():
+			}
+			errs = append(errs, ctx.Err())
+			return nil
+		})
+	}
+
+	assert.NoError(t, m.Shutdown(context.Background()))
+	assert.Equal(t, []error{nil, nil, nil}, errs, "earlier stops do not use up the time of later ones")
+}
+
+func TestDelayGivesUpWithTheContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	assert.NoError(t, Delay(time.Minute)(ctx))
+	assert.Less(t, time.Since(start), time.Second)
+
+	start = time.Now()
+	assert.NoError(t, Delay(10*time.Millisecond)(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+}
@@ -0,0 +1,86 @@
+// Package logging builds slog loggers and carries them in contexts, so code
+// handling a request logs with the fields identifying it.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+type loggerContextKey struct{}
+
+type entryContextKey struct{}
+
+// New returns a logger writing to w records at level or above ("debug",
+// "info", "warn" or "error") in format, "json" or "text".
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("logging: invalid level %q", level)
+	}
+
+	return NewLeveled(w, minLevel, format)
+}
+
+// NewLeveled is New with a level which may change while logging, such as a
+// *slog.LevelVar.
+func NewLeveled(w io.Writer, level slog.Leveler, format string) (*slog.Logger, error) {
+	options := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(format) {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("logging: invalid format %q", format)
+	}
+}
+
+// NewContext returns a copy of ctx carrying logger.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Entry collects the fields added with With while a unit of work, typically
+// a request, runs, for the record summing it up once it is done.
+type Entry struct {
+	mu    sync.Mutex
+	attrs []any
+}
+
+// NewEntry returns a copy of ctx collecting fields into a new Entry.
+func NewEntry(ctx context.Context) (context.Context, *Entry) {
+	entry := &Entry{}
+	return context.WithValue(ctx, entryContextKey{}, entry), entry
+}
+
+// Attrs returns the fields collected so far.
+func (e *Entry) Attrs() []any {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]any(nil), e.attrs...)
+}
+
+// With returns a copy of ctx whose logger carries args, given as
+// alternating keys and values or slog.Attr. They are also added to the Entry
+// of ctx, if any.
+func With(ctx context.Context, args ...any) context.Context {
+	if entry, ok := ctx.Value(entryContextKey{}).(*Entry); ok {
+		entry.mu.Lock()
+		entry.attrs = append(entry.attrs, args...)
+		entry.mu.Unlock()
+	}
+	return NewContext(ctx, FromContext(ctx).With(args...))
+}
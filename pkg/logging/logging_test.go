@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "warn", "json")
+	require.NoError(t, err)
+
+	logger.Info("ignored")
+	logger.Warn("kept", "key", "value")
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "kept", record["msg"])
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "value", record["key"])
+
+	_, err = New(&buf, "loud", "json")
+	assert.Error(t, err)
+	_, err = New(&buf, "info", "xml")
+	assert.Error(t, err)
+}
+
+func TestNewLeveled(t *testing.T) {
+	var buf bytes.Buffer
+	level := new(slog.LevelVar)
+	level.Set(slog.LevelWarn)
+	logger, err := NewLeveled(&buf, level, "text")
+	require.NoError(t, err)
+
+	logger.Info("ignored")
+	level.Set(slog.LevelInfo)
+	logger.Info("kept")
+
+	assert.NotContains(t, buf.String(), "ignored")
+	assert.Contains(t, buf.String(), "msg=kept")
+}
+
+func TestContextLogger(t *testing.T) {
+	assert.Equal(t, slog.Default(), FromContext(context.Background()))
+
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "text")
+	require.NoError(t, err)
+
+	ctx, entry := NewEntry(NewContext(context.Background(), logger))
+	ctx = With(ctx, "user_id", "42")
+	FromContext(ctx).Info("hello")
+
+	assert.Contains(t, buf.String(), "msg=hello user_id=42")
+	assert.Equal(t, []any{"user_id", "42"}, entry.Attrs())
+}
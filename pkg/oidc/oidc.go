@@ -0,0 +1,261 @@
+// Package oidc implements the relying party side of the OpenID Connect
+// authorization code flow with PKCE: provider discovery, authorization URLs,
+// code exchange and ID token validation.
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/andre2ar/go-products/pkg/securetoken"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// clockSkew is the leeway granted to the provider's clock when checking
+	// the validity period of ID tokens.
+	clockSkew = time.Minute
+	// keysRefreshInterval is the least time the provider keys are cached
+	// for, longer when its caching headers allow.
+	keysRefreshInterval = 15 * time.Minute
+)
+
+var (
+	// ErrUnavailable is returned when the provider cannot be reached or
+	// answers with a server error.
+	ErrUnavailable = errors.New("oidc: provider unavailable")
+	// ErrExchangeFailed is returned when the provider refuses to exchange an
+	// authorization code.
+	ErrExchangeFailed = errors.New("oidc: code exchange failed")
+	// ErrInvalidIDToken is returned for ID tokens that fail validation.
+	ErrInvalidIDToken = errors.New("oidc: invalid id token")
+)
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Claims are the identity claims of a validated ID token.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is an OpenID Connect provider. Its metadata is discovered on
+// first use, so the provider does not need to be up when Provider is
+// created. Its signing keys are cached and refreshed in the background.
+type Provider struct {
+	Config
+	Client *http.Client
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     *jwk.Cache
+	now      func() time.Time
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func NewProvider(config Config, client *http.Client) *Provider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Provider{Config: config, Client: client, keys: jwk.NewCache(context.Background()), now: time.Now}
+}
+
+// GenerateVerifier returns a random PKCE code verifier.
+func GenerateVerifier() (string, error) {
+	return securetoken.Generate()
+}
+
+// Challenge returns the S256 PKCE code challenge of verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL to send the user to for logging in. state
+// protects the callback against forgery, nonce binds the ID token to this
+// login and verifier is the PKCE code verifier later passed to Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return metadata.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades an authorization code for an ID token and returns its
+// claims once the token is validated against the provider keys, issuer,
+// client ID and nonce.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	var response struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.do(req, &response); err != nil {
+		return nil, err
+	}
+	if response.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in token response", ErrExchangeFailed)
+	}
+
+	return p.verify(ctx, metadata, response.IDToken, nonce)
+}
+
+func (p *Provider) verify(ctx context.Context, metadata *metadata, idToken, nonce string) (*Claims, error) {
+	keys, err := p.keys.Get(ctx, metadata.JWKSURI)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	token, err := jwt.Parse([]byte(idToken),
+		jwt.WithKeySet(keys, jws.WithInferAlgorithmFromKey(true)),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithClock(jwt.ClockFunc(p.now)),
+		jwt.WithAcceptableSkew(clockSkew),
+		jwt.WithRequiredClaim(jwt.SubjectKey),
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	claims := token.PrivateClaims()
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce == "" || tokenNonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	result := &Claims{Subject: token.Subject()}
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	// Some providers send email_verified as a string.
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = verified
+	case string:
+		result.EmailVerified = verified == "true"
+	}
+
+	return result, nil
+}
+
+// discover fetches and caches the provider metadata, retrying on later
+// calls when it fails.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var discovered metadata
+	if err := p.do(req, &discovered); err != nil {
+		if !errors.Is(err, ErrUnavailable) {
+			err = fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		return nil, err
+	}
+	if discovered.Issuer != p.Issuer {
+		return nil, fmt.Errorf("%w: discovered issuer %q does not match %q", ErrUnavailable, discovered.Issuer, p.Issuer)
+	}
+	if discovered.AuthorizationEndpoint == "" || discovered.TokenEndpoint == "" || discovered.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: incomplete provider metadata", ErrUnavailable)
+	}
+	err = p.keys.Register(discovered.JWKSURI, jwk.WithHTTPClient(p.Client), jwk.WithMinRefreshInterval(keysRefreshInterval))
+	if err != nil {
+		return nil, err
+	}
+
+	p.metadata = &discovered
+	return p.metadata, nil
+}
+
+// do sends req and decodes its JSON response into v.
+func (p *Provider) do(req *http.Request, v interface{}) error {
+	res, err := p.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	switch {
+	case res.StatusCode >= 500:
+		return fmt.Errorf("%w: %s answered %d", ErrUnavailable, req.URL, res.StatusCode)
+	case res.StatusCode >= 400:
+		return fmt.Errorf("%w: %s answered %d: %s", ErrExchangeFailed, req.URL, res.StatusCode, body)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return nil
+}
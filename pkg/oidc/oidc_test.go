@@ -0,0 +1,120 @@
+package oidc_test
+
+import (
+	"context"
+	"github.com/andre2ar/go-products/pkg/oidc"
+	"github.com/andre2ar/go-products/pkg/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+var noRedirects = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}}
+
+// authorize follows authURL and returns the code it redirects
+// back with.
+func authorize(t *testing.T, authURL, state string) string {
+	t.Helper()
+
+	res, err := noRedirects.Get(authURL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusFound, res.StatusCode)
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "/callback", location.Path)
+	assert.Equal(t, state, location.Query().Get("state"))
+
+	return location.Query().Get("code")
+}
+
+func newProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	server := oidctest.NewServer("go-products", "client-secret")
+	t.Cleanup(server.Close)
+	server.SetIdentity(oidc.Claims{Subject: "user-1", Email: "j@j.com", EmailVerified: true, Name: "John Doe"})
+
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:       server.URL,
+		ClientID:     "go-products",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost/callback",
+		Scopes:       []string{"openid", "email"},
+	}, nil)
+
+	return server, provider
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	_, provider := newProvider(t)
+	ctx := context.Background()
+
+	verifier, err := oidc.GenerateVerifier()
+	require.NoError(t, err)
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	require.NoError(t, err)
+	code := authorize(t, authURL, "state-1")
+
+	claims, err := provider.Exchange(ctx, code, verifier, "nonce-1")
+	require.NoError(t, err)
+	assert.Equal(t, &oidc.Claims{Subject: "user-1", Email: "j@j.com", EmailVerified: true, Name: "John Doe"}, claims)
+
+	_, err = provider.Exchange(ctx, code, verifier, "nonce-1")
+	assert.ErrorIs(t, err, oidc.ErrExchangeFailed, "codes are single use")
+}
+
+func TestProviderKeysAreCached(t *testing.T) {
+	server, provider := newProvider(t)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		verifier, err := oidc.GenerateVerifier()
+		require.NoError(t, err)
+		authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", verifier)
+		require.NoError(t, err)
+		_, err = provider.Exchange(ctx, authorize(t, authURL, "state"), verifier, "nonce")
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 1, server.KeyRequests())
+}
+
+func TestExchangeRequiresPKCEVerifierAndNonce(t *testing.T) {
+	_, provider := newProvider(t)
+	ctx := context.Background()
+
+	verifier, err := oidc.GenerateVerifier()
+	require.NoError(t, err)
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	require.NoError(t, err)
+
+	_, err = provider.Exchange(ctx, authorize(t, authURL, "state-1"), "other-verifier", "nonce-1")
+	assert.ErrorIs(t, err, oidc.ErrExchangeFailed)
+
+	_, err = provider.Exchange(ctx, authorize(t, authURL, "state-1"), verifier, "other-nonce")
+	assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+}
+
+func TestDiscoveryRequiresMatchingIssuer(t *testing.T) {
+	server, _ := newProvider(t)
+	provider := oidc.NewProvider(oidc.Config{Issuer: server.URL + "/", ClientID: "go-products"}, nil)
+
+	_, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	assert.ErrorIs(t, err, oidc.ErrUnavailable)
+}
+
+func TestUnreachableProvider(t *testing.T) {
+	provider := oidc.NewProvider(oidc.Config{Issuer: "http://127.0.0.1:1"}, nil)
+
+	_, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	assert.ErrorIs(t, err, oidc.ErrUnavailable)
+}
+
+func TestChallenge(t *testing.T) {
+	// RFC 7636 appendix B.
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", oidc.Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+}
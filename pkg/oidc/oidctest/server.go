@@ -0,0 +1,211 @@
+// Package oidctest provides an in-process OpenID Connect provider for tests.
+// It approves every authorization request, logging the user in as the
+// identity set with SetIdentity.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/andre2ar/go-products/pkg/oidc"
+	"github.com/andre2ar/go-products/pkg/securetoken"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const keyID = "oidctest"
+
+// Server is a mock OpenID Connect provider listening on a local address.
+// Its issuer is Server.URL.
+type Server struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	key jwk.Key
+
+	mu             sync.Mutex
+	identity       oidc.Claims
+	authorizations map[string]authorization
+	keyRequests    int
+}
+
+type authorization struct {
+	redirectURI string
+	nonce       string
+	challenge   string
+	identity    oidc.Claims
+}
+
+// NewServer starts a provider accepting the client clientID authenticated
+// with clientSecret. Callers must Close it.
+func NewServer(clientID, clientSecret string) *Server {
+	rawKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic("oidctest: " + err.Error())
+	}
+	key, err := jwk.FromRaw(rawKey)
+	if err != nil {
+		panic("oidctest: " + err.Error())
+	}
+	key.Set(jwk.KeyIDKey, keyID)
+	key.Set(jwk.AlgorithmKey, jwa.RS256)
+
+	s := &Server{
+		ClientID:       clientID,
+		ClientSecret:   clientSecret,
+		key:            key,
+		authorizations: map[string]authorization{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/jwks", s.jwks)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// SetIdentity sets the identity that following authorizations log in as.
+func (s *Server) SetIdentity(identity oidc.Claims) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.identity = identity
+}
+
+// KeyRequests returns how many times the signing keys were fetched.
+func (s *Server) KeyRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keyRequests
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.URL,
+		"authorization_endpoint":                s.URL + "/authorize",
+		"token_endpoint":                        s.URL + "/token",
+		"jwks_uri":                              s.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") != s.ClientID ||
+		query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code, err := securetoken.Generate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	s.authorizations[code] = authorization{
+		redirectURI: redirectURI.String(),
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+		identity:    s.identity,
+	}
+	s.mu.Unlock()
+
+	callback := redirectURI.Query()
+	callback.Set("code", code)
+	callback.Set("state", query.Get("state"))
+	redirectURI.RawQuery = callback.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	clientID, _ = url.QueryUnescape(clientID)
+	clientSecret, _ = url.QueryUnescape(clientSecret)
+	if clientID != s.ClientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(s.ClientSecret)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostFormValue("code")
+	s.mu.Lock()
+	auth, found := s.authorizations[code]
+	delete(s.authorizations, code)
+	s.mu.Unlock()
+
+	if r.PostFormValue("grant_type") != "authorization_code" || !found ||
+		r.PostFormValue("redirect_uri") != auth.redirectURI ||
+		oidc.Challenge(r.PostFormValue("code_verifier")) != auth.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.New()
+	idToken.Set(jwt.IssuerKey, s.URL)
+	idToken.Set(jwt.AudienceKey, []string{s.ClientID})
+	idToken.Set(jwt.SubjectKey, auth.identity.Subject)
+	idToken.Set(jwt.IssuedAtKey, now)
+	idToken.Set(jwt.ExpirationKey, now.Add(5*time.Minute))
+	idToken.Set("nonce", auth.nonce)
+	idToken.Set("email", auth.identity.Email)
+	idToken.Set("email_verified", auth.identity.EmailVerified)
+	idToken.Set("name", auth.identity.Name)
+
+	signed, err := jwt.Sign(idToken, jwt.WithKey(jwa.RS256, s.key))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "oidctest-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     string(signed),
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.keyRequests++
+	s.mu.Unlock()
+
+	public, err := s.key.PublicKey()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	set := jwk.NewSet()
+	set.AddKey(public)
+	writeJSON(w, http.StatusOK, set)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
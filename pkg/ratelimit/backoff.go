@@ -0,0 +1,199 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Backoff tracks consecutive failures per key. After FreeFailures failures
+// each further one blocks the key for a delay starting at BaseDelay and
+// doubling with every failure; reaching MaxFailures locks the key out for
+// Lockout and starts the count over. A zero BaseDelay disables the delays.
+// Keys without failures for Lockout are forgotten.
+//
+// Reserve counts an attempt up front, until Failure, Success or Release
+// settles it, so concurrent attempts cannot all pass before the failures of
+// the first ones are recorded.
+type Backoff struct {
+	FreeFailures int
+	BaseDelay    time.Duration
+	MaxFailures  int
+	Lockout      time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*failures
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// pendingRetry is how long attempts waiting for reserved ones to settle are
+// told to retry after.
+const pendingRetry = time.Second
+
+type failures struct {
+	count        int
+	pending      int
+	last         time.Time
+	blockedUntil time.Time
+}
+
+func NewBackoff(freeFailures int, baseDelay time.Duration, maxFailures int, lockout time.Duration) *Backoff {
+	return &Backoff{
+		FreeFailures: freeFailures,
+		BaseDelay:    baseDelay,
+		MaxFailures:  maxFailures,
+		Lockout:      lockout,
+		entries:      map[string]*failures{},
+		now:          time.Now,
+	}
+}
+
+// Configure changes the policy applied from now on, keeping the failures
+// already counted.
+func (b *Backoff) Configure(freeFailures int, baseDelay time.Duration, maxFailures int, lockout time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.FreeFailures = freeFailures
+	b.BaseDelay = baseDelay
+	b.MaxFailures = maxFailures
+	b.Lockout = lockout
+}
+
+// Limits returns the failures locking a key out and for how long.
+func (b *Backoff) Limits() (maxFailures int, lockout time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.MaxFailures, b.Lockout
+}
+
+// Check reports whether key may be attempted now and, when it may not, how
+// long until it can.
+func (b *Backoff) Check(key string) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.sweep(now)
+
+	f, ok := b.entries[key]
+	if !ok || !now.Before(f.blockedUntil) {
+		return true, 0
+	}
+	return false, f.blockedUntil.Sub(now)
+}
+
+// Reserve is Check reserving the attempt it allows, which counts until it
+// is settled: attempts that a failure of the reserved ones would delay wait
+// for them, and no more attempts than are left before the lockout are
+// reserved at once.
+func (b *Backoff) Reserve(key string) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.sweep(now)
+
+	f := b.entry(key, now)
+	if now.Before(f.blockedUntil) {
+		return false, f.blockedUntil.Sub(now)
+	}
+
+	attempts := f.count + f.pending
+	if f.pending > 0 && (attempts >= b.MaxFailures || b.BaseDelay > 0 && attempts > b.FreeFailures) {
+		return false, pendingRetry
+	}
+	f.pending++
+	f.last = now
+	return true, 0
+}
+
+// Release settles an attempt reserved for key without counting it as a
+// failure.
+func (b *Backoff) Release(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if f, ok := b.entries[key]; ok && f.pending > 0 {
+		f.pending--
+	}
+}
+
+// Failure records a failed attempt for key, settling one reserved for it if
+// any, and reports whether it locked the key out.
+func (b *Backoff) Failure(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.sweep(now)
+
+	f := b.entry(key, now)
+	if f.pending > 0 {
+		f.pending--
+	}
+	f.count++
+	f.last = now
+
+	if f.count >= b.MaxFailures {
+		f.count = 0
+		f.blockedUntil = now.Add(b.Lockout)
+		return true
+	}
+
+	if f.count > b.FreeFailures && b.BaseDelay > 0 {
+		delay := b.BaseDelay << (f.count - b.FreeFailures - 1)
+		if delay <= 0 || delay > b.Lockout {
+			delay = b.Lockout
+		}
+		f.blockedUntil = now.Add(delay)
+	}
+	return false
+}
+
+// Success forgets the failures of key, settling an attempt reserved for it
+// if any. Other reserved attempts still count until settled.
+func (b *Backoff) Success(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	f, ok := b.entries[key]
+	if !ok {
+		return
+	}
+	if f.pending <= 1 {
+		delete(b.entries, key)
+		return
+	}
+	*f = failures{pending: f.pending - 1, last: f.last}
+}
+
+// entry returns the failures of key, starting expired ones over.
+func (b *Backoff) entry(key string, now time.Time) *failures {
+	f, ok := b.entries[key]
+	if !ok || b.expired(f, now) {
+		f = &failures{}
+		b.entries[key] = f
+	}
+	return f
+}
+
+// sweep forgets the expired keys, at most once per sweepInterval; until
+// then Failure starts expired keys over.
+func (b *Backoff) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < sweepInterval {
+		return
+	}
+	b.lastSweep = now
+
+	for key, f := range b.entries {
+		if b.expired(f, now) {
+			delete(b.entries, key)
+		}
+	}
+}
+
+func (b *Backoff) expired(f *failures, now time.Time) bool {
+	return f.pending == 0 && now.Sub(f.last) >= b.Lockout && !now.Before(f.blockedUntil)
+}
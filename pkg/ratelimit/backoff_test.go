@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelaysAndLocksOut(t *testing.T) {
+	now := time.Now()
+	backoff := NewBackoff(2, time.Second, 5, time.Minute)
+	backoff.now = func() time.Time { return now }
+
+	assert.False(t, backoff.Failure("a"))
+	assert.False(t, backoff.Failure("a"))
+	allowed, _ := backoff.Check("a")
+	assert.True(t, allowed, "free failures are not delayed")
+
+	assert.False(t, backoff.Failure("a"))
+	allowed, retryAfter := backoff.Check("a")
+	assert.False(t, allowed)
+	assert.Equal(t, time.Second, retryAfter)
+
+	now = now.Add(time.Second)
+	assert.False(t, backoff.Failure("a"))
+	_, retryAfter = backoff.Check("a")
+	assert.Equal(t, 2*time.Second, retryAfter, "delays double")
+
+	allowed, _ = backoff.Check("b")
+	assert.True(t, allowed, "keys are independent")
+
+	now = now.Add(2 * time.Second)
+	assert.True(t, backoff.Failure("a"))
+	allowed, retryAfter = backoff.Check("a")
+	assert.False(t, allowed)
+	assert.Equal(t, time.Minute, retryAfter)
+
+	now = now.Add(time.Minute)
+	allowed, _ = backoff.Check("a")
+	assert.True(t, allowed)
+	assert.False(t, backoff.Failure("a"), "the count starts over after a lockout")
+}
+
+func TestBackoffSuccessForgetsFailures(t *testing.T) {
+	now := time.Now()
+	backoff := NewBackoff(0, time.Second, 5, time.Minute)
+	backoff.now = func() time.Time { return now }
+
+	backoff.Failure("a")
+	allowed, _ := backoff.Check("a")
+	assert.False(t, allowed)
+
+	backoff.Success("a")
+	allowed, _ = backoff.Check("a")
+	assert.True(t, allowed)
+}
+
+func TestBackoffReserveCountsPendingAttempts(t *testing.T) {
+	now := time.Now()
+	backoff := NewBackoff(2, time.Second, 5, time.Minute)
+	backoff.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := backoff.Reserve("a")
+		assert.True(t, allowed, "attempts until the first delayed one are not held back")
+	}
+	allowed, retryAfter := backoff.Reserve("a")
+	assert.False(t, allowed, "attempts a failure would delay wait for the pending ones")
+	assert.Equal(t, pendingRetry, retryAfter)
+
+	backoff.Release("a")
+	allowed, _ = backoff.Reserve("a")
+	assert.True(t, allowed, "released attempts are not counted")
+
+	assert.False(t, backoff.Failure("a"))
+	allowed, _ = backoff.Reserve("a")
+	assert.False(t, allowed, "failures count with the attempts still pending")
+
+	backoff.Success("a")
+	allowed, _ = backoff.Reserve("a")
+	assert.True(t, allowed, "a success forgets the failures but not the pending attempts")
+	allowed, _ = backoff.Reserve("a")
+	assert.True(t, allowed)
+	allowed, _ = backoff.Reserve("a")
+	assert.False(t, allowed)
+}
+
+func TestBackoffReserveStopsAtMaxFailures(t *testing.T) {
+	now := time.Now()
+	backoff := NewBackoff(3, 0, 3, time.Minute)
+	backoff.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := backoff.Reserve("a")
+		assert.True(t, allowed)
+	}
+	allowed, _ := backoff.Reserve("a")
+	assert.False(t, allowed, "no more attempts are pending than are left before the lockout")
+
+	backoff.Failure("a")
+	backoff.Failure("a")
+	assert.True(t, backoff.Failure("a"))
+	allowed, retryAfter := backoff.Reserve("a")
+	assert.False(t, allowed)
+	assert.Equal(t, time.Minute, retryAfter)
+}
+
+func TestBackoffConfigure(t *testing.T) {
+	now := time.Now()
+	backoff := NewBackoff(0, 0, 3, time.Minute)
+	backoff.now = func() time.Time { return now }
+
+	assert.False(t, backoff.Failure("a"))
+	backoff.Configure(0, 0, 2, time.Hour)
+	maxFailures, lockout := backoff.Limits()
+	assert.Equal(t, 2, maxFailures)
+	assert.Equal(t, time.Hour, lockout)
+
+	assert.True(t, backoff.Failure("a"), "failures counted before are kept")
+	_, retryAfter := backoff.Check("a")
+	assert.Equal(t, time.Hour, retryAfter)
+}
+
+func TestBackoffForgetsExpiredKeys(t *testing.T) {
+	now := time.Now()
+	backoff := NewBackoff(0, 0, 2, 30*time.Second)
+	backoff.now = func() time.Time { return now }
+
+	assert.False(t, backoff.Failure("a"))
+	now = now.Add(30 * time.Second)
+	assert.False(t, backoff.Failure("a"), "expired failures start over before the sweep")
+
+	now = now.Add(sweepInterval)
+	backoff.Check("b")
+	assert.Empty(t, backoff.entries)
+}
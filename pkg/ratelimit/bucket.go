@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval bounds how often the limiters scan their keys to forget the
+// expired ones, so a burst of distinct keys does not cost a scan per request.
+const sweepInterval = time.Minute
+
+// Limit allows bursts of up to Burst requests per key, refilled at Rate
+// requests per second. A zero Limit allows every request.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute returns the Limit refilling requests per minute and allowing
+// bursts of burst requests.
+func PerMinute(requests, burst int) Limit {
+	return Limit{Rate: float64(requests) / 60, Burst: burst}
+}
+
+func (l Limit) disabled() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed bool
+	// Limit is the capacity of the bucket and Remaining the tokens left
+	// in it.
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until a token is available, when the request
+	// was not allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Store keeps token buckets per key. Take must refill and take from the
+// bucket atomically, so a Store shared by several servers, such as one
+// backed by Redis, enforces a single limit across all of them.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// TokenBucket limits requests per key with the token buckets kept in Store.
+type TokenBucket struct {
+	Store Store
+
+	mu    sync.RWMutex
+	limit Limit
+}
+
+func NewTokenBucket(store Store, limit Limit) *TokenBucket {
+	return &TokenBucket{Store: store, limit: limit}
+}
+
+// Configure changes the limit applied from now on, keeping the buckets.
+func (b *TokenBucket) Configure(limit Limit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.limit = limit
+}
+
+// Take takes a token from the bucket of key. When the limit is disabled
+// the request is allowed with a zero Result.Limit.
+func (b *TokenBucket) Take(ctx context.Context, key string) (Result, error) {
+	b.mu.RLock()
+	limit := b.limit
+	b.mu.RUnlock()
+
+	if limit.disabled() {
+		return Result{Allowed: true}, nil
+	}
+	return b.Store.Take(ctx, key, limit)
+}
+
+// MemoryStore is a Store keeping the buckets in memory, limiting requests
+// per server.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// Take implements Store.
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+	b.limit = limit
+
+	result := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	result.Remaining = int(math.Floor(b.tokens))
+	result.Reset = seconds((float64(limit.Burst) - b.tokens) / limit.Rate)
+
+	return result, nil
+}
+
+// sweep forgets the buckets which refilled, as they behave like new ones.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreRefillsBuckets(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := PerMinute(60, 2)
+
+	result, err := store.Take(context.Background(), "a", limit)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second}, result)
+
+	result, _ = store.Take(context.Background(), "a", limit)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 2*time.Second, result.Reset)
+
+	result, _ = store.Take(context.Background(), "a", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+
+	result, _ = store.Take(context.Background(), "b", limit)
+	assert.True(t, result.Allowed, "keys have their own bucket")
+
+	now = now.Add(500 * time.Millisecond)
+	result, _ = store.Take(context.Background(), "a", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+
+	now = now.Add(500 * time.Millisecond)
+	result, _ = store.Take(context.Background(), "a", limit)
+	assert.True(t, result.Allowed, "a token was refilled")
+}
+
+func TestMemoryStoreForgetsRefilledBuckets(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := PerMinute(60, 2)
+
+	store.Take(context.Background(), "a", limit)
+	now = now.Add(sweepInterval)
+	store.Take(context.Background(), "b", limit)
+
+	assert.NotContains(t, store.buckets, "a")
+	assert.Contains(t, store.buckets, "b")
+}
+
+func TestTokenBucketConfigure(t *testing.T) {
+	bucket := NewTokenBucket(NewMemoryStore(), Limit{})
+
+	result, err := bucket.Take(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, Result{Allowed: true}, result, "a zero limit allows every request")
+
+	bucket.Configure(PerMinute(60, 1))
+	result, _ = bucket.Take(context.Background(), "a")
+	assert.True(t, result.Allowed)
+	result, _ = bucket.Take(context.Background(), "a")
+	assert.False(t, result.Allowed)
+}
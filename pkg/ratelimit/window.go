@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// WindowLimiter allows up to Limit events per key within each fixed Window.
+type WindowLimiter struct {
+	Limit  int
+	Window time.Duration
+
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+func NewWindowLimiter(limit int, period time.Duration) *WindowLimiter {
+	return &WindowLimiter{Limit: limit, Window: period, windows: map[string]*window{}, now: time.Now}
+}
+
+// Configure changes the limit and window applied from now on, keeping the
+// events already counted.
+func (l *WindowLimiter) Configure(limit int, window time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.Limit = limit
+	l.Window = window
+}
+
+// Allow records an event for key and reports whether it fits in the current
+// window; when it does not, it also returns how long until the window resets.
+func (l *WindowLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.Window {
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+
+	if w.count >= l.Limit {
+		return false, w.start.Add(l.Window).Sub(now)
+	}
+
+	w.count++
+	return true, 0
+}
+
+// sweep forgets the elapsed windows, at most once per sweepInterval; until
+// then Allow starts elapsed windows over.
+func (l *WindowLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.Window {
+			delete(l.windows, key)
+		}
+	}
+}
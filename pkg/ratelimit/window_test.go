@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWindowLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := NewWindowLimiter(2, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	allowed, _ := limiter.Allow("a")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("a")
+	assert.True(t, allowed)
+
+	allowed, retryAfter := limiter.Allow("a")
+	assert.False(t, allowed)
+	assert.Equal(t, time.Minute, retryAfter)
+
+	allowed, _ = limiter.Allow("b")
+	assert.True(t, allowed)
+
+	now = now.Add(time.Minute)
+	allowed, _ = limiter.Allow("a")
+	assert.True(t, allowed)
+}
+
+func TestWindowLimiterConfigureKeepsCounts(t *testing.T) {
+	now := time.Now()
+	limiter := NewWindowLimiter(1, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	allowed, _ := limiter.Allow("a")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("a")
+	assert.False(t, allowed)
+
+	limiter.Configure(2, time.Hour)
+	allowed, _ = limiter.Allow("a")
+	assert.True(t, allowed)
+	allowed, retryAfter := limiter.Allow("a")
+	assert.False(t, allowed)
+	assert.Equal(t, time.Hour, retryAfter)
+}
+
+func TestWindowLimiterForgetsElapsedWindows(t *testing.T) {
+	now := time.Now()
+	limiter := NewWindowLimiter(1, 10*time.Second)
+	limiter.now = func() time.Time { return now }
+
+	limiter.Allow("a")
+	now = now.Add(10 * time.Second)
+	allowed, _ := limiter.Allow("a")
+	assert.True(t, allowed, "elapsed windows start over before the sweep")
+
+	now = now.Add(sweepInterval)
+	limiter.Allow("b")
+	assert.NotContains(t, limiter.windows, "a")
+}
@@ -0,0 +1,22 @@
+package securetoken
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	first, err := Generate()
+	assert.NoError(t, err)
+	second, err := Generate()
+	assert.NoError(t, err)
+
+	assert.Len(t, first, 43)
+	assert.NotEqual(t, first, second)
+}
+
+func TestHash(t *testing.T) {
+	assert.Equal(t, Hash("token"), Hash("token"))
+	assert.NotEqual(t, Hash("token"), Hash("other"))
+	assert.Len(t, Hash("token"), 64)
+}
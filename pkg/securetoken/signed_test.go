@@ -0,0 +1,29 @@
+package securetoken
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	key := DeriveKey([]byte("secret"), "test")
+	now := time.Now()
+	token := Sign(key, "user|j@j.com", now.Add(time.Hour))
+
+	payload, err := Verify(key, token, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "user|j@j.com", payload)
+
+	_, err = Verify(key, token, now.Add(2*time.Hour))
+	assert.ErrorIs(t, err, ErrExpired)
+
+	_, err = Verify(DeriveKey([]byte("secret"), "other"), token, now)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = Verify(key, "x"+token, now)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = Verify(key, "garbage", now)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
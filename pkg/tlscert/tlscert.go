@@ -0,0 +1,112 @@
+// Package tlscert serves TLS certificates from files, reading them again
+// when they change so certificates can be renewed without a restart.
+package tlscert
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkInterval bounds how often handshakes check whether the files
+// changed, so renewed certificates are served within that time without
+// every handshake touching the file system.
+const checkInterval = 10 * time.Second
+
+// Reloader serves the certificate and private key read from CertFile and
+// KeyFile. Handshakes check whether either file changed, at most once per
+// checkInterval, and read them again if so; a pair which can not be loaded,
+// such as a certificate written before its key, is logged and the previous
+// certificate is kept.
+type Reloader struct {
+	CertFile string
+	KeyFile  string
+	Logger   *slog.Logger
+
+	cert      atomic.Pointer[tls.Certificate]
+	nextCheck atomic.Int64
+	now       func() time.Time
+
+	// mu is held while checking the files, which handshakes arriving in
+	// the meantime do not wait for.
+	mu     sync.Mutex
+	loaded stamp
+}
+
+// stamp identifies the version of the certificate and key files.
+type stamp struct {
+	certModified, keyModified time.Time
+	certSize, keySize         int64
+}
+
+// New loads the certificate in certFile and the key in keyFile, failing if
+// they can not be used.
+func New(certFile, keyFile string, logger *slog.Logger) (*Reloader, error) {
+	r := &Reloader{CertFile: certFile, KeyFile: keyFile, Logger: logger, now: time.Now}
+
+	loaded, err := r.stamp()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	r.cert.Store(&cert)
+	r.loaded = loaded
+	r.nextCheck.Store(r.now().Add(checkInterval).UnixNano())
+
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, as expected by
+// tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	now := r.now()
+	if now.UnixNano() >= r.nextCheck.Load() && r.mu.TryLock() {
+		r.nextCheck.Store(now.Add(checkInterval).UnixNano())
+		r.reload()
+		r.mu.Unlock()
+	}
+	return r.cert.Load(), nil
+}
+
+// reload reads the files again when they changed since they were loaded.
+func (r *Reloader) reload() {
+	current, err := r.stamp()
+	if err != nil || current == r.loaded {
+		return
+	}
+
+	// The new stamp is recorded even when loading fails, so the files are
+	// not read again on every check until they change once more.
+	r.loaded = current
+	cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		r.Logger.Error("could not reload the TLS certificate, keeping the previous one", slog.Any("error", err))
+		return
+	}
+	r.cert.Store(&cert)
+	r.Logger.Info("TLS certificate reloaded", slog.String("file", r.CertFile))
+}
+
+func (r *Reloader) stamp() (stamp, error) {
+	certInfo, err := os.Stat(r.CertFile)
+	if err != nil {
+		return stamp{}, err
+	}
+	keyInfo, err := os.Stat(r.KeyFile)
+	if err != nil {
+		return stamp{}, err
+	}
+
+	return stamp{
+		certModified: certInfo.ModTime(),
+		keyModified:  keyInfo.ModTime(),
+		certSize:     certInfo.Size(),
+		keySize:      keyInfo.Size(),
+	}, nil
+}
@@ -0,0 +1,72 @@
+package tlscert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/andre2ar/go-products/pkg/tlscert/tlscerttest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func commonName(t *testing.T, r *Reloader) string {
+	t.Helper()
+
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+// touch moves the modification time of the files forward, so changes are
+// noticed even on file systems with a coarse time resolution.
+func touch(t *testing.T, files ...string) {
+	t.Helper()
+
+	later := time.Now().Add(time.Minute)
+	for _, file := range files {
+		require.NoError(t, os.Chtimes(file, later, later))
+	}
+}
+
+func TestReloaderReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	require.NoError(t, tlscerttest.Write(certFile, keyFile, "first"))
+
+	r, err := New(certFile, keyFile, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	assert.Equal(t, "first", commonName(t, r))
+
+	require.NoError(t, tlscerttest.Write(certFile, keyFile, "second"))
+	touch(t, certFile, keyFile)
+	assert.Equal(t, "first", commonName(t, r), "the files are checked once per interval")
+	now = now.Add(checkInterval)
+	assert.Equal(t, "second", commonName(t, r))
+
+	require.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0o600))
+	now = now.Add(checkInterval)
+	assert.Equal(t, "second", commonName(t, r), "an unusable pair keeps the previous certificate")
+}
+
+func TestNewFailsOnUnusableFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	_, err := New(certFile, keyFile, logger)
+	assert.Error(t, err)
+
+	require.NoError(t, tlscerttest.Write(certFile, keyFile, "first"))
+	require.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0o600))
+	_, err = New(certFile, keyFile, logger)
+	assert.Error(t, err)
+}
@@ -0,0 +1,193 @@
+package validator
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FieldError describes a single rule violated by a field, identified by its
+// JSON name.
+type FieldError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// Errors lists every violation found while validating a struct.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldErr := range e {
+		messages = append(messages, fieldErr.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+type rule func(field string, value reflect.Value, param string) *FieldError
+
+var rules = map[string]rule{
+	"required": checkRequired,
+	"notblank": checkNotBlank,
+	"email":    checkEmail,
+	"password": checkPassword,
+	"min":      checkMin,
+	"max":      checkMax,
+	"gt":       checkGt,
+}
+
+// Validate checks the exported fields of the struct pointed to by v against
+// the comma separated rules in their `validate` tag, e.g.
+// `validate:"required,email,max=254"`, and returns all violations at once as
+// Errors. Supported rules are required, notblank (like required, but only
+// for present values, for optional fields), email, password (at least 8
+// characters and at most 72 bytes, mixing letters and digits), min and max (string length or numeric value)
+// and gt (numeric value). Only required applies to empty values; pointer
+// fields are checked against the value they point to when not nil.
+func Validate(v interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validator: %T is not a struct", v))
+	}
+
+	var errs Errors
+	for i := 0; i < value.NumField(); i++ {
+		structField := value.Type().Field(i)
+		tag := structField.Tag.Get("validate")
+		if tag == "" || !structField.IsExported() {
+			continue
+		}
+
+		field := fieldName(structField)
+		fieldValue := value.Field(i)
+		present := !fieldValue.IsZero()
+		if fieldValue.Kind() == reflect.Pointer && present {
+			fieldValue = fieldValue.Elem()
+		}
+		for _, spec := range strings.Split(tag, ",") {
+			name, param, _ := strings.Cut(spec, "=")
+			check, ok := rules[name]
+			if !ok {
+				panic(fmt.Sprintf("validator: unknown rule %q on %s", name, structField.Name))
+			}
+			if name != "required" && !present {
+				continue
+			}
+			if fieldErr := check(field, fieldValue, param); fieldErr != nil {
+				errs = append(errs, *fieldErr)
+				break
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func checkRequired(field string, value reflect.Value, _ string) *FieldError {
+	if value.IsZero() || (value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "") {
+		return &FieldError{Field: field, Code: "required", Message: field + " is required"}
+	}
+	return nil
+}
+
+func checkNotBlank(field string, value reflect.Value, _ string) *FieldError {
+	if strings.TrimSpace(value.String()) == "" {
+		return &FieldError{Field: field, Code: "notblank", Message: field + " must not be blank"}
+	}
+	return nil
+}
+
+func checkEmail(field string, value reflect.Value, _ string) *FieldError {
+	address, err := mail.ParseAddress(value.String())
+	if err != nil || address.Name != "" || address.Address != value.String() {
+		return &FieldError{Field: field, Code: "email", Message: field + " must be a valid email address"}
+	}
+	return nil
+}
+
+func checkPassword(field string, value reflect.Value, _ string) *FieldError {
+	s := value.String()
+	var hasLetter, hasDigit bool
+	for _, r := range s {
+		hasLetter = hasLetter || unicode.IsLetter(r)
+		hasDigit = hasDigit || unicode.IsDigit(r)
+	}
+
+	// bcrypt ignores everything past 72 bytes, so the maximum counts bytes
+	// while the minimum counts characters.
+	if utf8.RuneCountInString(s) < 8 || len(s) > 72 || !hasLetter || !hasDigit {
+		return &FieldError{Field: field, Code: "password", Message: field + " must have at least 8 characters, at most 72 bytes, and contain letters and digits"}
+	}
+	return nil
+}
+
+func checkMin(field string, value reflect.Value, param string) *FieldError {
+	limit := mustParseFloat(param)
+	if value.Kind() == reflect.String {
+		if float64(utf8.RuneCountInString(value.String())) < limit {
+			return &FieldError{Field: field, Code: "min", Message: fmt.Sprintf("%s must have at least %s characters", field, param)}
+		}
+		return nil
+	}
+	if number(value) < limit {
+		return &FieldError{Field: field, Code: "min", Message: fmt.Sprintf("%s must be at least %s", field, param)}
+	}
+	return nil
+}
+
+func checkMax(field string, value reflect.Value, param string) *FieldError {
+	limit := mustParseFloat(param)
+	if value.Kind() == reflect.String {
+		if float64(utf8.RuneCountInString(value.String())) > limit {
+			return &FieldError{Field: field, Code: "max", Message: fmt.Sprintf("%s must have at most %s characters", field, param)}
+		}
+		return nil
+	}
+	if number(value) > limit {
+		return &FieldError{Field: field, Code: "max", Message: fmt.Sprintf("%s must be at most %s", field, param)}
+	}
+	return nil
+}
+
+func checkGt(field string, value reflect.Value, param string) *FieldError {
+	if number(value) <= mustParseFloat(param) {
+		return &FieldError{Field: field, Code: "gt", Message: fmt.Sprintf("%s must be greater than %s", field, param)}
+	}
+	return nil
+}
+
+func number(value reflect.Value) float64 {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	}
+	panic(fmt.Sprintf("validator: %s is not numeric", value.Kind()))
+}
+
+func mustParseFloat(param string) float64 {
+	f, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validator: invalid rule parameter %q", param))
+	}
+	return f
+}
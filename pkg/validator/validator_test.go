@@ -0,0 +1,79 @@
+package validator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+type signUp struct {
+	Name     string  `json:"name" validate:"required,min=2,max=5"`
+	Email    string  `json:"email" validate:"required,email"`
+	Password string  `json:"password" validate:"required,password"`
+	Age      int     `json:"age" validate:"min=18,max=130"`
+	Balance  float64 `json:"balance" validate:"gt=0"`
+}
+
+func TestValidateAcceptsValidStruct(t *testing.T) {
+	err := Validate(&signUp{Name: "John", Email: "j@j.com", Password: "secret123", Age: 30, Balance: 1})
+
+	assert.NoError(t, err)
+}
+
+func TestValidateReportsAllViolations(t *testing.T) {
+	err := Validate(&signUp{Name: "Johnathan", Email: "John <j@j.com>", Password: "12345678", Age: 12, Balance: -1})
+
+	assert.Equal(t, Errors{
+		{Field: "name", Code: "max", Message: "name must have at most 5 characters"},
+		{Field: "email", Code: "email", Message: "email must be a valid email address"},
+		{Field: "password", Code: "password", Message: "password must have at least 8 characters, at most 72 bytes, and contain letters and digits"},
+		{Field: "age", Code: "min", Message: "age must be at least 18"},
+		{Field: "balance", Code: "gt", Message: "balance must be greater than 0"},
+	}, err)
+}
+
+func TestValidatePasswordLength(t *testing.T) {
+	valid := func(password string) error {
+		return Validate(&struct {
+			Password string `json:"password" validate:"password"`
+		}{Password: password})
+	}
+
+	assert.Error(t, valid("pässwö1"), "7 characters are too few, however many bytes")
+	assert.NoError(t, valid("pässwör1"))
+	assert.NoError(t, valid(strings.Repeat("a", 71)+"1"))
+	assert.Error(t, valid(strings.Repeat("ä", 36)+"1"), "73 bytes are too many for bcrypt")
+}
+
+func TestValidateRequired(t *testing.T) {
+	err := Validate(&signUp{Name: "  "})
+
+	assert.Equal(t, Errors{
+		{Field: "name", Code: "required", Message: "name is required"},
+		{Field: "email", Code: "required", Message: "email is required"},
+		{Field: "password", Code: "required", Message: "password is required"},
+	}, err)
+}
+
+func TestValidatePanicsOnUnknownRule(t *testing.T) {
+	assert.Panics(t, func() {
+		Validate(&struct {
+			Name string `validate:"uppercase"`
+		}{Name: "John"})
+	})
+}
+
+func TestValidateChecksPointedValues(t *testing.T) {
+	type patch struct {
+		Name  *string `json:"name" validate:"notblank,max=5"`
+		Email *string `json:"email" validate:"email"`
+	}
+	blank := "  "
+	email := "j@j.com"
+
+	assert.NoError(t, Validate(&patch{}))
+	assert.NoError(t, Validate(&patch{Email: &email}))
+	assert.Equal(t, Errors{
+		{Field: "name", Code: "notblank", Message: "name must not be blank"},
+	}, Validate(&patch{Name: &blank}))
+}